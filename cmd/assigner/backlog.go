@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic/actions"
+	"github.com/rafaeljusto/teamwork-ai/internal/config"
+)
+
+// backlogCommand assigns all unassigned tasks of a project, for tasks that
+// were created without triggering webhooks (e.g. imports and templates).
+type backlogCommand struct {
+	filters    actions.AssignBacklogFilters
+	workers    int
+	dryRun     bool
+	jsonOutput bool
+}
+
+// parseBacklogCommand parses the flags of the backlog command.
+func parseBacklogCommand(args []string) (*backlogCommand, error) {
+	var command backlogCommand
+	var dueAfter, dueBefore string
+
+	flagSet := flag.NewFlagSet("backlog", flag.ContinueOnError)
+	flagSet.Int64Var(&command.filters.ProjectID, "project", 0, "Project of the tasks (required)")
+	flagSet.Int64Var(&command.filters.TasklistID, "tasklist", 0, "Only tasks of this tasklist")
+	flagSet.StringVar(&command.filters.Tag, "tag", "", "Only tasks with this tag")
+	flagSet.StringVar(&dueAfter, "due-after", "", "Only tasks due on or after this date (YYYY-MM-DD)")
+	flagSet.StringVar(&dueBefore, "due-before", "", "Only tasks due on or before this date (YYYY-MM-DD)")
+	flagSet.IntVar(&command.workers, "workers", 2, "Number of tasks analyzed at the same time")
+	flagSet.BoolVar(&command.dryRun, "dry-run", false, "Only print the proposed assignees")
+	flagSet.BoolVar(&command.jsonOutput, "json", false, "Print the summary as JSON")
+	if err := flagSet.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if command.filters.ProjectID == 0 {
+		return nil, fmt.Errorf("missing project")
+	}
+	var err error
+	if command.filters.DueAfter, err = parseDate(dueAfter); err != nil {
+		return nil, fmt.Errorf("invalid due-after: %w", err)
+	}
+	if command.filters.DueBefore, err = parseDate(dueBefore); err != nil {
+		return nil, fmt.Errorf("invalid due-before: %w", err)
+	}
+	return &command, nil
+}
+
+// run assigns the tasks and prints the summary to the standard output.
+func (b *backlogCommand) run(resources *config.Resources) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	options := []actions.AssignBacklogOption{
+		actions.WithAssignBacklogWorkers(b.workers),
+		actions.WithAssignBacklogAutoAssignTaskOptions(autoAssignTaskOptions()...),
+	}
+	if b.dryRun {
+		options = append(options, actions.WithAssignBacklogDryRun())
+	}
+
+	summary, err := actions.AssignBacklog(ctx, resources, b.filters, options...)
+	if err != nil {
+		resources.Logger.Error("failed to assign backlog",
+			slog.String("error", err.Error()),
+		)
+		exit(exitCodeSetupFailure)
+	}
+
+	if b.jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(summary)
+	} else {
+		err = printBacklogSummary(os.Stdout, summary)
+	}
+	if err != nil {
+		resources.Logger.Error("failed to print backlog summary",
+			slog.String("error", err.Error()),
+		)
+	}
+	if summary.Failed > 0 {
+		exit(exitCodePartialFailure)
+	}
+}
+
+// printBacklogSummary prints a table with the outcome of each task, followed by
+// the totals.
+func printBacklogSummary(w io.Writer, summary *actions.AssignBacklogSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TASK\tNAME\tSTATUS\tDETAILS")
+	for _, task := range summary.Tasks {
+		status, details := string(task.Status), strings.Join(task.UserNames, ", ")
+		switch {
+		case task.Error != "":
+			status, details = "failed", task.Error
+		case task.Status == actions.AutoAssignTaskStatusSkipped:
+			details = task.Reason
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", task.ID, task.Name, status, details)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	var mode string
+	if summary.DryRun {
+		mode = " (dry-run)"
+	}
+	_, err := fmt.Fprintf(w, "\n%d tasks%s: %d assigned, %d suggested, %d skipped, %d failed\n",
+		len(summary.Tasks), mode, summary.Assigned, summary.Suggested, summary.Skipped, summary.Failed)
+	return err
+}
+
+// backlogRequest is the payload of the backlog administrative endpoint.
+type backlogRequest struct {
+	actions.AssignBacklogFilters
+
+	Workers int  `json:"workers"`
+	DryRun  bool `json:"dryRun"`
+}
+
+// handleBacklog assigns the backlog of a project, answering with the summary.
+// The request waits for all tasks to be analyzed.
+func handleBacklog(resources *config.Resources) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request backlogRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			resources.Logger.Error("failed to decode request body",
+				slog.String("error", err.Error()),
+			)
+			http.Error(w, "failed to decode request body", http.StatusBadRequest)
+			return
+		}
+		if request.ProjectID == 0 {
+			http.Error(w, "missing project", http.StatusBadRequest)
+			return
+		}
+
+		options := []actions.AssignBacklogOption{
+			actions.WithAssignBacklogAutoAssignTaskOptions(autoAssignTaskOptions()...),
+		}
+		if request.Workers > 0 {
+			options = append(options, actions.WithAssignBacklogWorkers(request.Workers))
+		}
+		if request.DryRun {
+			options = append(options, actions.WithAssignBacklogDryRun())
+		}
+
+		summary, err := actions.AssignBacklog(r.Context(), resources, request.AssignBacklogFilters, options...)
+		if err != nil {
+			resources.Logger.Error("failed to assign backlog",
+				slog.String("error", err.Error()),
+			)
+			http.Error(w, "failed to assign backlog", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(summary); err != nil {
+			resources.Logger.Error("failed to encode backlog summary",
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// parseDate parses an optional date in the YYYY-MM-DD format.
+func parseDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
+}
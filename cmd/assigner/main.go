@@ -3,31 +3,62 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"expvar"
 	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/rafaeljusto/teamwork-ai/internal/agentic/actions"
 	_ "github.com/rafaeljusto/teamwork-ai/internal/agentic/anthropic"
+	_ "github.com/rafaeljusto/teamwork-ai/internal/agentic/ensemble"
+	_ "github.com/rafaeljusto/teamwork-ai/internal/agentic/fixture"
+	_ "github.com/rafaeljusto/teamwork-ai/internal/agentic/gemini"
 	_ "github.com/rafaeljusto/teamwork-ai/internal/agentic/ollama"
 	_ "github.com/rafaeljusto/teamwork-ai/internal/agentic/openai"
+	_ "github.com/rafaeljusto/teamwork-ai/internal/agentic/openaicompatible"
 	"github.com/rafaeljusto/teamwork-ai/internal/config"
+	"github.com/rafaeljusto/teamwork-ai/internal/debounce"
 	"github.com/rafaeljusto/teamwork-ai/internal/webhook"
 )
 
 var (
-	skipRates      bool
-	skipWorkload   bool
-	skipAssignment bool
-	skipComment    bool
+	skipRates        bool
+	skipWorkload     bool
+	skipDependencies bool
+	skipAssignment   bool
+	skipComment      bool
+	dependencyBoost  int64
+	optInTag         string
+	optOutTag        string
+
+	confidenceThreshold float64
+	lowConfidenceMode   string
+
+	approvalTTL    time.Duration
+	approvers      string
+	concurrency    int
+	debounceWindow time.Duration
+
+	agentTools    string
+	agentMaxSteps int
+
+	corrections int
 )
 
 func main() {
@@ -35,10 +66,70 @@ func main() {
 
 	flag.BoolVar(&skipRates, "skip-rates", false, "Skip rate analysis when assigning a task")
 	flag.BoolVar(&skipWorkload, "skip-workload", false, "Skip workload analysis when assigning a task")
+	flag.BoolVar(&skipDependencies, "skip-dependencies", false, "Skip related tasks analysis when assigning a task")
 	flag.BoolVar(&skipAssignment, "skip-assignment", false, "Skip task assignment (only comment)")
 	flag.BoolVar(&skipComment, "skip-comment", false, "Skip task comment (only assign)")
+	flag.Int64Var(&dependencyBoost, "dependency-boost", 0,
+		"Score added to users assigned to related tasks (0 uses the same weight as the workload analysis)")
+	flag.StringVar(&optInTag, "opt-in-tag", "", "Only assign tasks when the project, tasklist or task has this tag")
+	flag.StringVar(&optOutTag, "opt-out-tag", "", "Never assign tasks when the project, tasklist or task has this tag")
+	flag.Float64Var(&confidenceThreshold, "confidence-threshold", 0,
+		"Minimum confidence (between 0 and 1) of the AI suggestions (0 disables the check)")
+	flag.StringVar(&lowConfidenceMode, "low-confidence-mode", string(actions.LowConfidenceModeDrop),
+		"What to do with AI suggestions below the confidence threshold (drop or suggest)")
+	flag.DurationVar(&approvalTTL, "approval-ttl", 0,
+		"Wait for a user approval before assigning, expiring suggestions after this period (0 disables it)")
+	flag.StringVar(&approvers, "approvers", "", "Comma-separated list of user IDs allowed to approve suggestions")
+	flag.IntVar(&concurrency, "concurrency", 4, "Maximum number of concurrent Teamwork requests when loading a task")
+	flag.DurationVar(&debounceWindow, "debounce", 0,
+		"Wait for the task to be quiet for this period before processing it in background (0 disables it)")
+	flag.StringVar(&agentTools, "agent-tools", "",
+		"Comma-separated list of MCP tools the AI can call before answering (empty disables the agent mode)")
+	flag.IntVar(&agentMaxSteps, "agent-max-steps", 5, "Maximum number of MCP tool call rounds in agent mode")
+	flag.IntVar(&corrections, "corrections", 1,
+		"Maximum number of times the AI is asked to fix unknown skill or job role IDs (0 disables it)")
 	flag.Parse()
 
+	switch actions.LowConfidenceMode(lowConfidenceMode) {
+	case actions.LowConfidenceModeDrop, actions.LowConfidenceModeSuggest:
+	default:
+		slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			Level: slog.LevelError,
+		})).Error("invalid low confidence mode",
+			slog.String("mode", lowConfidenceMode),
+		)
+		exit(exitCodeInvalidInput)
+	}
+
+	approverIDs, err := parseIDs(approvers)
+	if err != nil {
+		slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			Level: slog.LevelError,
+		})).Error("invalid approvers",
+			slog.String("error", err.Error()),
+		)
+		exit(exitCodeInvalidInput)
+	}
+	if approvalTTL > 0 && len(approverIDs) == 0 {
+		// without approvers any user commenting on the task could assign it
+		slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			Level: slog.LevelError,
+		})).Error("approval mode requires the approvers")
+		exit(exitCodeInvalidInput)
+	}
+
+	var backlog *backlogCommand
+	if flag.Arg(0) == "backlog" {
+		if backlog, err = parseBacklogCommand(flag.Args()[1:]); err != nil {
+			slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+				Level: slog.LevelError,
+			})).Error("invalid backlog command",
+				slog.String("error", err.Error()),
+			)
+			exit(exitCodeInvalidInput)
+		}
+	}
+
 	c, errs := config.ParseFromEnvs()
 	if errs != nil {
 		// We are using a logger to print the errors because we don't have a
@@ -54,7 +145,28 @@ func main() {
 		}
 		exit(exitCodeInvalidInput)
 	}
-	resources := config.NewResources(c)
+	resources, err := config.NewResources(c)
+	if err != nil {
+		logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			Level: slog.LevelError,
+		}))
+		logger.Error("failed to create resources",
+			slog.String("error", err.Error()),
+		)
+		exit(exitCodeSetupFailure)
+	}
+
+	if backlog != nil {
+		defer func() {
+			if err := resources.MCPClient.Close(); err != nil {
+				resources.Logger.Error("failed to close MCP session",
+					slog.String("error", err.Error()),
+				)
+			}
+		}()
+		backlog.run(resources)
+		return
+	}
 
 	listener, err := net.Listen("tcp", ":"+strconv.FormatInt(c.Port, 10))
 	if err != nil {
@@ -69,7 +181,49 @@ func main() {
 	)
 
 	router := http.NewServeMux()
-	router.HandleFunc("POST /teamwork-ai/webhooks/task", handleTask(resources))
+	var taskDebouncer *debounce.Debouncer[int64, webhook.TaskData]
+	if debounceWindow > 0 {
+		taskDebouncer = debounce.New(debounceWindow, func(_ int64, taskData webhook.TaskData) {
+			autoAssignTask(context.Background(), resources, taskData)
+		})
+	}
+
+	router.HandleFunc("POST /teamwork-ai/webhooks/task", webhookOnly(c.WebhookToken,
+		handleTask(resources, taskDebouncer),
+	))
+	router.HandleFunc("POST /teamwork-ai/webhooks/comment", webhookOnly(c.WebhookToken,
+		handleComment(resources, approverIDs),
+	))
+	if c.WebhookToken != "" {
+		// flushing the cache is expensive, so only signed events are accepted
+		router.HandleFunc("POST /teamwork-ai/webhooks/skill", webhookOnly(c.WebhookToken,
+			handleCacheInvalidation(resources, "skill", func(*http.Request) { resources.Cache.Skills.Flush() }),
+		))
+		router.HandleFunc("POST /teamwork-ai/webhooks/jobrole", webhookOnly(c.WebhookToken,
+			handleCacheInvalidation(resources, "jobRole", func(*http.Request) { resources.Cache.JobRoles.Flush() }),
+		))
+		router.HandleFunc("POST /teamwork-ai/webhooks/person", webhookOnly(c.WebhookToken,
+			// users are related to skills, job roles and projects
+			handleCacheInvalidation(resources, "person", func(*http.Request) { resources.Cache.Flush() }),
+		))
+		router.HandleFunc("POST /teamwork-ai/webhooks/project-people", webhookOnly(c.WebhookToken,
+			handleCacheInvalidation(resources, "projectPeople", func(r *http.Request) {
+				var projectData webhook.ProjectData
+				if err := json.NewDecoder(r.Body).Decode(&projectData); err != nil || projectData.Project.ID == 0 {
+					resources.Cache.ProjectUsers.Flush()
+					return
+				}
+				resources.Cache.ProjectUsers.Delete(projectData.Project.ID)
+			}),
+		))
+	}
+	if c.AdminToken != "" {
+		router.HandleFunc("GET /debug/vars", adminOnly(c.AdminToken, expvar.Handler().ServeHTTP))
+		router.HandleFunc("POST /teamwork-ai/admin/cache/flush", adminOnly(c.AdminToken,
+			handleCacheInvalidation(resources, "admin", func(*http.Request) { resources.Cache.Flush() }),
+		))
+		router.HandleFunc("POST /teamwork-ai/admin/backlog", adminOnly(c.AdminToken, handleBacklog(resources)))
+	}
 
 	server := http.Server{
 		Handler: router,
@@ -98,10 +252,22 @@ func main() {
 			slog.String("error", err.Error()),
 		)
 	}
+	if taskDebouncer != nil {
+		// tasks waiting for the quiet period are processed before leaving
+		taskDebouncer.Flush()
+	}
+	if err := resources.MCPClient.Close(); err != nil {
+		resources.Logger.Error("failed to close MCP session",
+			slog.String("error", err.Error()),
+		)
+	}
 	resources.Logger.Info("server stopped")
 }
 
-func handleTask(resources *config.Resources) func(w http.ResponseWriter, r *http.Request) {
+func handleTask(
+	resources *config.Resources,
+	taskDebouncer *debounce.Debouncer[int64, webhook.TaskData],
+) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
 		var taskData webhook.TaskData
@@ -113,25 +279,101 @@ func handleTask(resources *config.Resources) func(w http.ResponseWriter, r *http
 			return
 		}
 
-		var options []actions.AutoAssignTaskOption
-		if skipRates {
-			options = append(options, actions.WithAutoAssignTaskSkipRates())
-		}
-		if skipWorkload {
-			options = append(options, actions.WithAutoAssignTaskSkipWorkload())
+		// bursts of events for the same task are coalesced, and only the latest
+		// one is processed in background
+		if taskDebouncer != nil {
+			taskDebouncer.Push(taskData.Task.ID, taskData)
+			w.WriteHeader(http.StatusAccepted)
+			return
 		}
-		if skipAssignment {
-			options = append(options, actions.WithAutoAssignTaskSkipAssignment())
+
+		if !autoAssignTask(r.Context(), resources, taskData) {
+			http.Error(w, "failed to auto assign task", http.StatusInternalServerError)
+			return
 		}
-		if skipComment {
-			options = append(options, actions.WithAutoAssignTaskSkipComment())
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// autoAssignTask assigns the task, logging any failure. It returns false when
+// the task couldn't be processed.
+func autoAssignTask(ctx context.Context, resources *config.Resources, taskData webhook.TaskData) bool {
+	if err := actions.AutoAssignTask(ctx, resources, taskData, autoAssignTaskOptions()...); err != nil {
+		resources.Logger.Error("failed to auto assign task",
+			slog.Int64("taskID", taskData.Task.ID),
+			slog.String("error", err.Error()),
+		)
+		return false
+	}
+	return true
+}
+
+// autoAssignTaskOptions builds the options of the AutoAssignTask function from
+// the flags.
+func autoAssignTaskOptions() []actions.AutoAssignTaskOption {
+	var options []actions.AutoAssignTaskOption
+	if skipRates {
+		options = append(options, actions.WithAutoAssignTaskSkipRates())
+	}
+	if skipWorkload {
+		options = append(options, actions.WithAutoAssignTaskSkipWorkload())
+	}
+	if skipDependencies {
+		options = append(options, actions.WithAutoAssignTaskSkipDependencies())
+	}
+	if dependencyBoost > 0 {
+		options = append(options, actions.WithAutoAssignTaskDependencyBoost(dependencyBoost))
+	}
+	if optInTag != "" {
+		options = append(options, actions.WithAutoAssignTaskOptInTag(optInTag))
+	}
+	if optOutTag != "" {
+		options = append(options, actions.WithAutoAssignTaskOptOutTag(optOutTag))
+	}
+	if confidenceThreshold > 0 {
+		options = append(options, actions.WithAutoAssignTaskConfidenceThreshold(
+			confidenceThreshold,
+			actions.LowConfidenceMode(lowConfidenceMode),
+		))
+	}
+	options = append(options, actions.WithAutoAssignTaskConcurrency(concurrency))
+	if approvalTTL > 0 {
+		options = append(options, actions.WithAutoAssignTaskApproval(approvalTTL))
+	}
+	if skipAssignment {
+		options = append(options, actions.WithAutoAssignTaskSkipAssignment())
+	}
+	if skipComment {
+		options = append(options, actions.WithAutoAssignTaskSkipComment())
+	}
+	if tools := parseNames(agentTools); len(tools) > 0 {
+		options = append(options, actions.WithAutoAssignTaskAgent(agentMaxSteps, tools...))
+	}
+	options = append(options, actions.WithAutoAssignTaskCorrections(corrections))
+	return options
+}
+
+func handleComment(resources *config.Resources, approverIDs []int64) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+		var commentData webhook.CommentData
+		if err := decoder.Decode(&commentData); err != nil {
+			resources.Logger.Error("failed to decode request body",
+				slog.String("error", err.Error()),
+			)
+			http.Error(w, "failed to decode request body", http.StatusBadRequest)
+			return
 		}
 
-		if err := actions.AutoAssignTask(r.Context(), resources, taskData, options...); err != nil {
-			resources.Logger.Error("failed to auto assign task",
+		err := actions.ReviewTaskSuggestion(r.Context(), resources, commentData,
+			actions.WithReviewTaskSuggestionApprovers(approverIDs...),
+		)
+		if err != nil {
+			resources.Logger.Error("failed to review task suggestion",
 				slog.String("error", err.Error()),
 			)
-			http.Error(w, "failed to auto assign task", http.StatusInternalServerError)
+			http.Error(w, "failed to review task suggestion", http.StatusInternalServerError)
 			return
 		}
 
@@ -139,12 +381,95 @@ func handleTask(resources *config.Resources) func(w http.ResponseWriter, r *http
 	}
 }
 
+func handleCacheInvalidation(
+	resources *config.Resources,
+	source string,
+	invalidate func(r *http.Request),
+) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invalidate(r)
+		resources.Logger.Debug("cache invalidated",
+			slog.String("source", source),
+		)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// adminOnly only allows requests with the administrative Bearer token.
+func adminOnly(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(authorization), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// webhookOnly only allows requests signed with the webhook token. Teamwork.com
+// sends the HMAC-SHA256 of the body, in hexadecimal, in the
+// X-Projects-Signature header. When the token is empty, all requests are
+// allowed.
+func webhookOnly(token string, next http.HandlerFunc) http.HandlerFunc {
+	if token == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		signature, err := hex.DecodeString(r.Header.Get("X-Projects-Signature"))
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(token))
+		mac.Write(body)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
+
+// parseIDs parses a comma-separated list of IDs.
+func parseIDs(list string) ([]int64, error) {
+	var ids []int64
+	for idStr := range strings.SplitSeq(list, ",") {
+		if idStr = strings.TrimSpace(idStr); idStr == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q: %w", idStr, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func parseNames(list string) []string {
+	var names []string
+	for name := range strings.SplitSeq(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 type exitCode int
 
 const (
 	exitCodeOK exitCode = iota
 	exitCodeInvalidInput
 	exitCodeSetupFailure
+	exitCodePartialFailure
 )
 
 type exitData struct {
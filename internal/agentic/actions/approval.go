@@ -0,0 +1,337 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rafaeljusto/teamwork-ai/internal/config"
+	"github.com/rafaeljusto/teamwork-ai/internal/webhook"
+	"github.com/teamwork/twapi-go-sdk/projects"
+)
+
+var (
+	pendingApprovals = newApprovalStore()
+
+	reApprovalDecision = regexp.MustCompile(`^(approve|reject)(?:\s+#?([0-9]+))?[.!]?$`)
+	reHTMLTag          = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ReviewTaskSuggestionOptions contains the options for the
+// ReviewTaskSuggestion function.
+type ReviewTaskSuggestionOptions struct {
+	approverIDs []int64
+}
+
+// ReviewTaskSuggestionOption is a function that sets an option for the
+// ReviewTaskSuggestion function.
+type ReviewTaskSuggestionOption func(*ReviewTaskSuggestionOptions)
+
+// WithReviewTaskSuggestionApprovers sets the users allowed to approve or reject
+// a suggestion. When not set, all decisions are ignored.
+func WithReviewTaskSuggestionApprovers(userIDs ...int64) ReviewTaskSuggestionOption {
+	return func(o *ReviewTaskSuggestionOptions) {
+		o.approverIDs = userIDs
+	}
+}
+
+// ReviewTaskSuggestion handles a comment replying to a pending AI assignment
+// suggestion (see WithAutoAssignTaskApproval). The comment can be "approve",
+// to assign the top suggested users, "approve <number>", to assign a specific
+// candidate, or "reject", to discard the suggestion. Any other comment is
+// ignored.
+func ReviewTaskSuggestion(
+	ctx context.Context,
+	resources *config.Resources,
+	commentData webhook.CommentData,
+	optFuncs ...ReviewTaskSuggestionOption,
+) error {
+	var options ReviewTaskSuggestionOptions
+	for _, optFunc := range optFuncs {
+		optFunc(&options)
+	}
+
+	taskID := commentData.Comment.ObjectID
+	logger := resources.Logger.With(
+		slog.String("action", "reviewTaskSuggestion"),
+		slog.Int64("taskID", taskID),
+		slog.Int64("commentID", commentData.Comment.ID),
+	)
+
+	if !strings.EqualFold(commentData.Comment.ObjectType, "task") {
+		return nil
+	}
+	decision, ok := parseApprovalDecision(commentData.Comment.Body)
+	if !ok {
+		return nil
+	}
+
+	pending, ok := pendingApprovals.load(taskID)
+	if !ok {
+		logger.Info("no pending suggestion for the task, ignoring decision")
+		return nil
+	}
+	if len(options.approverIDs) == 0 {
+		logger.Info("no approvers configured, ignoring decision")
+		return nil
+	}
+
+	// the webhook payload can be forged, so the decision and its author are
+	// confirmed with the comment stored in Teamwork.com
+	comment, err := projects.CommentGet(ctx, resources.TeamworkEngine,
+		projects.NewCommentGetRequest(commentData.Comment.ID),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to load comment: %w", err)
+	}
+	if comment.Comment.Object == nil || comment.Comment.Object.ID != taskID ||
+		!strings.EqualFold(strings.TrimSuffix(comment.Comment.Object.Type, "s"), "task") {
+		logger.Info("comment doesn't belong to the task, ignoring decision")
+		return nil
+	}
+	if storedDecision, ok := parseApprovalDecision(comment.Comment.Body); !ok || storedDecision != decision {
+		logger.Info("comment doesn't match the stored one, ignoring decision")
+		return nil
+	}
+	if comment.Comment.PostedBy == nil || *comment.Comment.PostedBy != commentData.EventCreator.ID {
+		logger.Info("comment author doesn't match the stored one, ignoring decision")
+		return nil
+	}
+	if !slices.Contains(options.approverIDs, *comment.Comment.PostedBy) {
+		logger.Info("user not authorized to review the suggestion, ignoring decision",
+			slog.Int64("userID", *comment.Comment.PostedBy),
+		)
+		return nil
+	}
+
+	candidates := pending.topCandidates
+	if decision.candidate > 0 {
+		if decision.candidate > len(pending.candidates) {
+			logger.Info("unknown candidate in the decision, ignoring it",
+				slog.Int("candidate", decision.candidate),
+			)
+			return nil
+		}
+		candidates = pending.candidates[decision.candidate-1 : decision.candidate]
+	}
+
+	if _, ok := pendingApprovals.take(taskID); !ok {
+		// another decision was processed concurrently
+		return nil
+	}
+
+	reviewer := strings.TrimSpace(commentData.EventCreator.FirstName + " " + commentData.EventCreator.LastName)
+	var body string
+	if decision.approved {
+		userIDs := make([]int64, len(candidates))
+		names := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			userIDs[i] = candidate.id
+			names[i] = candidate.name
+		}
+
+		taskUpdate := projects.NewTaskUpdateRequest(taskID)
+		taskUpdate.Path.ID = taskID
+		taskUpdate.Assignees = &projects.UserGroups{
+			UserIDs: userIDs,
+		}
+		if _, err := projects.TaskUpdate(ctx, resources.TeamworkEngine, taskUpdate); err != nil {
+			// keep the suggestion, so the user can try again
+			pendingApprovals.store(taskID, pending)
+			return fmt.Errorf("failed to assign task to users: %w", err)
+		}
+		logger.Info("task assigned to users based on approved AI suggestion",
+			slog.Any("userIDs", userIDs),
+			slog.Int64("reviewerID", commentData.EventCreator.ID),
+		)
+		body = fmt.Sprintf("🤖 Task assigned to %s as approved by %s.", strings.Join(names, ", "), reviewer)
+	} else {
+		logger.Info("AI suggestion rejected",
+			slog.Int64("reviewerID", commentData.EventCreator.ID),
+		)
+		body = fmt.Sprintf("🤖 Suggestion rejected by %s and discarded.", reviewer)
+	}
+
+	commentCreate := projects.NewCommentCreateRequestInTask(taskID, body)
+	if _, err := projects.CommentCreate(ctx, resources.TeamworkEngine, commentCreate); err != nil {
+		return fmt.Errorf("failed to create comment: %w", err)
+	}
+	return nil
+}
+
+type approvalRequest struct {
+	taskID          int64
+	rankedUserIDs   []int64
+	idealUserIDs    []int64
+	projectUsersMap map[int64]projects.User
+	reasoning       string
+	lowConfidence   *float64
+	ttl             time.Duration
+}
+
+// requestApproval creates a comment with the ranked candidates and stores the
+// suggestion until a decision is made or it expires.
+func requestApproval(
+	ctx context.Context,
+	resources *config.Resources,
+	request approvalRequest,
+	logger *slog.Logger,
+) error {
+	var pending pendingApproval
+	for _, userID := range request.rankedUserIDs {
+		user, ok := request.projectUsersMap[userID]
+		if !ok {
+			continue
+		}
+		candidate := approvalCandidate{
+			id:   userID,
+			name: strings.TrimSpace(user.FirstName + " " + user.LastName),
+		}
+		pending.candidates = append(pending.candidates, candidate)
+		if slices.Contains(request.idealUserIDs, userID) {
+			pending.topCandidates = append(pending.topCandidates, candidate)
+		}
+	}
+	if len(pending.topCandidates) == 0 {
+		logger.Info("no users found to suggest, skipping approval request")
+		return nil
+	}
+	pending.expiresAt = pendingApprovals.now().Add(request.ttl)
+
+	var body strings.Builder
+	body.WriteString("🤖 Artificial intelligence suggests the following users for this task.\n")
+	for i, candidate := range pending.candidates {
+		fmt.Fprintf(&body, "\n  %d. %s", i+1, candidate.name)
+	}
+	body.WriteString("\n\n" + request.reasoning)
+	if request.lowConfidence != nil {
+		fmt.Fprintf(&body, " The confidence of the suggestion is low (%.0f%%).", *request.lowConfidence*100)
+	}
+	fmt.Fprintf(&body, "\n\nReply with \"approve\" to assign the top ranked %s, \"approve <number>\" to assign "+
+		"a specific user or \"reject\" to discard the suggestion. The suggestion expires in %s.",
+		pluralize(len(pending.topCandidates), "user", "users"), request.ttl)
+
+	commentCreate := projects.NewCommentCreateRequestInTask(request.taskID, body.String())
+	if _, err := projects.CommentCreate(ctx, resources.TeamworkEngine, commentCreate); err != nil {
+		return fmt.Errorf("failed to create comment: %w", err)
+	}
+
+	pendingApprovals.store(request.taskID, pending)
+	logger.Info("AI suggestion waiting for approval",
+		slog.Time("expiresAt", pending.expiresAt),
+	)
+	return nil
+}
+
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+type approvalDecision struct {
+	approved  bool
+	candidate int
+}
+
+// parseApprovalDecision parses the comment body, that could be in HTML format,
+// looking for an approval decision.
+func parseApprovalDecision(body string) (approvalDecision, bool) {
+	body = reHTMLTag.ReplaceAllString(body, " ")
+	body = strings.ToLower(strings.Join(strings.Fields(body), " "))
+
+	matches := reApprovalDecision.FindStringSubmatch(body)
+	if matches == nil {
+		return approvalDecision{}, false
+	}
+	decision := approvalDecision{
+		approved: matches[1] == "approve",
+	}
+	if matches[2] != "" {
+		if !decision.approved {
+			return approvalDecision{}, false
+		}
+		candidate, err := strconv.Atoi(matches[2])
+		if err != nil || candidate == 0 {
+			return approvalDecision{}, false
+		}
+		decision.candidate = candidate
+	}
+	return decision, true
+}
+
+type approvalCandidate struct {
+	id   int64
+	name string
+}
+
+type pendingApproval struct {
+	candidates    []approvalCandidate
+	topCandidates []approvalCandidate
+	expiresAt     time.Time
+}
+
+// approvalStore keeps the suggestions waiting for a decision in memory. They
+// are lost when the server restarts.
+type approvalStore struct {
+	mu      sync.Mutex
+	entries map[int64]pendingApproval
+	now     func() time.Time
+}
+
+func newApprovalStore() *approvalStore {
+	return &approvalStore{
+		entries: make(map[int64]pendingApproval),
+		now:     time.Now,
+	}
+}
+
+func (a *approvalStore) store(taskID int64, pending pendingApproval) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	for id, entry := range a.entries {
+		if now.After(entry.expiresAt) {
+			delete(a.entries, id)
+		}
+	}
+	a.entries[taskID] = pending
+}
+
+func (a *approvalStore) load(taskID int64) (pendingApproval, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	pending, ok := a.entries[taskID]
+	if !ok {
+		return pendingApproval{}, false
+	}
+	if a.now().After(pending.expiresAt) {
+		delete(a.entries, taskID)
+		return pendingApproval{}, false
+	}
+	return pending, true
+}
+
+func (a *approvalStore) take(taskID int64) (pendingApproval, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	pending, ok := a.entries[taskID]
+	if !ok {
+		return pendingApproval{}, false
+	}
+	delete(a.entries, taskID)
+	if a.now().After(pending.expiresAt) {
+		return pendingApproval{}, false
+	}
+	return pending, true
+}
@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
@@ -11,7 +12,9 @@ import (
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
 	"github.com/rafaeljusto/teamwork-ai/internal/config"
+	"github.com/rafaeljusto/teamwork-ai/internal/usage"
 	"github.com/rafaeljusto/teamwork-ai/internal/webhook"
 	twapi "github.com/teamwork/twapi-go-sdk"
 	"github.com/teamwork/twapi-go-sdk/projects"
@@ -21,12 +24,101 @@ var processing sync.Map
 
 // AutoAssignTaskOptions contains the options for the AutoAssignTask function.
 type AutoAssignTaskOptions struct {
-	skipRates      bool
-	skipWorkload   bool
-	skipAssignment bool
-	skipComment    bool
+	skipRates        bool
+	skipWorkload     bool
+	skipDependencies bool
+	skipAssignment   bool
+	skipComment      bool
+	dependencyBoost  int64
+	optInTag         string
+	optOutTag        string
+
+	confidenceThreshold float64
+	lowConfidenceMode   LowConfidenceMode
+
+	approvalTTL time.Duration
+	concurrency int
+	dryRun      bool
+	report      *AutoAssignTaskReport
+
+	agentTools    []string
+	agentMaxSteps int
+
+	corrections int
+}
+
+// AutoAssignTaskStatus is the outcome of the AutoAssignTask function for a
+// task.
+type AutoAssignTaskStatus string
+
+// List of possible outcomes of the AutoAssignTask function.
+const (
+	// AutoAssignTaskStatusAssigned means that the task was assigned to the
+	// proposed users.
+	AutoAssignTaskStatusAssigned AutoAssignTaskStatus = "assigned"
+
+	// AutoAssignTaskStatusSuggested means that users were proposed, but the task
+	// was not assigned (dry-run, approval mode, low confidence or skipped
+	// assignment).
+	AutoAssignTaskStatusSuggested AutoAssignTaskStatus = "suggested"
+
+	// AutoAssignTaskStatusSkipped means that the task was not analyzed or no
+	// users were found for it.
+	AutoAssignTaskStatusSkipped AutoAssignTaskStatus = "skipped"
+)
+
+// AutoAssignTaskReport describes what the AutoAssignTask function did with a
+// task.
+type AutoAssignTaskReport struct {
+	// Status is the outcome for the task.
+	Status AutoAssignTaskStatus `json:"status"`
+
+	// Reason explains why the task was skipped.
+	Reason string `json:"reason,omitempty"`
+
+	// UserIDs are the users proposed for the task.
+	UserIDs []int64 `json:"userIds,omitempty"`
+
+	// UserNames are the names of the users proposed for the task.
+	UserNames []string `json:"userNames,omitempty"`
+
+	// Reasoning is the explanation of the proposed users.
+	Reasoning string `json:"reasoning,omitempty"`
+
+	// Usage is the number of tokens, and the estimated cost, of the requests to
+	// the model.
+	Usage *usage.Total `json:"usage,omitempty"`
+}
+
+func (r *AutoAssignTaskReport) skip(reason string) {
+	r.Status = AutoAssignTaskStatusSkipped
+	r.Reason = reason
 }
 
+// defaultConcurrency is the default maximum number of concurrent requests to
+// the Teamwork API when loading the resources of a task.
+const defaultConcurrency = 4
+
+// defaultCorrections is the default number of corrective turns sent to the AI
+// when it suggests unknown skills or job roles.
+const defaultCorrections = 1
+
+// LowConfidenceMode defines how the AutoAssignTask function reacts to AI
+// suggestions with a confidence below the configured threshold.
+type LowConfidenceMode string
+
+// List of possible low confidence modes.
+const (
+	// LowConfidenceModeDrop ignores the skills and job roles suggested with a
+	// confidence below the threshold.
+	LowConfidenceModeDrop LowConfidenceMode = "drop"
+
+	// LowConfidenceModeSuggest keeps all suggestions, but if any of them has a
+	// confidence below the threshold the task will not be assigned, only
+	// commented with the suggested users.
+	LowConfidenceModeSuggest LowConfidenceMode = "suggest"
+)
+
 // AutoAssignTaskOption is a function that sets an option for the AutoAssignTask
 // function.
 type AutoAssignTaskOption func(*AutoAssignTaskOptions)
@@ -49,6 +141,25 @@ func WithAutoAssignTaskSkipWorkload() AutoAssignTaskOption {
 	}
 }
 
+// WithAutoAssignTaskSkipDependencies sets the skipDependencies option for the
+// AutoAssignTask function. If set to true, the function will not favor users
+// that are assigned to the predecessors or to the parent task.
+func WithAutoAssignTaskSkipDependencies() AutoAssignTaskOption {
+	return func(o *AutoAssignTaskOptions) {
+		o.skipDependencies = true
+	}
+}
+
+// WithAutoAssignTaskDependencyBoost sets the score added to users that are
+// assigned to the predecessors or to the parent task. When not set (or set to
+// zero) the boost will be the number of candidates, which is the same weight
+// used by the workload analysis.
+func WithAutoAssignTaskDependencyBoost(boost int64) AutoAssignTaskOption {
+	return func(o *AutoAssignTaskOptions) {
+		o.dependencyBoost = boost
+	}
+}
+
 // WithAutoAssignTaskSkipAssignment sets the skipAssignment option for the
 // AutoAssignTask function. If set to true, the function will not assign the
 // task to the users.
@@ -67,6 +178,94 @@ func WithAutoAssignTaskSkipComment() AutoAssignTaskOption {
 	}
 }
 
+// WithAutoAssignTaskOptInTag sets the optInTag option for the AutoAssignTask
+// function. When set, only tasks where the project, the tasklist or the task
+// itself has the given tag will be assigned.
+func WithAutoAssignTaskOptInTag(tag string) AutoAssignTaskOption {
+	return func(o *AutoAssignTaskOptions) {
+		o.optInTag = tag
+	}
+}
+
+// WithAutoAssignTaskOptOutTag sets the optOutTag option for the AutoAssignTask
+// function. When set, tasks where the project, the tasklist or the task itself
+// has the given tag will be ignored. The opt-out tag has precedence over the
+// opt-in tag.
+func WithAutoAssignTaskOptOutTag(tag string) AutoAssignTaskOption {
+	return func(o *AutoAssignTaskOptions) {
+		o.optOutTag = tag
+	}
+}
+
+// WithAutoAssignTaskConfidenceThreshold sets the minimum confidence (between 0
+// and 1) accepted for the AI suggested skills and job roles. The mode defines
+// what happens with suggestions below the threshold.
+func WithAutoAssignTaskConfidenceThreshold(threshold float64, mode LowConfidenceMode) AutoAssignTaskOption {
+	return func(o *AutoAssignTaskOptions) {
+		o.confidenceThreshold = threshold
+		o.lowConfidenceMode = mode
+	}
+}
+
+// WithAutoAssignTaskApproval enables the approval mode for the AutoAssignTask
+// function. Instead of assigning the task, a comment with the ranked
+// candidates is created and the decision waits for an authorized user to reply
+// (see ReviewTaskSuggestion). Pending suggestions expire after the given TTL.
+// The approval mode has precedence over the skipAssignment and skipComment
+// options.
+func WithAutoAssignTaskApproval(ttl time.Duration) AutoAssignTaskOption {
+	return func(o *AutoAssignTaskOptions) {
+		o.approvalTTL = ttl
+	}
+}
+
+// WithAutoAssignTaskConcurrency sets the maximum number of concurrent requests
+// to the Teamwork API when loading skills, job roles and project users. By
+// default up to 4 requests are performed at the same time.
+func WithAutoAssignTaskConcurrency(concurrency int) AutoAssignTaskOption {
+	return func(o *AutoAssignTaskOptions) {
+		o.concurrency = concurrency
+	}
+}
+
+// WithAutoAssignTaskDryRun sets the dryRun option for the AutoAssignTask
+// function. If set, the function only proposes the users, without assigning,
+// commenting or requesting an approval. Use WithAutoAssignTaskReport to
+// retrieve the proposed users.
+func WithAutoAssignTaskDryRun() AutoAssignTaskOption {
+	return func(o *AutoAssignTaskOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithAutoAssignTaskAgent enables the agent mode for the AutoAssignTask
+// function. In this mode the model can call the allowed MCP tools (e.g. to read
+// the task comments) before suggesting the skills and job roles, limited to
+// maxSteps rounds of tool calls. The model must support tool calls.
+func WithAutoAssignTaskAgent(maxSteps int, tools ...string) AutoAssignTaskOption {
+	return func(o *AutoAssignTaskOptions) {
+		o.agentMaxSteps = maxSteps
+		o.agentTools = tools
+	}
+}
+
+// WithAutoAssignTaskCorrections sets the maximum number of corrective turns
+// sent to the AI when it suggests skills or job roles that don't exist. By
+// default 1 corrective turn is sent, and zero disables the corrections.
+func WithAutoAssignTaskCorrections(corrections int) AutoAssignTaskOption {
+	return func(o *AutoAssignTaskOptions) {
+		o.corrections = corrections
+	}
+}
+
+// WithAutoAssignTaskReport fills the given report with the outcome of the
+// AutoAssignTask function.
+func WithAutoAssignTaskReport(report *AutoAssignTaskReport) AutoAssignTaskOption {
+	return func(o *AutoAssignTaskOptions) {
+		o.report = report
+	}
+}
+
 // AutoAssignTask assigns a task to users based on the skills and job roles
 // associated with the task.
 func AutoAssignTask(
@@ -75,10 +274,17 @@ func AutoAssignTask(
 	taskData webhook.TaskData,
 	optFuncs ...AutoAssignTaskOption,
 ) error {
-	var options AutoAssignTaskOptions
+	options := AutoAssignTaskOptions{
+		concurrency: defaultConcurrency,
+		corrections: defaultCorrections,
+	}
 	for _, optFunc := range optFuncs {
 		optFunc(&options)
 	}
+	report := options.report
+	if report == nil {
+		report = new(AutoAssignTaskReport)
+	}
 
 	logger := resources.Logger.With(
 		slog.String("action", "autoAssignTask"),
@@ -87,6 +293,7 @@ func AutoAssignTask(
 
 	if _, ok := processing.LoadOrStore(taskData.Task.ID, struct{}{}); ok {
 		logger.Info("task already being processed, skipping AI assignment")
+		report.skip("task already being processed")
 		return nil
 	}
 	defer processing.Delete(taskData.Task.ID)
@@ -94,67 +301,136 @@ func AutoAssignTask(
 	// if there's already an assigned user, we don't need to do anything
 	if len(taskData.Task.AssignedUserIDs) > 0 {
 		logger.Info("task already has assigned users, skipping AI assignment")
+		report.skip("task already has assigned users")
 		return nil
 	}
 
-	mcpSession, err := resources.MCPClient.Connect(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to connect to MCP server: %w", err)
+	// a new suggestion would renumber the candidates of the pending one, so an
+	// approval could assign a different user than the one the approver saw
+	if _, ok := pendingApprovals.load(taskData.Task.ID); ok {
+		logger.Info("task has a suggestion waiting for approval, skipping AI assignment")
+		report.skip("task has a suggestion waiting for approval")
+		return nil
 	}
-	defer func() {
-		if err := mcpSession.Close(); err != nil {
-			logger.Error("failed to close MCP session", slog.String("error", err.Error()))
-		}
-	}()
 
-	taskSkillsAndJobRolesPrompt, err := mcpSession.GetPrompt(ctx, &mcp.GetPromptParams{
-		Name: "twprojects_task_skills_and_roles",
-		Arguments: map[string]string{
-			"task_id": strconv.FormatInt(taskData.Task.ID, 10),
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to get prompt from MCP: %w", err)
+	// tags are checked before any MCP or LLM interaction, so skipped tasks don't
+	// cost anything
+	if options.optOutTag != "" && taskData.HasTag(options.optOutTag) {
+		logger.Info("task opted out by tag, skipping AI assignment",
+			slog.String("tag", options.optOutTag),
+		)
+		report.skip("task opted out by tag")
+		return nil
 	}
-	if taskSkillsAndJobRolesPrompt == nil || taskSkillsAndJobRolesPrompt.Messages == nil {
-		return fmt.Errorf("no prompt outputs received from MCP")
+	if options.optInTag != "" && !taskData.HasTag(options.optInTag) {
+		logger.Info("task not opted in by tag, skipping AI assignment",
+			slog.String("tag", options.optInTag),
+		)
+		report.skip("task not opted in by tag")
+		return nil
 	}
-
-	skills, err := loadSkills(ctx, resources)
-	if err != nil {
-		return fmt.Errorf("failed to load skills: %w", err)
+	if resources.Usage.Exceeded() {
+		logger.Warn("monthly AI budget exceeded, skipping AI assignment")
+		report.skip("monthly AI budget exceeded")
+		return nil
 	}
-	skillsMap := skills.toMap()
 
-	jobRoles, err := loadJobRoles(ctx, resources)
+	// the prompt and the Teamwork resources don't depend on each other, so they
+	// are loaded concurrently
+	var (
+		taskSkillsAndJobRolesPrompt *mcp.GetPromptResult
+		skills                      skills
+		jobRoles                    jobRoles
+		projectUsers                projectUsers
+	)
+	limiter := newLimiter(options.concurrency)
+	err := runConcurrently(ctx,
+		func(ctx context.Context) (err error) {
+			taskSkillsAndJobRolesPrompt, err = loadTaskSkillsAndJobRolesPrompt(ctx, resources, taskData.Task.ID)
+			return err
+		},
+		func(ctx context.Context) (err error) {
+			if skills, err = loadSkills(ctx, resources, limiter); err != nil {
+				return fmt.Errorf("failed to load skills: %w", err)
+			}
+			return nil
+		},
+		func(ctx context.Context) (err error) {
+			if jobRoles, err = loadJobRoles(ctx, resources, limiter); err != nil {
+				return fmt.Errorf("failed to load job roles: %w", err)
+			}
+			return nil
+		},
+		func(ctx context.Context) (err error) {
+			if projectUsers, err = loadProjectUsers(ctx, resources, taskData.Project.ID, limiter); err != nil {
+				return fmt.Errorf("failed to load project users: %w", err)
+			}
+			return nil
+		},
+	)
 	if err != nil {
-		return fmt.Errorf("failed to load job roles: %w", err)
+		return err
 	}
+	skillsMap := skills.toMap()
 	jobRolesMap := jobRoles.toMap()
-
-	projectUsers, err := loadProjectUsers(ctx, resources, taskData.Project.ID)
-	if err != nil {
-		return fmt.Errorf("failed to load project users: %w", err)
-	}
 	projectUsersMap := projectUsers.toMap()
 
-	skillIDs, jobRoleIDs, reasoning, err :=
-		resources.Agentic.FindTaskSkillsAndJobRoles(ctx, taskSkillsAndJobRolesPrompt.Messages)
+	usageCtx, usageRecorder := agentic.WithUsageRecorder(ctx)
+	skillSuggestions, jobRoleSuggestions, reasoning, err :=
+		findTaskSkillsAndJobRoles(usageCtx, resources, logger, options, taskSkillsAndJobRolesPrompt.Messages,
+			agentic.WithValidSkillsAndJobRoles(skills.names(), jobRoles.names()),
+			agentic.WithCorrections(options.corrections),
+		)
+	if usages := usageRecorder.Usages(); len(usages) > 0 {
+		total := resources.Usage.Record(taskData.Project.ID, usages)
+		logger.Info("AI usage",
+			slog.Int64("projectID", taskData.Project.ID),
+			slog.Int("requests", len(usages)),
+			slog.Int64("inputTokens", total.InputTokens),
+			slog.Int64("outputTokens", total.OutputTokens),
+			slog.Float64("cost", total.Cost),
+		)
+		report.Usage = &total
+	}
 	if err != nil {
 		return fmt.Errorf("failed to find task skills and job roles: %w", err)
 	}
 	logger.Debug("AI suggested the following job roles and skills",
-		slog.Any("skillIDs", skillIDs),
-		slog.Any("jobRoleIDs", jobRoleIDs),
+		slog.Any("skills", skillSuggestions),
+		slog.Any("jobRoles", jobRoleSuggestions),
 		slog.String("reasoning", reasoning),
 	)
 
+	var lowConfidence *float64
+	if options.confidenceThreshold > 0 {
+		switch options.lowConfidenceMode {
+		case LowConfidenceModeSuggest:
+			for _, suggestion := range slices.Concat(skillSuggestions, jobRoleSuggestions) {
+				if suggestion.Confidence >= options.confidenceThreshold {
+					continue
+				}
+				if lowConfidence == nil || suggestion.Confidence < *lowConfidence {
+					lowConfidence = &suggestion.Confidence
+				}
+			}
+			if lowConfidence != nil {
+				logger.Info("AI suggestion with low confidence, only suggesting users",
+					slog.Float64("confidence", *lowConfidence),
+					slog.Float64("threshold", options.confidenceThreshold),
+				)
+			}
+		default:
+			skillSuggestions = dropLowConfidence(skillSuggestions, options.confidenceThreshold, "skill", logger)
+			jobRoleSuggestions = dropLowConfidence(jobRoleSuggestions, options.confidenceThreshold, "jobRole", logger)
+		}
+	}
+
 	var userIDsWithSkills []int64
-	for _, skillID := range skillIDs {
-		skill, ok := skillsMap[skillID]
+	for _, skillSuggestion := range skillSuggestions {
+		skill, ok := skillsMap[skillSuggestion.ID]
 		if !ok {
 			logger.Info("skill not found in the loaded skills, AI halucination",
-				slog.Int64("skillID", skillID),
+				slog.Int64("skillID", skillSuggestion.ID),
 			)
 			continue
 		}
@@ -162,11 +438,11 @@ func AutoAssignTask(
 	}
 
 	var userIDsWithJobRoles []int64
-	for _, jobRoleID := range jobRoleIDs {
-		jobRole, ok := jobRolesMap[jobRoleID]
+	for _, jobRoleSuggestion := range jobRoleSuggestions {
+		jobRole, ok := jobRolesMap[jobRoleSuggestion.ID]
 		if !ok {
 			logger.Info("job role not found in the loaded job roles, AI halucination",
-				slog.Int64("jobRoleID", jobRoleID),
+				slog.Int64("jobRoleID", jobRoleSuggestion.ID),
 			)
 			continue
 		}
@@ -193,6 +469,11 @@ func AutoAssignTask(
 	if !options.skipWorkload {
 		processors = append(processors, autoAssignTaskProcessWorkload(ctx, taskData, resources, &reasoning, logger))
 	}
+	if !options.skipDependencies {
+		processors = append(processors, autoAssignTaskProcessDependencies(
+			ctx, taskData, resources, limiter, options.dependencyBoost, &reasoning, logger,
+		))
+	}
 	userScores := newUserScores(idealUserIDs)
 	for _, processor := range processors {
 		if userScores, err = processor(userScores); err != nil {
@@ -202,10 +483,39 @@ func AutoAssignTask(
 	idealUserIDs = userScores.chooseIDs()
 	if len(idealUserIDs) == 0 {
 		logger.Info("no users found with the AI suggested skills or job roles, skipping task assignment")
+		report.skip("no users found with the suggested skills or job roles")
+		return nil
+	}
+
+	report.Status = AutoAssignTaskStatusSuggested
+	report.UserIDs = idealUserIDs
+	report.UserNames = nil
+	for _, userID := range idealUserIDs {
+		if user, ok := projectUsersMap[userID]; ok {
+			report.UserNames = append(report.UserNames, strings.TrimSpace(user.FirstName+" "+user.LastName))
+		}
+	}
+	report.Reasoning = reasoning
+	if options.dryRun {
+		logger.Info("dry-run, skipping task assignment",
+			slog.Any("userIDs", idealUserIDs),
+		)
 		return nil
 	}
 
-	if !options.skipAssignment {
+	if options.approvalTTL > 0 {
+		return requestApproval(ctx, resources, approvalRequest{
+			taskID:          taskData.Task.ID,
+			rankedUserIDs:   userScores.rankIDs(),
+			idealUserIDs:    idealUserIDs,
+			projectUsersMap: projectUsersMap,
+			reasoning:       reasoning,
+			lowConfidence:   lowConfidence,
+			ttl:             options.approvalTTL,
+		}, logger)
+	}
+
+	if !options.skipAssignment && lowConfidence == nil {
 		taskUpdate := projects.NewTaskUpdateRequest(taskData.Task.ID)
 		taskUpdate.Path.ID = taskData.Task.ID
 		taskUpdate.Assignees = &projects.UserGroups{
@@ -217,6 +527,7 @@ func AutoAssignTask(
 		logger.Info("task assigned to users based on AI",
 			slog.Int64("id", taskData.Task.ID),
 		)
+		report.Status = AutoAssignTaskStatusAssigned
 	}
 
 	if !options.skipComment {
@@ -224,6 +535,11 @@ func AutoAssignTask(
 			taskData.Task.ID,
 			"🤖 Assignment of this task was performed by artificial intelligence.\n",
 		)
+		if lowConfidence != nil {
+			commentCreate.Body = fmt.Sprintf("🤖 Artificial intelligence suggests the following users for this task. "+
+				"The task was not assigned because the confidence of the suggestion is low (%.0f%%).\n",
+				*lowConfidence*100)
+		}
 		for _, userID := range idealUserIDs {
 			if user, ok := projectUsersMap[userID]; ok {
 				commentCreate.Body += fmt.Sprintf("\n  • %s %s", user.FirstName, user.LastName)
@@ -238,6 +554,28 @@ func AutoAssignTask(
 	return nil
 }
 
+// dropLowConfidence removes the suggestions with a confidence below the
+// threshold.
+func dropLowConfidence(
+	suggestions []agentic.Suggestion,
+	threshold float64,
+	kind string,
+	logger *slog.Logger,
+) []agentic.Suggestion {
+	return slices.DeleteFunc(suggestions, func(suggestion agentic.Suggestion) bool {
+		if suggestion.Confidence >= threshold {
+			return false
+		}
+		logger.Info("dropping AI suggestion with low confidence",
+			slog.String("kind", kind),
+			slog.Int64("id", suggestion.ID),
+			slog.Float64("confidence", suggestion.Confidence),
+			slog.Float64("threshold", threshold),
+		)
+		return true
+	})
+}
+
 type userScore struct {
 	ID    int64
 	Score int64
@@ -264,6 +602,22 @@ func (u userScores) ids() []int64 {
 	return ids
 }
 
+// rankIDs returns the distinct user IDs ordered by score, from the highest to
+// the lowest. Users with the same score keep their original order.
+func (u userScores) rankIDs() []int64 {
+	ranked := slices.Clone(u)
+	slices.SortStableFunc(ranked, func(a, b userScore) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	ids := make([]int64, 0, len(ranked))
+	for _, userScore := range ranked {
+		if !slices.Contains(ids, userScore.ID) {
+			ids = append(ids, userScore.ID)
+		}
+	}
+	return ids
+}
+
 func (u userScores) chooseIDs() []int64 {
 	var highestScore int64
 	groupedIDs := make(map[int64][]int64)
@@ -453,6 +807,106 @@ func autoAssignTaskProcessWorkload(
 	}
 }
 
+func autoAssignTaskProcessDependencies(
+	ctx context.Context,
+	taskData webhook.TaskData,
+	resources *config.Resources,
+	limiter limiter,
+	boost int64,
+	reasoning *string,
+	logger *slog.Logger,
+) autoAssignTaskProcessor {
+	logger = logger.With(
+		slog.String("subAction", "processDependencies"),
+	)
+	return func(userScores userScores) (userScores, error) {
+		if len(userScores) == 0 {
+			// no candidates to favor, so the related tasks aren't loaded
+			return userScores, nil
+		}
+
+		taskRequest := projects.NewTaskGetRequest(taskData.Task.ID)
+		taskRequest.Filters.IncludeRelatedTasks = true
+		taskRequest.Filters.IncludeCompletedPredecessors = true
+
+		taskResponse, err := projects.TaskGet(ctx, resources.TeamworkEngine, taskRequest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load task: %w", err)
+		}
+
+		relatedTaskIDs := make([]int64, 0, len(taskResponse.Task.Predecessors)+1)
+		for _, predecessor := range taskResponse.Task.Predecessors {
+			relatedTaskIDs = append(relatedTaskIDs, predecessor.ID)
+		}
+		if parentTask := taskResponse.Task.ParentTask; parentTask != nil && parentTask.ID > 0 {
+			relatedTaskIDs = append(relatedTaskIDs, parentTask.ID)
+		}
+		if len(relatedTaskIDs) == 0 {
+			return userScores, nil
+		}
+
+		// the related tasks don't depend on each other, so they are loaded
+		// concurrently
+		var mutex sync.Mutex
+		relatedUserIDs := make(map[int64]struct{})
+		loaders := make([]func(context.Context) error, 0, len(relatedTaskIDs))
+		for _, relatedTaskID := range relatedTaskIDs {
+			loaders = append(loaders, func(ctx context.Context) error {
+				if err := limiter.acquire(ctx); err != nil {
+					return err
+				}
+				relatedTaskResponse, err := projects.TaskGet(ctx, resources.TeamworkEngine,
+					projects.NewTaskGetRequest(relatedTaskID))
+				limiter.release()
+				if err != nil {
+					return fmt.Errorf("failed to load related task %d: %w", relatedTaskID, err)
+				}
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				for _, assignee := range relatedTaskResponse.Task.Assignees {
+					if assignee.Type != "users" {
+						// teams and companies can't be mapped to a single candidate
+						continue
+					}
+					relatedUserIDs[assignee.ID] = struct{}{}
+				}
+				return nil
+			})
+		}
+		if err := runConcurrently(ctx, loaders...); err != nil {
+			return nil, err
+		}
+
+		delta := boost
+		if delta <= 0 {
+			delta = int64(len(userScores))
+		}
+		var changed bool
+		for i, userScore := range userScores {
+			if _, ok := relatedUserIDs[userScore.ID]; !ok {
+				continue
+			}
+			userScore.Score += delta
+			userScores[i] = userScore
+			changed = true
+			logger.Debug("user score changed",
+				slog.Int64("userID", userScore.ID),
+				slog.Int64("delta", delta),
+				slog.Int64("score", userScore.Score),
+			)
+		}
+		if changed && reasoning != nil {
+			if *reasoning != "" {
+				*reasoning += " "
+			}
+			*reasoning += "Users already working on related tasks (predecessors or parent task) were " +
+				"favored to keep the context."
+		}
+		return userScores, nil
+	}
+}
+
 type skills []projects.Skill
 
 func (s skills) toMap() map[int64]projects.Skill {
@@ -463,33 +917,33 @@ func (s skills) toMap() map[int64]projects.Skill {
 	return m
 }
 
-func loadSkills(ctx context.Context, resources *config.Resources) (skills, error) {
+// names returns the name of each skill by ID, used to validate the skills
+// suggested by the AI.
+func (s skills) names() map[int64]string {
+	m := make(map[int64]string, len(s))
+	for _, skill := range s {
+		m[skill.ID] = skill.Name
+	}
+	return m
+}
+
+func loadSkills(ctx context.Context, resources *config.Resources, limiter limiter) (skills, error) {
+	if cachedSkills, ok := resources.Cache.Skills.Get(struct{}{}); ok {
+		return cachedSkills, nil
+	}
+
 	skillListRequest := projects.NewSkillListRequest()
 	skillListRequest.Filters.Include = []projects.SkillListRequestSideload{projects.SkillListRequestSideloadUsers}
 
-	skillsNext, err := twapi.Iterate[projects.SkillListRequest, *projects.SkillListResponse](
-		ctx,
-		resources.TeamworkEngine,
-		skillListRequest,
+	skills, err := iterateAll(ctx, resources, limiter, skillListRequest,
+		func(skillsResponse *projects.SkillListResponse) []projects.Skill {
+			return skillsResponse.Skills
+		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build skills iterator: %w", err)
-	}
-
-	var skills skills
-	for {
-		skillsResponse, hasSkillsNext, err := skillsNext()
-		if err != nil {
-			return nil, fmt.Errorf("failed to list skills: %w", err)
-		}
-		if skillsResponse == nil {
-			break
-		}
-		skills = append(skills, skillsResponse.Skills...)
-		if !hasSkillsNext {
-			break
-		}
+		return nil, err
 	}
+	resources.Cache.Skills.Set(struct{}{}, skills)
 	return skills, nil
 }
 
@@ -503,35 +957,35 @@ func (j jobRoles) toMap() map[int64]projects.JobRole {
 	return m
 }
 
-func loadJobRoles(ctx context.Context, resources *config.Resources) (jobRoles, error) {
+// names returns the name of each job role by ID, used to validate the job roles
+// suggested by the AI.
+func (j jobRoles) names() map[int64]string {
+	m := make(map[int64]string, len(j))
+	for _, jobRole := range j {
+		m[jobRole.ID] = jobRole.Name
+	}
+	return m
+}
+
+func loadJobRoles(ctx context.Context, resources *config.Resources, limiter limiter) (jobRoles, error) {
+	if cachedJobRoles, ok := resources.Cache.JobRoles.Get(struct{}{}); ok {
+		return cachedJobRoles, nil
+	}
+
 	jobRoleListRequest := projects.NewJobRoleListRequest()
 	jobRoleListRequest.Filters.Include = []projects.JobRoleListRequestSideload{
 		projects.JobRoleListRequestSideloadUsers,
 	}
 
-	jobRolesNext, err := twapi.Iterate[projects.JobRoleListRequest, *projects.JobRoleListResponse](
-		ctx,
-		resources.TeamworkEngine,
-		jobRoleListRequest,
+	jobRoles, err := iterateAll(ctx, resources, limiter, jobRoleListRequest,
+		func(jobRolesResponse *projects.JobRoleListResponse) []projects.JobRole {
+			return jobRolesResponse.JobRoles
+		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build job roles iterator: %w", err)
-	}
-
-	var jobRoles jobRoles
-	for {
-		jobRolesResponse, hasJobRolesNext, err := jobRolesNext()
-		if err != nil {
-			return nil, fmt.Errorf("failed to list job roles: %w", err)
-		}
-		if jobRolesResponse == nil {
-			break
-		}
-		jobRoles = append(jobRoles, jobRolesResponse.JobRoles...)
-		if !hasJobRolesNext {
-			break
-		}
+		return nil, err
 	}
+	resources.Cache.JobRoles.Set(struct{}{}, jobRoles)
 	return jobRoles, nil
 }
 
@@ -545,32 +999,80 @@ func (p projectUsers) toMap() map[int64]projects.User {
 	return m
 }
 
-func loadProjectUsers(ctx context.Context, resources *config.Resources, projectID int64) (projectUsers, error) {
+func loadProjectUsers(
+	ctx context.Context,
+	resources *config.Resources,
+	projectID int64,
+	limiter limiter,
+) (projectUsers, error) {
+	if cachedProjectUsers, ok := resources.Cache.ProjectUsers.Get(projectID); ok {
+		return cachedProjectUsers, nil
+	}
+
 	userListRequest := projects.NewUserListRequest()
 	userListRequest.Path.ProjectID = projectID
 
-	projectUsersNext, err := twapi.Iterate[projects.UserListRequest, *projects.UserListResponse](
-		ctx,
-		resources.TeamworkEngine,
-		userListRequest,
+	projectUsers, err := iterateAll(ctx, resources, limiter, userListRequest,
+		func(projectUsersResponse *projects.UserListResponse) []projects.User {
+			return projectUsersResponse.Users
+		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build project users iterator: %w", err)
+		return nil, err
 	}
+	resources.Cache.ProjectUsers.Set(projectID, projectUsers)
+	return projectUsers, nil
+}
 
-	var projectUsers projectUsers
-	for {
-		projectUsersResponse, hasProjectUsersNext, err := projectUsersNext()
-		if err != nil {
-			return nil, fmt.Errorf("failed to list project users: %w", err)
-		}
-		if projectUsersResponse == nil {
-			break
-		}
-		projectUsers = append(projectUsers, projectUsersResponse.Users...)
-		if !hasProjectUsersNext {
-			break
-		}
+// findTaskSkillsAndJobRoles asks the model for the skills and job roles of the
+// task. In agent mode the model can call MCP tools over the MCP session before
+// answering.
+func findTaskSkillsAndJobRoles(
+	ctx context.Context,
+	resources *config.Resources,
+	logger *slog.Logger,
+	options AutoAssignTaskOptions,
+	promptMessages []*mcp.PromptMessage,
+	findOptions ...agentic.FindTaskSkillsAndJobRolesOption,
+) (skills, jobRoles []agentic.Suggestion, reasoning string, err error) {
+	if len(options.agentTools) == 0 {
+		return agentic.FindTaskSkillsAndJobRoles(ctx, resources.Agentic, promptMessages, findOptions...)
 	}
-	return projectUsers, nil
+
+	// the agent only retries the MCP operations when the session is lost, so
+	// the requests to the model aren't repeated
+	agent, err := agentic.NewAgent(ctx, resources.Agentic, resources.MCPClient,
+		agentic.WithAgentAllowedTools(options.agentTools...),
+		agentic.WithAgentMaxSteps(options.agentMaxSteps),
+		agentic.WithAgentLogger(logger),
+	)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to create agent: %w", err)
+	}
+	return agentic.FindTaskSkillsAndJobRoles(ctx, agent, promptMessages, findOptions...)
+}
+
+func loadTaskSkillsAndJobRolesPrompt(
+	ctx context.Context,
+	resources *config.Resources,
+	taskID int64,
+) (*mcp.GetPromptResult, error) {
+	var taskSkillsAndJobRolesPrompt *mcp.GetPromptResult
+	err := resources.MCPClient.Do(ctx, func(mcpSession *mcp.ClientSession) error {
+		var err error
+		taskSkillsAndJobRolesPrompt, err = mcpSession.GetPrompt(ctx, &mcp.GetPromptParams{
+			Name: "twprojects_task_skills_and_roles",
+			Arguments: map[string]string{
+				"task_id": strconv.FormatInt(taskID, 10),
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prompt from MCP: %w", err)
+	}
+	if taskSkillsAndJobRolesPrompt == nil || taskSkillsAndJobRolesPrompt.Messages == nil {
+		return nil, fmt.Errorf("no prompt outputs received from MCP")
+	}
+	return taskSkillsAndJobRolesPrompt, nil
 }
@@ -7,14 +7,21 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
 	"github.com/rafaeljusto/teamwork-ai/internal/agentic/actions"
 	"github.com/rafaeljusto/teamwork-ai/internal/config"
+	"github.com/rafaeljusto/teamwork-ai/internal/usage"
 	"github.com/rafaeljusto/teamwork-ai/internal/webhook"
 	twapi "github.com/teamwork/twapi-go-sdk"
 	"github.com/teamwork/twapi-go-sdk/projects"
@@ -36,17 +43,17 @@ func Test_AutoAssignTask(t *testing.T) {
 				twapi.WithHTTPClient(teamworkEngine([]projects.User{
 					{ID: 1, FirstName: "James", LastName: "Smith"},
 					{ID: 2, FirstName: "Michael", LastName: "Williams"},
-				}, false, false)),
+				}, teamworkScenario{})),
 			),
 			Agentic: agenticMock{
 				findTaskSkillsAndJobRoles: func(
 					_ context.Context,
 					promptMessages []*mcp.PromptMessage,
-				) ([]int64, []int64, string, error) {
-					if len(promptMessages) != 2 {
+				) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+					if len(promptMessages) != 3 {
 						return nil, nil, "", fmt.Errorf("unexpected number of prompts: %d", len(promptMessages))
 					}
-					return []int64{1}, []int64{}, "Some interesting explanation.", nil
+					return []agentic.Suggestion{{ID: 1, Confidence: 1}}, []agentic.Suggestion{}, "Some interesting explanation.", nil
 				},
 			},
 			Logger: slog.New(slog.DiscardHandler),
@@ -67,17 +74,17 @@ func Test_AutoAssignTask(t *testing.T) {
 			TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", "example.com"),
 				twapi.WithHTTPClient(teamworkEngine([]projects.User{
 					{ID: 2, FirstName: "Michael", LastName: "Williams"},
-				}, true, false)),
+				}, teamworkScenario{useRate: true})),
 			),
 			Agentic: agenticMock{
 				findTaskSkillsAndJobRoles: func(
 					_ context.Context,
 					promptMessages []*mcp.PromptMessage,
-				) ([]int64, []int64, string, error) {
-					if len(promptMessages) != 2 {
+				) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+					if len(promptMessages) != 3 {
 						return nil, nil, "", fmt.Errorf("unexpected number of prompts: %d", len(promptMessages))
 					}
-					return []int64{1}, []int64{}, "Some interesting explanation.", nil
+					return []agentic.Suggestion{{ID: 1, Confidence: 1}}, []agentic.Suggestion{}, "Some interesting explanation.", nil
 				},
 			},
 			Logger: slog.New(slog.DiscardHandler),
@@ -97,17 +104,17 @@ func Test_AutoAssignTask(t *testing.T) {
 			TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", "example.com"),
 				twapi.WithHTTPClient(teamworkEngine([]projects.User{
 					{ID: 2, FirstName: "Michael", LastName: "Williams"},
-				}, false, true)),
+				}, teamworkScenario{useWorkload: true})),
 			),
 			Agentic: agenticMock{
 				findTaskSkillsAndJobRoles: func(
 					_ context.Context,
 					promptMessages []*mcp.PromptMessage,
-				) ([]int64, []int64, string, error) {
-					if len(promptMessages) != 2 {
+				) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+					if len(promptMessages) != 3 {
 						return nil, nil, "", fmt.Errorf("unexpected number of prompts: %d", len(promptMessages))
 					}
-					return []int64{1}, []int64{}, "Some interesting explanation.", nil
+					return []agentic.Suggestion{{ID: 1, Confidence: 1}}, []agentic.Suggestion{}, "Some interesting explanation.", nil
 				},
 			},
 			Logger: slog.New(slog.DiscardHandler),
@@ -124,37 +131,226 @@ func Test_AutoAssignTask(t *testing.T) {
 		options: []actions.AutoAssignTaskOption{
 			actions.WithAutoAssignTaskSkipRates(),
 		},
+	}, {
+		name: "it should assign a task and comment favoring users assigned to related tasks",
+		resources: &config.Resources{
+			TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", "example.com"),
+				twapi.WithHTTPClient(teamworkEngine([]projects.User{
+					{ID: 1, FirstName: "James", LastName: "Smith"},
+				}, teamworkScenario{useDependencies: true})),
+			),
+			Agentic: agenticMock{
+				findTaskSkillsAndJobRoles: func(
+					_ context.Context,
+					promptMessages []*mcp.PromptMessage,
+				) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+					if len(promptMessages) != 3 {
+						return nil, nil, "", fmt.Errorf("unexpected number of prompts: %d", len(promptMessages))
+					}
+					return []agentic.Suggestion{{ID: 1, Confidence: 1}}, []agentic.Suggestion{}, "Some interesting explanation.", nil
+				},
+			},
+			Logger: slog.New(slog.DiscardHandler),
+		},
+		taskData: func() webhook.TaskData {
+			var taskData webhook.TaskData
+			taskData.Task.ID = 1
+			taskData.Task.Name = "task-1"
+			return taskData
+		}(),
+		options: []actions.AutoAssignTaskOption{
+			actions.WithAutoAssignTaskSkipRates(),
+			actions.WithAutoAssignTaskSkipWorkload(),
+		},
+	}, {
+		name: "it should assign a task opted in by a project tag",
+		resources: &config.Resources{
+			TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", "example.com"),
+				twapi.WithHTTPClient(teamworkEngine([]projects.User{
+					{ID: 1, FirstName: "James", LastName: "Smith"},
+					{ID: 2, FirstName: "Michael", LastName: "Williams"},
+				}, teamworkScenario{})),
+			),
+			Agentic: agenticMock{
+				findTaskSkillsAndJobRoles: func(
+					context.Context,
+					[]*mcp.PromptMessage,
+				) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+					return []agentic.Suggestion{{ID: 1, Confidence: 1}}, []agentic.Suggestion{}, "Some interesting explanation.", nil
+				},
+			},
+			Logger: slog.New(slog.DiscardHandler),
+		},
+		taskData: func() webhook.TaskData {
+			var taskData webhook.TaskData
+			taskData.Project.Tags = []webhook.Tag{{ID: 1, Name: "AI-Assign"}}
+			taskData.Task.ID = 1
+			taskData.Task.Name = "task-1"
+			return taskData
+		}(),
+		options: []actions.AutoAssignTaskOption{
+			actions.WithAutoAssignTaskSkipRates(),
+			actions.WithAutoAssignTaskSkipWorkload(),
+			actions.WithAutoAssignTaskOptInTag("ai-assign"),
+		},
+	}, {
+		name: "it should skip a task not opted in by tag",
+		resources: &config.Resources{
+			TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", "example.com"),
+				twapi.WithHTTPClient(unexpectedTeamworkEngine()),
+			),
+			Agentic: agenticMock{
+				findTaskSkillsAndJobRoles: func(
+					context.Context,
+					[]*mcp.PromptMessage,
+				) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+					return nil, nil, "", fmt.Errorf("unexpected call to the agentic system")
+				},
+			},
+			Logger: slog.New(slog.DiscardHandler),
+		},
+		taskData: func() webhook.TaskData {
+			var taskData webhook.TaskData
+			taskData.Task.ID = 1
+			taskData.Task.Name = "task-1"
+			return taskData
+		}(),
+		options: []actions.AutoAssignTaskOption{
+			actions.WithAutoAssignTaskOptInTag("ai-assign"),
+		},
+	}, {
+		name: "it should skip a task opted out by a tasklist tag",
+		resources: &config.Resources{
+			TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", "example.com"),
+				twapi.WithHTTPClient(unexpectedTeamworkEngine()),
+			),
+			Agentic: agenticMock{
+				findTaskSkillsAndJobRoles: func(
+					context.Context,
+					[]*mcp.PromptMessage,
+				) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+					return nil, nil, "", fmt.Errorf("unexpected call to the agentic system")
+				},
+			},
+			Logger: slog.New(slog.DiscardHandler),
+		},
+		taskData: func() webhook.TaskData {
+			var taskData webhook.TaskData
+			taskData.Project.Tags = []webhook.Tag{{ID: 1, Name: "ai-assign"}}
+			taskData.Tasklist.Tags = []webhook.Tag{{ID: 2, Name: "no-ai"}}
+			taskData.Task.ID = 1
+			taskData.Task.Name = "task-1"
+			return taskData
+		}(),
+		options: []actions.AutoAssignTaskOption{
+			actions.WithAutoAssignTaskOptInTag("ai-assign"),
+			actions.WithAutoAssignTaskOptOutTag("no-ai"),
+		},
+	}, {
+		name: "it should skip a task when the monthly budget is exceeded",
+		resources: &config.Resources{
+			TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", "example.com"),
+				twapi.WithHTTPClient(unexpectedTeamworkEngine()),
+			),
+			Agentic: agenticMock{
+				findTaskSkillsAndJobRoles: func(
+					context.Context,
+					[]*mcp.PromptMessage,
+				) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+					return nil, nil, "", fmt.Errorf("unexpected call to the agentic system")
+				},
+			},
+			Logger: slog.New(slog.DiscardHandler),
+			Usage: func() *usage.Tracker {
+				tracker, err := usage.NewTracker(
+					usage.WithPrices(usage.Prices{"gpt-4o": {Input: 2.5, Output: 10}}),
+					usage.WithMonthlyBudget(1),
+				)
+				if err != nil {
+					t.Fatalf("failed to create usage tracker: %v", err)
+				}
+				tracker.Record(1, []agentic.Usage{{Model: "gpt-4o", InputTokens: 400_000}})
+				return tracker
+			}(),
+		},
+		taskData: func() webhook.TaskData {
+			var taskData webhook.TaskData
+			taskData.Task.ID = 1
+			taskData.Task.Name = "task-1"
+			return taskData
+		}(),
+	}, {
+		name: "it should assign a task dropping suggestions with low confidence",
+		resources: &config.Resources{
+			TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", "example.com"),
+				twapi.WithHTTPClient(teamworkEngine([]projects.User{
+					{ID: 1, FirstName: "James", LastName: "Smith"},
+					{ID: 2, FirstName: "Michael", LastName: "Williams"},
+				}, teamworkScenario{})),
+			),
+			Agentic: agenticMock{
+				findTaskSkillsAndJobRoles: func(
+					context.Context,
+					[]*mcp.PromptMessage,
+				) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+					return []agentic.Suggestion{
+						{ID: 1, Confidence: 0.9},
+						{ID: 2, Confidence: 0.2},
+					}, []agentic.Suggestion{}, "Some interesting explanation.", nil
+				},
+			},
+			Logger: slog.New(slog.DiscardHandler),
+		},
+		taskData: func() webhook.TaskData {
+			var taskData webhook.TaskData
+			taskData.Task.ID = 1
+			taskData.Task.Name = "task-1"
+			return taskData
+		}(),
+		options: []actions.AutoAssignTaskOption{
+			actions.WithAutoAssignTaskSkipRates(),
+			actions.WithAutoAssignTaskSkipWorkload(),
+			actions.WithAutoAssignTaskConfidenceThreshold(0.5, actions.LowConfidenceModeDrop),
+		},
+	}, {
+		name: "it should only comment a task with low confidence suggestions",
+		resources: &config.Resources{
+			TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", "example.com"),
+				twapi.WithHTTPClient(teamworkEngine([]projects.User{
+					{ID: 1, FirstName: "James", LastName: "Smith"},
+					{ID: 2, FirstName: "Michael", LastName: "Williams"},
+				}, teamworkScenario{suggestionOnly: true, lowConfidence: 35})),
+			),
+			Agentic: agenticMock{
+				findTaskSkillsAndJobRoles: func(
+					context.Context,
+					[]*mcp.PromptMessage,
+				) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+					return []agentic.Suggestion{
+						{ID: 1, Confidence: 0.35},
+					}, []agentic.Suggestion{}, "Some interesting explanation.", nil
+				},
+			},
+			Logger: slog.New(slog.DiscardHandler),
+		},
+		taskData: func() webhook.TaskData {
+			var taskData webhook.TaskData
+			taskData.Task.ID = 1
+			taskData.Task.Name = "task-1"
+			return taskData
+		}(),
+		options: []actions.AutoAssignTaskOption{
+			actions.WithAutoAssignTaskSkipRates(),
+			actions.WithAutoAssignTaskSkipWorkload(),
+			actions.WithAutoAssignTaskConfidenceThreshold(0.5, actions.LowConfidenceModeSuggest),
+		},
 	}}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// in-memory transports are not goroutine safe, so we need a new MCP mock
 			// per test case
-			tt.resources.MCPClient = config.NewMCPClient(mockMCP(t, func(srv *mcp.Server) {
-				srv.AddPrompt(&mcp.Prompt{
-					Name: "twprojects_task_skills_and_roles",
-					Arguments: []*mcp.PromptArgument{
-						{Name: "task_id", Required: true},
-					},
-				}, mcp.PromptHandler(func(context.Context, *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
-					return &mcp.GetPromptResult{
-						Messages: []*mcp.PromptMessage{
-							{
-								Role: "system",
-								Content: &mcp.TextContent{
-									Text: "You are an expert at identifying skills and job roles required for tasks based on their details.",
-								},
-							},
-							{
-								Role: "user",
-								Content: &mcp.TextContent{
-									Text: "Given the details of the task, identify the relevant skills and job roles required to complete it.",
-								},
-							},
-						},
-					}, nil
-				}))
-			}))
+			tt.resources.MCPClient = config.NewMCPClient(mockMCP(t, registerTaskSkillsAndRolesPrompt))
 
 			if err := actions.AutoAssignTask(
 				context.Background(),
@@ -168,25 +364,168 @@ func Test_AutoAssignTask(t *testing.T) {
 	}
 }
 
+// Benchmark_AutoAssignTask measures the time to load the MCP prompt and the
+// Teamwork resources of a task, where every request to the fake servers has a
+// fixed latency.
+func Benchmark_AutoAssignTask(b *testing.B) {
+	const latency = 5 * time.Millisecond
+
+	server := httptest.NewServer(fakeTeamworkServer(latency, 3))
+	b.Cleanup(server.Close)
+
+	for _, concurrency := range []int{1, 4} {
+		b.Run("concurrency="+strconv.Itoa(concurrency), func(b *testing.B) {
+			resources := &config.Resources{
+				TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", server.URL)),
+				Agentic: agenticMock{
+					findTaskSkillsAndJobRoles: func(
+						context.Context,
+						[]*mcp.PromptMessage,
+					) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+						return []agentic.Suggestion{{ID: 1, Confidence: 1}}, []agentic.Suggestion{}, "", nil
+					},
+				},
+				Logger: slog.New(slog.DiscardHandler),
+			}
+
+			var taskData webhook.TaskData
+			taskData.Project.ID = 1
+			taskData.Task.ID = 1
+
+			resources.MCPClient = config.NewMCPClient(mockMCP(b, func(srv *mcp.Server) {
+				registerTaskSkillsAndRolesPrompt(srv)
+				srv.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+					return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+						time.Sleep(latency)
+						return next(ctx, method, req)
+					}
+				})
+			}))
+
+			for b.Loop() {
+				if err := actions.AutoAssignTask(context.Background(), resources, taskData,
+					actions.WithAutoAssignTaskSkipRates(),
+					actions.WithAutoAssignTaskSkipWorkload(),
+					actions.WithAutoAssignTaskSkipDependencies(),
+					actions.WithAutoAssignTaskSkipAssignment(),
+					actions.WithAutoAssignTaskSkipComment(),
+					actions.WithAutoAssignTaskConcurrency(concurrency),
+				); err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// fakeTeamworkServer serves paginated skills, job roles and project users,
+// waiting the latency before answering each request.
+func fakeTeamworkServer(latency time.Duration, pages int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(latency)
+
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page == 0 {
+			page = 1
+		}
+		hasMore := page < pages
+
+		var entity any
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/skills.json"):
+			var response projects.SkillListResponse
+			response.Meta.Page.HasMore = hasMore
+			response.Skills = []projects.Skill{{
+				ID:    int64(page),
+				Name:  "skill-" + strconv.Itoa(page),
+				Users: []twapi.Relationship{{ID: 1, Type: "users"}},
+			}}
+			entity = response
+
+		case strings.HasSuffix(r.URL.Path, "/jobroles.json"):
+			var response projects.JobRoleListResponse
+			response.Meta.Page.HasMore = hasMore
+			response.JobRoles = []projects.JobRole{{
+				ID:    int64(page),
+				Name:  "jobrole-" + strconv.Itoa(page),
+				Users: []twapi.Relationship{{ID: 1, Type: "users"}},
+			}}
+			entity = response
+
+		case strings.HasSuffix(r.URL.Path, "/people.json"):
+			var response projects.UserListResponse
+			response.Meta.Page.HasMore = hasMore
+			response.Users = []projects.User{{ID: int64(page), FirstName: "James", LastName: "Smith"}}
+			entity = response
+
+		default:
+			http.Error(w, "unexpected path "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(entity); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
 type agenticMock struct {
 	findTaskSkillsAndJobRoles func(
 		context.Context,
 		[]*mcp.PromptMessage,
-	) ([]int64, []int64, string, error)
+	) ([]agentic.Suggestion, []agentic.Suggestion, string, error)
 }
 
 func (a agenticMock) Init(string, *slog.Logger) error {
 	return nil
 }
 
-func (a agenticMock) FindTaskSkillsAndJobRoles(
+// Complete answers with the skills and job roles returned by the mock
+// function, in the format expected by agentic.FindTaskSkillsAndJobRoles.
+func (a agenticMock) Complete(
 	ctx context.Context,
 	promptMessages []*mcp.PromptMessage,
-) ([]int64, []int64, string, error) {
-	return a.findTaskSkillsAndJobRoles(ctx, promptMessages)
+	_ *jsonschema.Schema,
+) (json.RawMessage, error) {
+	skills, jobRoles, reasoning, err := a.findTaskSkillsAndJobRoles(ctx, promptMessages)
+	if err != nil {
+		return nil, err
+	}
+	output := agentic.TaskSkillsAndJobRolesOutput{
+		SkillIDs:   []int64{},
+		JobRoleIDs: []int64{},
+		Reasoning:  reasoning,
+	}
+	for _, skill := range skills {
+		output.SkillIDs = append(output.SkillIDs, skill.ID)
+		output.SkillConfidences = append(output.SkillConfidences, agentic.Confidence{
+			ID:         skill.ID,
+			Confidence: skill.Confidence,
+		})
+	}
+	for _, jobRole := range jobRoles {
+		output.JobRoleIDs = append(output.JobRoleIDs, jobRole.ID)
+		output.JobRoleConfidences = append(output.JobRoleConfidences, agentic.Confidence{
+			ID:         jobRole.ID,
+			Confidence: jobRole.Confidence,
+		})
+	}
+	return json.Marshal(output)
+}
+
+type teamworkScenario struct {
+	useRate         bool
+	useWorkload     bool
+	useDependencies bool
+
+	// suggestionOnly indicates that the task must not be assigned, only
+	// commented. The lowConfidence is the percentage reported in the comment.
+	suggestionOnly bool
+	lowConfidence  int
 }
 
-func teamworkEngine(expectedAssignees []projects.User, useRate, useWorkload bool) twapi.HTTPClientFunc {
+func teamworkEngine(expectedAssignees []projects.User, scenario teamworkScenario) twapi.HTTPClientFunc {
 	return func(req *http.Request) (*http.Response, error) {
 		var entity any
 		status := http.StatusOK
@@ -278,12 +617,32 @@ func teamworkEngine(expectedAssignees []projects.User, useRate, useWorkload bool
 				},
 			}
 
+		case req.Method == http.MethodGet && req.URL.Path == "example.com/projects/api/v3/tasks/1.json":
+			task := projects.Task{ID: 1}
+			if scenario.useDependencies {
+				task.Predecessors = []twapi.Relationship{{ID: 2, Type: "tasks"}}
+			}
+			entity = projects.TaskGetResponse{Task: task}
+
+		case req.Method == http.MethodGet && req.URL.Path == "example.com/projects/api/v3/tasks/2.json":
+			entity = projects.TaskGetResponse{
+				Task: projects.Task{
+					ID: 2,
+					Assignees: []twapi.Relationship{
+						{ID: 1, Type: "users"},
+					},
+				},
+			}
+
 		case req.Method == http.MethodPut && strings.HasPrefix(req.URL.Path, "example.com/projects/api/v3/tasks/"):
 			id := strings.TrimPrefix(req.URL.Path, "example.com/projects/api/v3/tasks/")
 			id = strings.TrimSuffix(id, ".json")
 			if id != "1" {
 				return nil, fmt.Errorf("unexpected task ID: %s", id)
 			}
+			if scenario.suggestionOnly {
+				return nil, fmt.Errorf("unexpected task assignment")
+			}
 
 			var t struct {
 				Task projects.TaskUpdateRequest `json:"task"`
@@ -331,17 +690,27 @@ func teamworkEngine(expectedAssignees []projects.User, useRate, useWorkload bool
 			}
 
 			var expectedBody strings.Builder
-			expectedBody.WriteString("🤖 Assignment of this task was performed by artificial intelligence.\n")
+			if scenario.suggestionOnly {
+				fmt.Fprintf(&expectedBody, "🤖 Artificial intelligence suggests the following users for this task. "+
+					"The task was not assigned because the confidence of the suggestion is low (%d%%).\n",
+					scenario.lowConfidence)
+			} else {
+				expectedBody.WriteString("🤖 Assignment of this task was performed by artificial intelligence.\n")
+			}
 			for _, user := range expectedAssignees {
 				fmt.Fprintf(&expectedBody, "\n  • %s %s", user.FirstName, user.LastName)
 			}
 			expectedBody.WriteString("\n\nSome interesting explanation.")
-			if useRate {
+			if scenario.useRate {
 				expectedBody.WriteString(" Concerns over user cost significantly impacted the decision.")
 			}
-			if useWorkload {
+			if scenario.useWorkload {
 				expectedBody.WriteString(" Workload was a key consideration in the decision-making process.")
 			}
+			if scenario.useDependencies {
+				expectedBody.WriteString(" Users already working on related tasks (predecessors or parent task) were " +
+					"favored to keep the context.")
+			}
 			if t.Comment.Body != expectedBody.String() {
 				return nil, fmt.Errorf("unexpected comment body: %s", t.Comment.Body)
 			}
@@ -372,7 +741,39 @@ func teamworkEngine(expectedAssignees []projects.User, useRate, useWorkload bool
 	}
 }
 
-func mockMCP(t *testing.T, register func(*mcp.Server)) mcp.Transport {
+func registerTaskSkillsAndRolesPrompt(srv *mcp.Server) {
+	srv.AddPrompt(&mcp.Prompt{
+		Name: "twprojects_task_skills_and_roles",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "task_id", Required: true},
+		},
+	}, mcp.PromptHandler(func(context.Context, *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		return &mcp.GetPromptResult{
+			Messages: []*mcp.PromptMessage{
+				{
+					Role: "system",
+					Content: &mcp.TextContent{
+						Text: "You are an expert at identifying skills and job roles required for tasks based on their details.",
+					},
+				},
+				{
+					Role: "user",
+					Content: &mcp.TextContent{
+						Text: "Given the details of the task, identify the relevant skills and job roles required to complete it.",
+					},
+				},
+			},
+		}, nil
+	}))
+}
+
+func unexpectedTeamworkEngine() twapi.HTTPClientFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		return nil, fmt.Errorf("unexpected method %q and URL path: %q", req.Method, req.URL.Path)
+	}
+}
+
+func mockMCP(t testing.TB, register func(*mcp.Server)) mcp.Transport {
 	clientTransport, serverTransport := mcp.NewInMemoryTransports()
 
 	server := mcp.NewServer(&mcp.Implementation{
@@ -394,3 +795,501 @@ func mockMCP(t *testing.T, register func(*mcp.Server)) mcp.Transport {
 
 	return clientTransport
 }
+
+func Test_ReviewTaskSuggestion(t *testing.T) {
+	tests := []struct {
+		name              string
+		reply             string
+		replyUserID       int64
+		storedUserID      int64
+		approverIDs       []int64
+		expectedAssignees []int64
+		expectedComment   string
+	}{{
+		name:              "it should assign the top ranked users when approved",
+		reply:             "<p>Approve</p>",
+		replyUserID:       10,
+		approverIDs:       []int64{10},
+		expectedAssignees: []int64{1, 2},
+		expectedComment:   "🤖 Task assigned to James Smith, Michael Williams as approved by John Doe.",
+	}, {
+		name:              "it should assign a specific candidate when approved",
+		reply:             "approve 2",
+		replyUserID:       10,
+		approverIDs:       []int64{10},
+		expectedAssignees: []int64{2},
+		expectedComment:   "🤖 Task assigned to Michael Williams as approved by John Doe.",
+	}, {
+		name:            "it should discard the suggestion when rejected",
+		reply:           "reject",
+		replyUserID:     10,
+		approverIDs:     []int64{10},
+		expectedComment: "🤖 Suggestion rejected by John Doe and discarded.",
+	}, {
+		name:        "it should ignore decisions from unauthorized users",
+		reply:       "approve",
+		replyUserID: 20,
+		approverIDs: []int64{10},
+	}, {
+		name:         "it should ignore decisions with a forged author",
+		reply:        "approve",
+		replyUserID:  10,
+		storedUserID: 20,
+		approverIDs:  []int64{10},
+	}, {
+		name:        "it should ignore decisions when there are no approvers",
+		reply:       "approve",
+		replyUserID: 10,
+	}, {
+		name:        "it should ignore comments that are not decisions",
+		reply:       "I approve this message",
+		replyUserID: 10,
+		approverIDs: []int64{10},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var recorder teamworkRecorder
+			resources := &config.Resources{
+				TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", "example.com"),
+					twapi.WithHTTPClient(recordingTeamworkEngine(&recorder)),
+				),
+				Agentic: agenticMock{
+					findTaskSkillsAndJobRoles: func(
+						context.Context,
+						[]*mcp.PromptMessage,
+					) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+						return []agentic.Suggestion{{ID: 1, Confidence: 1}}, []agentic.Suggestion{},
+							"Some interesting explanation.", nil
+					},
+				},
+				Logger:    slog.New(slog.DiscardHandler),
+				MCPClient: config.NewMCPClient(mockMCP(t, registerTaskSkillsAndRolesPrompt)),
+			}
+
+			var taskData webhook.TaskData
+			taskData.Task.ID = 1
+			taskData.Task.Name = "task-1"
+			if err := actions.AutoAssignTask(context.Background(), resources, taskData,
+				actions.WithAutoAssignTaskSkipRates(),
+				actions.WithAutoAssignTaskSkipWorkload(),
+				actions.WithAutoAssignTaskApproval(time.Hour),
+			); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(recorder.assignees) > 0 {
+				t.Fatalf("unexpected assignment before approval: %v", recorder.assignees)
+			}
+			expectedSuggestion := "🤖 Artificial intelligence suggests the following users for this task.\n" +
+				"\n  1. James Smith\n  2. Michael Williams\n\nSome interesting explanation.\n\n" +
+				"Reply with \"approve\" to assign the top ranked users, \"approve <number>\" to assign a specific " +
+				"user or \"reject\" to discard the suggestion. The suggestion expires in 1h0m0s."
+			if len(recorder.comments) != 1 || recorder.comments[0] != expectedSuggestion {
+				t.Fatalf("unexpected suggestion comments: %q", recorder.comments)
+			}
+
+			var commentData webhook.CommentData
+			commentData.EventCreator.ID = tt.replyUserID
+			commentData.EventCreator.FirstName = "John"
+			commentData.EventCreator.LastName = "Doe"
+			commentData.Comment.ID = 100
+			commentData.Comment.Body = tt.reply
+			commentData.Comment.ObjectID = 1
+			commentData.Comment.ObjectType = "task"
+			storedUserID := tt.replyUserID
+			if tt.storedUserID != 0 {
+				storedUserID = tt.storedUserID
+			}
+			recorder.storedComment = projects.Comment{
+				ID:       100,
+				Body:     tt.reply,
+				Object:   &twapi.Relationship{ID: 1, Type: "tasks"},
+				PostedBy: &storedUserID,
+			}
+			t.Cleanup(func() {
+				// discard the suggestion when the decision was ignored, so the next
+				// test can suggest users for the same task
+				commentData.EventCreator.ID = 10
+				commentData.Comment.Body = "reject"
+				recorder.storedComment.Body = "reject"
+				recorder.storedComment.PostedBy = new(int64(10))
+				_ = actions.ReviewTaskSuggestion(context.Background(), resources, commentData,
+					actions.WithReviewTaskSuggestionApprovers(10),
+				)
+			})
+
+			var report actions.AutoAssignTaskReport
+			if err := actions.AutoAssignTask(context.Background(), resources, taskData,
+				actions.WithAutoAssignTaskSkipRates(),
+				actions.WithAutoAssignTaskSkipWorkload(),
+				actions.WithAutoAssignTaskApproval(time.Hour),
+				actions.WithAutoAssignTaskReport(&report),
+			); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if report.Status != actions.AutoAssignTaskStatusSkipped || len(recorder.comments) != 1 {
+				t.Fatalf("expected the task with a pending suggestion to be skipped, got %+v", report)
+			}
+
+			if err := actions.ReviewTaskSuggestion(context.Background(), resources, commentData,
+				actions.WithReviewTaskSuggestionApprovers(tt.approverIDs...),
+			); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			switch {
+			case tt.expectedAssignees == nil && len(recorder.assignees) > 0:
+				t.Errorf("unexpected assignment: %v", recorder.assignees)
+			case tt.expectedAssignees != nil &&
+				(len(recorder.assignees) != 1 || !slices.Equal(recorder.assignees[0], tt.expectedAssignees)):
+				t.Errorf("unexpected assignees: %v", recorder.assignees)
+			}
+			switch {
+			case tt.expectedComment == "" && len(recorder.comments) > 1:
+				t.Errorf("unexpected comments: %q", recorder.comments[1:])
+			case tt.expectedComment != "" && (len(recorder.comments) != 2 || recorder.comments[1] != tt.expectedComment):
+				t.Errorf("unexpected comments: %q", recorder.comments)
+			}
+		})
+	}
+}
+
+type teamworkRecorder struct {
+	assignees     [][]int64
+	comments      []string
+	storedComment projects.Comment
+}
+
+// recordingTeamworkEngine records the task assignments and comments, answers
+// with the stored comment, and delegates any other request to the default
+// Teamwork engine mock.
+func recordingTeamworkEngine(recorder *teamworkRecorder) twapi.HTTPClientFunc {
+	next := teamworkEngine(nil, teamworkScenario{})
+	return func(req *http.Request) (*http.Response, error) {
+		var entity any
+		status := http.StatusOK
+
+		switch {
+		case req.Method == http.MethodPut && strings.HasPrefix(req.URL.Path, "example.com/projects/api/v3/tasks/"):
+			var t struct {
+				Task projects.TaskUpdateRequest `json:"task"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&t); err != nil {
+				return nil, fmt.Errorf("failed to decode task update request: %w", err)
+			}
+			if t.Task.Assignees == nil {
+				return nil, fmt.Errorf("expected assignees but none were provided")
+			}
+			recorder.assignees = append(recorder.assignees, t.Task.Assignees.UserIDs)
+			entity = projects.TaskUpdateResponse{Task: projects.Task{ID: 1}}
+
+		case req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, "example.com/projects/api/v3/comments/"):
+			entity = projects.CommentGetResponse{Comment: recorder.storedComment}
+
+		case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/comments.json"):
+			var t struct {
+				Comment projects.CommentCreateRequest `json:"comment"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&t); err != nil {
+				return nil, fmt.Errorf("failed to decode comment create request: %w", err)
+			}
+			recorder.comments = append(recorder.comments, t.Comment.Body)
+			status = http.StatusCreated
+			entity = projects.CommentCreateResponse{ID: 1}
+
+		default:
+			return next(req)
+		}
+
+		encoded, err := json.Marshal(entity)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(strings.NewReader(string(encoded))),
+			Header:     make(http.Header),
+		}, nil
+	}
+}
+
+func Test_AssignBacklog(t *testing.T) {
+	dueAfter := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	dueBefore := time.Date(2025, 5, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name              string
+		filters           actions.AssignBacklogFilters
+		options           []actions.AssignBacklogOption
+		expectedSummary   *actions.AssignBacklogSummary
+		expectedAssignees [][]int64
+		expectedComments  int
+		expectedError     string
+	}{{
+		name:    "it should only propose the assignees in dry-run",
+		filters: actions.AssignBacklogFilters{ProjectID: 1},
+		options: []actions.AssignBacklogOption{actions.WithAssignBacklogDryRun()},
+		expectedSummary: &actions.AssignBacklogSummary{
+			DryRun:    true,
+			Suggested: 2,
+			Tasks: []actions.AssignBacklogTask{
+				backlogTaskReport(1, "task-1", actions.AutoAssignTaskStatusSuggested),
+				backlogTaskReport(5, "task-5", actions.AutoAssignTaskStatusSuggested),
+			},
+		},
+	}, {
+		name:    "it should assign the unassigned open tasks",
+		filters: actions.AssignBacklogFilters{ProjectID: 1},
+		expectedSummary: &actions.AssignBacklogSummary{
+			Assigned: 2,
+			Tasks: []actions.AssignBacklogTask{
+				backlogTaskReport(1, "task-1", actions.AutoAssignTaskStatusAssigned),
+				backlogTaskReport(5, "task-5", actions.AutoAssignTaskStatusAssigned),
+			},
+		},
+		expectedAssignees: [][]int64{{1, 2}, {1, 2}},
+		expectedComments:  2,
+	}, {
+		name:    "it should filter the tasks by tag",
+		filters: actions.AssignBacklogFilters{ProjectID: 1, Tag: "Imported"},
+		options: []actions.AssignBacklogOption{actions.WithAssignBacklogDryRun()},
+		expectedSummary: &actions.AssignBacklogSummary{
+			DryRun:    true,
+			Suggested: 1,
+			Tasks: []actions.AssignBacklogTask{
+				backlogTaskReport(1, "task-1", actions.AutoAssignTaskStatusSuggested),
+			},
+		},
+	}, {
+		name:    "it should filter the tasks by due range",
+		filters: actions.AssignBacklogFilters{ProjectID: 1, DueAfter: &dueAfter, DueBefore: &dueBefore},
+		options: []actions.AssignBacklogOption{actions.WithAssignBacklogDryRun()},
+		expectedSummary: &actions.AssignBacklogSummary{
+			DryRun:    true,
+			Suggested: 1,
+			Tasks: []actions.AssignBacklogTask{
+				backlogTaskReport(1, "task-1", actions.AutoAssignTaskStatusSuggested),
+			},
+		},
+	}, {
+		name:    "it should only assign the tasks with the opt-in tag",
+		filters: actions.AssignBacklogFilters{ProjectID: 1},
+		options: []actions.AssignBacklogOption{
+			actions.WithAssignBacklogDryRun(),
+			actions.WithAssignBacklogAutoAssignTaskOptions(actions.WithAutoAssignTaskOptInTag("imported")),
+		},
+		expectedSummary: &actions.AssignBacklogSummary{
+			DryRun:    true,
+			Suggested: 1,
+			Skipped:   1,
+			Tasks: []actions.AssignBacklogTask{
+				backlogTaskReport(1, "task-1", actions.AutoAssignTaskStatusSuggested),
+				backlogSkippedTaskReport(5, "task-5", "task not opted in by tag"),
+			},
+		},
+	}, {
+		name:    "it should accept the opt-in tag of the project",
+		filters: actions.AssignBacklogFilters{ProjectID: 1},
+		options: []actions.AssignBacklogOption{
+			actions.WithAssignBacklogDryRun(),
+			actions.WithAssignBacklogAutoAssignTaskOptions(actions.WithAutoAssignTaskOptInTag("Managed")),
+		},
+		expectedSummary: &actions.AssignBacklogSummary{
+			DryRun:    true,
+			Suggested: 2,
+			Tasks: []actions.AssignBacklogTask{
+				backlogTaskReport(1, "task-1", actions.AutoAssignTaskStatusSuggested),
+				backlogTaskReport(5, "task-5", actions.AutoAssignTaskStatusSuggested),
+			},
+		},
+	}, {
+		name:    "it should skip the tasks with the opt-out tag",
+		filters: actions.AssignBacklogFilters{ProjectID: 1},
+		options: []actions.AssignBacklogOption{
+			actions.WithAssignBacklogDryRun(),
+			actions.WithAssignBacklogAutoAssignTaskOptions(actions.WithAutoAssignTaskOptOutTag("Imported")),
+		},
+		expectedSummary: &actions.AssignBacklogSummary{
+			DryRun:    true,
+			Suggested: 1,
+			Skipped:   1,
+			Tasks: []actions.AssignBacklogTask{
+				backlogSkippedTaskReport(1, "task-1", "task opted out by tag"),
+				backlogTaskReport(5, "task-5", actions.AutoAssignTaskStatusSuggested),
+			},
+		},
+	}, {
+		name:    "it should skip the tasks with the opt-out tag in the tasklist",
+		filters: actions.AssignBacklogFilters{ProjectID: 1},
+		options: []actions.AssignBacklogOption{
+			actions.WithAssignBacklogDryRun(),
+			actions.WithAssignBacklogAutoAssignTaskOptions(actions.WithAutoAssignTaskOptOutTag("Paused")),
+		},
+		expectedSummary: &actions.AssignBacklogSummary{
+			DryRun:    true,
+			Suggested: 1,
+			Skipped:   1,
+			Tasks: []actions.AssignBacklogTask{
+				backlogTaskReport(1, "task-1", actions.AutoAssignTaskStatusSuggested),
+				backlogSkippedTaskReport(5, "task-5", "task opted out by tag"),
+			},
+		},
+	}, {
+		name:          "it should fail when the tag doesn't exist",
+		filters:       actions.AssignBacklogFilters{ProjectID: 1, Tag: "unknown"},
+		expectedError: `tag "unknown" not found`,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var recorder teamworkRecorder
+			resources := &config.Resources{
+				TeamworkEngine: twapi.NewEngine(session.NewBasicAuth("john", "abc123", "example.com"),
+					twapi.WithHTTPClient(backlogTeamworkEngine(recordingTeamworkEngine(&recorder))),
+				),
+				Agentic: agenticMock{
+					findTaskSkillsAndJobRoles: func(
+						context.Context,
+						[]*mcp.PromptMessage,
+					) ([]agentic.Suggestion, []agentic.Suggestion, string, error) {
+						return []agentic.Suggestion{{ID: 1, Confidence: 1}}, []agentic.Suggestion{},
+							"Some interesting explanation.", nil
+					},
+				},
+				Logger:    slog.New(slog.DiscardHandler),
+				MCPClient: config.NewMCPClient(mockMCP(t, registerTaskSkillsAndRolesPrompt)),
+			}
+
+			options := append([]actions.AssignBacklogOption{
+				// the recorder is not safe for concurrent use
+				actions.WithAssignBacklogWorkers(1),
+				actions.WithAssignBacklogAutoAssignTaskOptions(
+					actions.WithAutoAssignTaskSkipRates(),
+					actions.WithAutoAssignTaskSkipWorkload(),
+					actions.WithAutoAssignTaskSkipDependencies(),
+				),
+			}, tt.options...)
+
+			summary, err := actions.AssignBacklog(context.Background(), resources, tt.filters, options...)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(summary, tt.expectedSummary) {
+				t.Errorf("unexpected summary:\n%+v\nexpected:\n%+v", summary, tt.expectedSummary)
+			}
+			if !reflect.DeepEqual(recorder.assignees, tt.expectedAssignees) {
+				t.Errorf("unexpected assignees %v, expected %v", recorder.assignees, tt.expectedAssignees)
+			}
+			if len(recorder.comments) != tt.expectedComments {
+				t.Errorf("unexpected comments %q, expected %d", recorder.comments, tt.expectedComments)
+			}
+		})
+	}
+}
+
+func backlogTaskReport(id int64, name string, status actions.AutoAssignTaskStatus) actions.AssignBacklogTask {
+	return actions.AssignBacklogTask{
+		AutoAssignTaskReport: actions.AutoAssignTaskReport{
+			Status:    status,
+			UserIDs:   []int64{1, 2},
+			UserNames: []string{"James Smith", "Michael Williams"},
+			Reasoning: "Some interesting explanation.",
+		},
+		ID:   id,
+		Name: name,
+	}
+}
+
+func backlogSkippedTaskReport(id int64, name, reason string) actions.AssignBacklogTask {
+	return actions.AssignBacklogTask{
+		AutoAssignTaskReport: actions.AutoAssignTaskReport{
+			Status: actions.AutoAssignTaskStatusSkipped,
+			Reason: reason,
+		},
+		ID:   id,
+		Name: name,
+	}
+}
+
+// backlogTeamworkEngine lists the tasks, tasklists and tags of project 1,
+// delegating any other request to the next Teamwork engine mock.
+func backlogTeamworkEngine(next twapi.HTTPClientFunc) twapi.HTTPClientFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		var entity any
+
+		switch {
+		case req.Method == http.MethodGet && req.URL.Path == "example.com/projects/api/v3/tags.json":
+			var response projects.TagListResponse
+			if strings.EqualFold(req.URL.Query().Get("searchTerm"), "imported") {
+				response.Tags = []projects.Tag{{ID: 10, Name: "Imported"}}
+			}
+			entity = response
+
+		case req.Method == http.MethodGet && req.URL.Path == "example.com/projects/api/v3/projects/1.json":
+			entity = projects.ProjectGetResponse{
+				Project: projects.Project{ID: 1, Tags: []twapi.Relationship{{ID: 20, Type: "tags"}}},
+			}
+
+		case req.Method == http.MethodGet && req.URL.Path == "example.com/projects/api/v3/tasklists/100.json":
+			entity = map[string]any{"tasklist": map[string]any{"id": 100}}
+
+		case req.Method == http.MethodGet && req.URL.Path == "example.com/projects/api/v3/tasklists/200.json":
+			entity = map[string]any{"tasklist": map[string]any{"id": 200, "tags": []twapi.Relationship{{ID: 30, Type: "tags"}}}}
+
+		case req.Method == http.MethodGet && req.URL.Path == "example.com/projects/api/v3/tags/10.json":
+			entity = projects.TagGetResponse{Tag: projects.Tag{ID: 10, Name: "Imported"}}
+
+		case req.Method == http.MethodGet && req.URL.Path == "example.com/projects/api/v3/tags/20.json":
+			entity = projects.TagGetResponse{Tag: projects.Tag{ID: 20, Name: "Managed"}}
+
+		case req.Method == http.MethodGet && req.URL.Path == "example.com/projects/api/v3/tags/30.json":
+			entity = projects.TagGetResponse{Tag: projects.Tag{ID: 30, Name: "Paused"}}
+
+		case req.Method == http.MethodGet && req.URL.Path == "example.com/projects/api/v3/projects/1/tasks.json":
+			dueAt := twapi.Date(time.Date(2025, 5, 10, 0, 0, 0, 0, time.UTC))
+			lateDueAt := twapi.Date(time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC))
+			tasks := []projects.Task{
+				{
+					ID: 1, Name: "task-1", Status: "new", DueAt: &dueAt,
+					Tasklist: twapi.Relationship{ID: 100, Type: "tasklists"},
+					Tags:     []twapi.Relationship{{ID: 10, Type: "tags"}},
+				},
+				{ID: 2, Name: "task-2", Status: "new", Assignees: []twapi.Relationship{{ID: 1, Type: "users"}}},
+				{ID: 3, Name: "task-3", Status: "completed"},
+				{
+					ID: 5, Name: "task-5", Status: "reopened", DueAt: &lateDueAt,
+					Tasklist: twapi.Relationship{ID: 200, Type: "tasklists"},
+				},
+			}
+			if req.URL.Query().Get("tagIds") == "10" {
+				tasks = tasks[:1]
+			}
+			entity = projects.TaskListResponse{Tasks: tasks}
+
+		case req.Method == http.MethodGet && req.URL.Path == "example.com/projects/api/v3/projects/1/people.json":
+			// the default mock serves the same users for any project
+			req.URL.Path = "example.com/projects/api/v3/people.json"
+			return next(req)
+
+		default:
+			return next(req)
+		}
+
+		encoded, err := json.Marshal(entity)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(string(encoded))),
+			Header:     make(http.Header),
+		}, nil
+	}
+}
@@ -0,0 +1,457 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rafaeljusto/teamwork-ai/internal/config"
+	"github.com/rafaeljusto/teamwork-ai/internal/webhook"
+	twapi "github.com/teamwork/twapi-go-sdk"
+	"github.com/teamwork/twapi-go-sdk/projects"
+)
+
+// defaultBacklogWorkers is the default number of tasks analyzed at the same
+// time by the AssignBacklog function.
+const defaultBacklogWorkers = 2
+
+// AssignBacklogFilters selects the tasks analyzed by the AssignBacklog
+// function. Only open tasks without assignees are considered.
+type AssignBacklogFilters struct {
+	// ProjectID is the project of the tasks. It is required, as the users of
+	// the project are the candidates.
+	ProjectID int64 `json:"projectId"`
+
+	// TasklistID restricts the tasks to a tasklist of the project.
+	TasklistID int64 `json:"tasklistId,omitempty"`
+
+	// Tag restricts the tasks to the ones with a tag with this name. The
+	// comparison is case-insensitive.
+	Tag string `json:"tag,omitempty"`
+
+	// DueAfter restricts the tasks to the ones due on or after this date.
+	DueAfter *time.Time `json:"dueAfter,omitempty"`
+
+	// DueBefore restricts the tasks to the ones due on or before this date.
+	DueBefore *time.Time `json:"dueBefore,omitempty"`
+}
+
+// AssignBacklogOptions contains the options for the AssignBacklog function.
+type AssignBacklogOptions struct {
+	workers           int
+	dryRun            bool
+	autoAssignOptions []AutoAssignTaskOption
+}
+
+// AssignBacklogOption is a function that sets an option for the AssignBacklog
+// function.
+type AssignBacklogOption func(*AssignBacklogOptions)
+
+// WithAssignBacklogWorkers sets the number of tasks analyzed at the same time.
+// By default 2 tasks are analyzed at the same time.
+func WithAssignBacklogWorkers(workers int) AssignBacklogOption {
+	return func(o *AssignBacklogOptions) {
+		o.workers = workers
+	}
+}
+
+// WithAssignBacklogDryRun only proposes the users for each task, without
+// assigning or commenting.
+func WithAssignBacklogDryRun() AssignBacklogOption {
+	return func(o *AssignBacklogOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithAssignBacklogAutoAssignTaskOptions sets the options used when analyzing
+// each task.
+func WithAssignBacklogAutoAssignTaskOptions(options ...AutoAssignTaskOption) AssignBacklogOption {
+	return func(o *AssignBacklogOptions) {
+		o.autoAssignOptions = append(o.autoAssignOptions, options...)
+	}
+}
+
+// AssignBacklogSummary is the report of the AssignBacklog function.
+type AssignBacklogSummary struct {
+	// DryRun informs if the tasks were only analyzed.
+	DryRun bool `json:"dryRun"`
+
+	// Assigned is the number of assigned tasks.
+	Assigned int `json:"assigned"`
+
+	// Suggested is the number of tasks with proposed users that were not
+	// assigned.
+	Suggested int `json:"suggested"`
+
+	// Skipped is the number of tasks without proposed users.
+	Skipped int `json:"skipped"`
+
+	// Failed is the number of tasks that couldn't be analyzed.
+	Failed int `json:"failed"`
+
+	// Tasks is the report of each task, in the order they were listed.
+	Tasks []AssignBacklogTask `json:"tasks"`
+}
+
+// AssignBacklogTask is the report of a single task in the backlog.
+type AssignBacklogTask struct {
+	AutoAssignTaskReport
+
+	// ID is the identifier of the task.
+	ID int64 `json:"id"`
+
+	// Name is the name of the task.
+	Name string `json:"name"`
+
+	// Error is the reason of the failure, when the task couldn't be analyzed.
+	Error string `json:"error,omitempty"`
+}
+
+// AssignBacklog runs the AutoAssignTask function for all open tasks without
+// assignees that match the filters. Tasks that fail don't interrupt the
+// others; the failures are listed in the summary.
+func AssignBacklog(
+	ctx context.Context,
+	resources *config.Resources,
+	filters AssignBacklogFilters,
+	optFuncs ...AssignBacklogOption,
+) (*AssignBacklogSummary, error) {
+	options := AssignBacklogOptions{
+		workers: defaultBacklogWorkers,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&options)
+	}
+
+	logger := resources.Logger.With(
+		slog.String("action", "assignBacklog"),
+		slog.Int64("projectID", filters.ProjectID),
+	)
+
+	if filters.ProjectID == 0 {
+		return nil, fmt.Errorf("missing project")
+	}
+
+	tasks, err := loadBacklogTasks(ctx, resources, filters)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("backlog loaded",
+		slog.Int("tasks", len(tasks)),
+		slog.Bool("dryRun", options.dryRun),
+	)
+
+	// the listed tasks only have the IDs of their tags, and not the tags of
+	// the project and tasklists, so they are loaded when the opt-in or opt-out
+	// tags are checked
+	var autoAssignOptions AutoAssignTaskOptions
+	for _, optFunc := range options.autoAssignOptions {
+		optFunc(&autoAssignOptions)
+	}
+	var tags backlogTags
+	if autoAssignOptions.optInTag != "" || autoAssignOptions.optOutTag != "" {
+		if tags, err = loadBacklogTags(ctx, resources, filters.ProjectID, tasks); err != nil {
+			return nil, err
+		}
+	}
+
+	summary := &AssignBacklogSummary{
+		DryRun: options.dryRun,
+		Tasks:  make([]AssignBacklogTask, len(tasks)),
+	}
+
+	var wg sync.WaitGroup
+	limiter := newLimiter(max(options.workers, 1))
+	for i, task := range tasks {
+		if err := limiter.acquire(ctx); err != nil {
+			wg.Wait()
+			return nil, err
+		}
+		wg.Go(func() {
+			defer limiter.release()
+
+			result := AssignBacklogTask{
+				ID:   task.ID,
+				Name: task.Name,
+			}
+			autoAssignOptions := slices.Concat(options.autoAssignOptions, []AutoAssignTaskOption{
+				WithAutoAssignTaskReport(&result.AutoAssignTaskReport),
+			})
+			if options.dryRun {
+				autoAssignOptions = append(autoAssignOptions, WithAutoAssignTaskDryRun())
+			}
+			taskData := backlogTaskData(filters.ProjectID, task, tags)
+			if err := AutoAssignTask(ctx, resources, taskData, autoAssignOptions...); err != nil {
+				logger.Error("failed to assign backlog task",
+					slog.Int64("taskID", task.ID),
+					slog.String("error", err.Error()),
+				)
+				result.Error = err.Error()
+			}
+			summary.Tasks[i] = result
+		})
+	}
+	wg.Wait()
+
+	for _, task := range summary.Tasks {
+		switch {
+		case task.Error != "":
+			summary.Failed++
+		case task.Status == AutoAssignTaskStatusAssigned:
+			summary.Assigned++
+		case task.Status == AutoAssignTaskStatusSuggested:
+			summary.Suggested++
+		default:
+			summary.Skipped++
+		}
+	}
+	return summary, nil
+}
+
+// loadBacklogTasks lists the open tasks without assignees matching the
+// filters. The Teamwork API doesn't filter by assignees, status or due range,
+// so those filters are applied after listing.
+func loadBacklogTasks(
+	ctx context.Context,
+	resources *config.Resources,
+	filters AssignBacklogFilters,
+) ([]projects.Task, error) {
+	taskListRequest := projects.NewTaskListRequest()
+	taskListRequest.Path.ProjectID = filters.ProjectID
+	taskListRequest.Path.TasklistID = filters.TasklistID
+
+	if filters.Tag != "" {
+		tag, err := findTag(ctx, resources, filters.Tag)
+		if err != nil {
+			return nil, err
+		}
+		taskListRequest.Filters.TagIDs = []int64{tag.ID}
+	}
+
+	tasks, err := iterateAll(ctx, resources, nil, taskListRequest,
+		func(taskListResponse *projects.TaskListResponse) []projects.Task {
+			return taskListResponse.Tasks
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tasks: %w", err)
+	}
+
+	return slices.DeleteFunc(tasks, func(task projects.Task) bool {
+		if len(task.Assignees) > 0 || task.Status == "completed" || task.Status == "deleted" {
+			return true
+		}
+		if filters.DueAfter == nil && filters.DueBefore == nil {
+			return false
+		}
+		if task.DueAt == nil {
+			return true
+		}
+		dueAt := time.Time(*task.DueAt)
+		return (filters.DueAfter != nil && dueAt.Before(*filters.DueAfter)) ||
+			(filters.DueBefore != nil && dueAt.After(*filters.DueBefore))
+	}), nil
+}
+
+// findTag finds the tag with the given name.
+func findTag(ctx context.Context, resources *config.Resources, name string) (projects.Tag, error) {
+	tagListRequest := projects.NewTagListRequest()
+	tagListRequest.Filters.SearchTerm = name
+
+	tags, err := iterateAll(ctx, resources, nil, tagListRequest,
+		func(tagListResponse *projects.TagListResponse) []projects.Tag {
+			return tagListResponse.Tags
+		},
+	)
+	if err != nil {
+		return projects.Tag{}, fmt.Errorf("failed to load tags: %w", err)
+	}
+	for _, tag := range tags {
+		if strings.EqualFold(strings.TrimSpace(tag.Name), strings.TrimSpace(name)) {
+			return tag, nil
+		}
+	}
+	return projects.Tag{}, fmt.Errorf("tag %q not found", name)
+}
+
+// backlogTags are the tags of the project and of the tasklists, and the names
+// of the tags of the backlog tasks.
+type backlogTags struct {
+	project   []webhook.Tag
+	tasklists map[int64][]webhook.Tag
+	names     map[int64]string
+}
+
+// loadBacklogTags loads the tags of the project and of the tasklists, and the
+// names of all tags used by the project, the tasklists and the tasks.
+func loadBacklogTags(
+	ctx context.Context,
+	resources *config.Resources,
+	projectID int64,
+	tasks []projects.Task,
+) (backlogTags, error) {
+	var tasklistIDs []int64
+	for _, task := range tasks {
+		if task.Tasklist.ID != 0 {
+			tasklistIDs = append(tasklistIDs, task.Tasklist.ID)
+		}
+	}
+	slices.Sort(tasklistIDs)
+	tasklistIDs = slices.Compact(tasklistIDs)
+
+	var mutex sync.Mutex
+	var projectTagIDs []twapi.Relationship
+	tasklistTagIDs := make(map[int64][]twapi.Relationship, len(tasklistIDs))
+	limiter := newLimiter(defaultConcurrency)
+	loaders := make([]func(context.Context) error, 0, len(tasklistIDs)+1)
+	loaders = append(loaders, func(ctx context.Context) error {
+		if err := limiter.acquire(ctx); err != nil {
+			return err
+		}
+		defer limiter.release()
+
+		projectResponse, err := projects.ProjectGet(ctx, resources.TeamworkEngine, projects.NewProjectGetRequest(projectID))
+		if err != nil {
+			return fmt.Errorf("failed to load project: %w", err)
+		}
+		projectTagIDs = projectResponse.Project.Tags
+		return nil
+	})
+	for _, tasklistID := range tasklistIDs {
+		loaders = append(loaders, func(ctx context.Context) error {
+			if err := limiter.acquire(ctx); err != nil {
+				return err
+			}
+			defer limiter.release()
+
+			tasklistResponse, err := twapi.Execute[tasklistGetRequest, *tasklistGetResponse](
+				ctx, resources.TeamworkEngine, tasklistGetRequest{id: tasklistID},
+			)
+			if err != nil {
+				return fmt.Errorf("failed to load tasklist %d: %w", tasklistID, err)
+			}
+			mutex.Lock()
+			tasklistTagIDs[tasklistID] = tasklistResponse.Tasklist.Tags
+			mutex.Unlock()
+			return nil
+		})
+	}
+	if err := runConcurrently(ctx, loaders...); err != nil {
+		return backlogTags{}, err
+	}
+
+	var tagIDs []int64
+	for _, tag := range projectTagIDs {
+		tagIDs = append(tagIDs, tag.ID)
+	}
+	for _, tags := range tasklistTagIDs {
+		for _, tag := range tags {
+			tagIDs = append(tagIDs, tag.ID)
+		}
+	}
+	for _, task := range tasks {
+		for _, tag := range task.Tags {
+			tagIDs = append(tagIDs, tag.ID)
+		}
+	}
+	slices.Sort(tagIDs)
+	tagIDs = slices.Compact(tagIDs)
+
+	names := make(map[int64]string, len(tagIDs))
+	loaders = make([]func(context.Context) error, 0, len(tagIDs))
+	for _, tagID := range tagIDs {
+		loaders = append(loaders, func(ctx context.Context) error {
+			if err := limiter.acquire(ctx); err != nil {
+				return err
+			}
+			defer limiter.release()
+
+			tagResponse, err := projects.TagGet(ctx, resources.TeamworkEngine, projects.NewTagGetRequest(tagID))
+			if err != nil {
+				return fmt.Errorf("failed to load tag %d: %w", tagID, err)
+			}
+			mutex.Lock()
+			names[tagID] = tagResponse.Tag.Name
+			mutex.Unlock()
+			return nil
+		})
+	}
+	if err := runConcurrently(ctx, loaders...); err != nil {
+		return backlogTags{}, err
+	}
+
+	tags := backlogTags{
+		tasklists: make(map[int64][]webhook.Tag, len(tasklistTagIDs)),
+		names:     names,
+	}
+	for _, tag := range projectTagIDs {
+		tags.project = append(tags.project, webhook.Tag{ID: tag.ID, Name: names[tag.ID]})
+	}
+	for tasklistID, tasklistTags := range tasklistTagIDs {
+		for _, tag := range tasklistTags {
+			tags.tasklists[tasklistID] = append(tags.tasklists[tasklistID], webhook.Tag{ID: tag.ID, Name: names[tag.ID]})
+		}
+	}
+	return tags, nil
+}
+
+// tasklistGetRequest loads a single tasklist. The tasklist of the Teamwork SDK
+// doesn't have the tags, so the response is decoded here.
+type tasklistGetRequest struct {
+	id int64
+}
+
+// HTTPRequest creates an HTTP request for the tasklistGetRequest.
+func (t tasklistGetRequest) HTTPRequest(ctx context.Context, server string) (*http.Request, error) {
+	uri := server + "/projects/api/v3/tasklists/" + strconv.FormatInt(t.id, 10) + ".json"
+	return http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+}
+
+// tasklistGetResponse contains the tags of a tasklist.
+type tasklistGetResponse struct {
+	Tasklist struct {
+		ID   int64                `json:"id"`
+		Tags []twapi.Relationship `json:"tags"`
+	} `json:"tasklist"`
+}
+
+// HandleHTTPResponse handles the HTTP response for the tasklistGetResponse.
+func (t *tasklistGetResponse) HandleHTTPResponse(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return twapi.NewHTTPError(resp, "failed to retrieve tasklist")
+	}
+	if err := json.NewDecoder(resp.Body).Decode(t); err != nil {
+		return fmt.Errorf("failed to decode retrieve tasklist response: %w", err)
+	}
+	return nil
+}
+
+// backlogTaskData converts a listed task into the same payload received from
+// the task webhooks. Tags are only filled when loaded in the backlog tags.
+func backlogTaskData(projectID int64, task projects.Task, tags backlogTags) webhook.TaskData {
+	var taskData webhook.TaskData
+	taskData.Project.ID = projectID
+	taskData.Project.Tags = tags.project
+	taskData.Task.ID = task.ID
+	taskData.Task.Name = task.Name
+	if task.Description != nil {
+		taskData.Task.Description = *task.Description
+	}
+	taskData.Task.Status = task.Status
+	taskData.Task.StartDate = task.StartAt
+	taskData.Task.DueDate = task.DueAt
+	taskData.Task.EstimatedMinutes = task.EstimatedMinutes
+	for _, tag := range task.Tags {
+		taskData.Task.Tags = append(taskData.Task.Tags, webhook.Tag{ID: tag.ID, Name: tags.names[tag.ID]})
+	}
+	taskData.Tasklist.ID = task.Tasklist.ID
+	taskData.Tasklist.Tags = tags.tasklists[task.Tasklist.ID]
+	return taskData
+}
@@ -2,9 +2,13 @@ package actions
 
 import (
 	"cmp"
+	"context"
+	"fmt"
 	"slices"
 	"sort"
+	"sync"
 
+	"github.com/rafaeljusto/teamwork-ai/internal/config"
 	twapi "github.com/teamwork/twapi-go-sdk"
 )
 
@@ -43,3 +47,92 @@ func extractMappedIDs[T any](relationships []twapi.Relationship, sourceMap map[i
 	}
 	return result
 }
+
+// runConcurrently runs all functions concurrently. As soon as one of them
+// fails, the context given to the others is canceled. The first error is
+// returned.
+func runConcurrently(ctx context.Context, funcs ...func(context.Context) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for _, f := range funcs {
+		wg.Go(func() {
+			if err := f(ctx); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel(err)
+				})
+			}
+		})
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// limiter bounds the number of concurrent requests to the Teamwork API. A nil
+// limiter doesn't impose any bound.
+type limiter chan struct{}
+
+func newLimiter(concurrency int) limiter {
+	if concurrency <= 0 {
+		return nil
+	}
+	return make(limiter, concurrency)
+}
+
+func (l limiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l limiter) release() {
+	if l == nil {
+		return
+	}
+	<-l
+}
+
+// iterateAll loads all pages of a paginated Teamwork resource. Each page
+// request acquires a slot from the limiter.
+func iterateAll[T twapi.HTTPRequester, R interface {
+	twapi.HTTPResponser
+	Iterate() *T
+}, E any](
+	ctx context.Context,
+	resources *config.Resources,
+	limiter limiter,
+	request T,
+	items func(R) []E,
+) ([]E, error) {
+	next, err := twapi.Iterate[T, R](ctx, resources.TeamworkEngine, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build iterator: %w", err)
+	}
+
+	var result []E
+	for {
+		if err := limiter.acquire(ctx); err != nil {
+			return nil, err
+		}
+		response, hasNext, err := next()
+		limiter.release()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list page: %w", err)
+		}
+		result = append(result, items(response)...)
+		if !hasNext {
+			break
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,256 @@
+package agentic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultAgentMaxSteps is the default number of tool call rounds allowed
+// before the model must answer.
+const defaultAgentMaxSteps = 5
+
+// ToolCall is a request of the model to call a tool before answering.
+type ToolCall struct {
+	// ID identifies the call in the conversation, so the result can be
+	// associated with it.
+	ID string
+
+	// Name is the name of the tool.
+	Name string
+
+	// Arguments is the JSON object with the tool arguments.
+	Arguments json.RawMessage
+}
+
+// ToolResult is the outcome of a tool call, sent back to the model.
+type ToolResult struct {
+	// Content is the text returned by the tool, or the error message.
+	Content string
+
+	// IsError informs if the tool call failed.
+	IsError bool
+}
+
+// ToolStep is a round of tool calls requested by the model. The results are in
+// the same order as the calls.
+type ToolStep struct {
+	Calls   []ToolCall
+	Results []ToolResult
+}
+
+// ToolCaller is implemented by the models that can call tools before producing
+// the final answer.
+type ToolCaller interface {
+	// CompleteWithTools sends the prompt messages and the previous tool steps to
+	// the model, allowing it to call the tools. The model either requests more
+	// tool calls, or answers with an output following the JSON schema, already
+	// validated (see ValidateOutput).
+	CompleteWithTools(
+		ctx context.Context,
+		promptMessages []*mcp.PromptMessage,
+		tools []*mcp.Tool,
+		steps []ToolStep,
+		schema *jsonschema.Schema,
+	) ([]ToolCall, json.RawMessage, error)
+}
+
+// MCPRunner runs operations over an MCP session. The session may be replaced
+// between operations, and an operation may be executed again when the session
+// is lost.
+type MCPRunner interface {
+	Do(ctx context.Context, fn func(*mcp.ClientSession) error) error
+}
+
+// AgentOptions contains the options for the Agent.
+type AgentOptions struct {
+	allowedTools []string
+	maxSteps     int
+	logger       *slog.Logger
+}
+
+// AgentOption is a function that sets an option for the Agent.
+type AgentOption func(*AgentOptions)
+
+// WithAgentAllowedTools sets the MCP tools that the model can call. Tools
+// outside this list are never exposed nor executed. By default no tools are
+// allowed.
+func WithAgentAllowedTools(names ...string) AgentOption {
+	return func(o *AgentOptions) {
+		o.allowedTools = append(o.allowedTools, names...)
+	}
+}
+
+// WithAgentMaxSteps sets the number of tool call rounds allowed before the
+// model must answer. By default 5 rounds are allowed.
+func WithAgentMaxSteps(maxSteps int) AgentOption {
+	return func(o *AgentOptions) {
+		o.maxSteps = maxSteps
+	}
+}
+
+// WithAgentLogger sets the logger used to report every tool call.
+func WithAgentLogger(logger *slog.Logger) AgentOption {
+	return func(o *AgentOptions) {
+		o.logger = logger
+	}
+}
+
+// Agent completes prompts allowing the model to call MCP tools, executed over
+// the MCP session, to gather more information before answering. Only the MCP
+// operations are retried when the session is lost, never the model requests.
+type Agent struct {
+	model    ToolCaller
+	runner   MCPRunner
+	tools    []*mcp.Tool
+	maxSteps int
+	logger   *slog.Logger
+}
+
+// NewAgent creates an agent for the model, exposing the allowed tools of the
+// MCP server. It fails if the model can't call tools.
+func NewAgent(
+	ctx context.Context,
+	model Completer,
+	runner MCPRunner,
+	optFuncs ...AgentOption,
+) (*Agent, error) {
+	options := AgentOptions{
+		maxSteps: defaultAgentMaxSteps,
+		logger:   slog.New(slog.DiscardHandler),
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&options)
+	}
+
+	toolCaller, ok := model.(ToolCaller)
+	if !ok {
+		return nil, fmt.Errorf("model doesn't support tool calls")
+	}
+
+	var tools []*mcp.Tool
+	err := runner.Do(ctx, func(session *mcp.ClientSession) error {
+		tools = nil
+		for tool, err := range session.Tools(ctx, nil) {
+			if err != nil {
+				return err
+			}
+			if slices.Contains(options.allowedTools, tool.Name) {
+				tools = append(tools, tool)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list MCP tools: %w", err)
+	}
+
+	return &Agent{
+		model:    toolCaller,
+		runner:   runner,
+		tools:    tools,
+		maxSteps: options.maxSteps,
+		logger:   options.logger,
+	}, nil
+}
+
+// Complete sends the prompt messages to the model, executing the tool calls
+// requested by the model until it answers with an output following the JSON
+// schema. Once the step limit is reached the tools are no longer offered, so
+// the model must answer, and it fails if the model still calls a tool.
+func (a *Agent) Complete(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	schema *jsonschema.Schema,
+) (json.RawMessage, error) {
+	var steps []ToolStep
+	for {
+		tools := a.tools
+		if len(steps) == a.maxSteps {
+			tools = nil
+		}
+		calls, output, err := a.model.CompleteWithTools(ctx, promptMessages, tools, steps, schema)
+		if err != nil {
+			return nil, err
+		}
+		if len(calls) == 0 {
+			return output, nil
+		}
+		if len(steps) == a.maxSteps {
+			return nil, fmt.Errorf("model didn't answer after %d tool steps", a.maxSteps)
+		}
+
+		step := ToolStep{Calls: calls}
+		for _, call := range calls {
+			result, err := a.callTool(ctx, call)
+			if err != nil {
+				return nil, err
+			}
+			step.Results = append(step.Results, result)
+		}
+		steps = append(steps, step)
+	}
+}
+
+// callTool executes the tool call over the MCP session. Tools that weren't
+// allowed, and failures reported by the tool, are sent back to the model as
+// errors.
+func (a *Agent) callTool(ctx context.Context, call ToolCall) (ToolResult, error) {
+	logger := a.logger.With(
+		slog.String("tool", call.Name),
+		slog.String("arguments", string(call.Arguments)),
+	)
+
+	if !slices.ContainsFunc(a.tools, func(tool *mcp.Tool) bool { return tool.Name == call.Name }) {
+		logger.Warn("model called a tool that isn't allowed")
+		return ToolResult{Content: fmt.Sprintf("tool %q is not available", call.Name), IsError: true}, nil
+	}
+
+	params := &mcp.CallToolParams{Name: call.Name}
+	if len(call.Arguments) > 0 {
+		params.Arguments = call.Arguments
+	}
+
+	start := time.Now()
+	var callResult *mcp.CallToolResult
+	err := a.runner.Do(ctx, func(session *mcp.ClientSession) error {
+		var err error
+		callResult, err = session.CallTool(ctx, params)
+		return err
+	})
+	if err != nil {
+		logger.Error("failed to call tool",
+			slog.String("error", err.Error()),
+		)
+		return ToolResult{}, fmt.Errorf("failed to call tool %s: %w", call.Name, err)
+	}
+
+	result := ToolResult{IsError: callResult.IsError}
+	var content []string
+	for _, c := range callResult.Content {
+		if textContent, ok := c.(*mcp.TextContent); ok {
+			content = append(content, textContent.Text)
+			continue
+		}
+		encoded, err := json.Marshal(c)
+		if err != nil {
+			return ToolResult{}, fmt.Errorf("failed to encode tool %s content: %w", call.Name, err)
+		}
+		content = append(content, string(encoded))
+	}
+	result.Content = strings.Join(content, "\n")
+
+	logger.Info("tool called",
+		slog.Bool("isError", result.IsError),
+		slog.Int("contentLength", len(result.Content)),
+		slog.Duration("duration", time.Since(start)),
+	)
+	return result, nil
+}
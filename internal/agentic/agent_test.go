@@ -0,0 +1,213 @@
+package agentic_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+func Test_Agent(t *testing.T) {
+	var retriedModelCalls atomic.Int32
+
+	tests := []struct {
+		name          string
+		maxSteps      int
+		retryMCP      bool
+		model         toolCallerFunc
+		expectedError string
+		expectDeleted bool
+	}{{
+		name:     "it should call the allowed tools until the model answers",
+		maxSteps: 2,
+		model: func(tools []*mcp.Tool, steps []agentic.ToolStep) ([]agentic.ToolCall, json.RawMessage, error) {
+			if len(tools) != 1 || tools[0].Name != "get_comments" {
+				t.Errorf("unexpected tools exposed to the model: %v", tools)
+			}
+			if len(steps) == 0 {
+				return []agentic.ToolCall{{ID: "1", Name: "get_comments", Arguments: json.RawMessage(`{"taskId":1}`)}}, nil, nil
+			}
+			if result := steps[0].Results[0]; result.IsError || result.Content != "Needs a Go developer." {
+				t.Errorf("unexpected tool result: %+v", result)
+			}
+			return nil, json.RawMessage(`{"ids":[1]}`), nil
+		},
+	}, {
+		name:     "it should not call tools that aren't allowed",
+		maxSteps: 2,
+		model: func(_ []*mcp.Tool, steps []agentic.ToolStep) ([]agentic.ToolCall, json.RawMessage, error) {
+			if len(steps) == 0 {
+				return []agentic.ToolCall{{ID: "1", Name: "delete_task", Arguments: json.RawMessage(`{"taskId":1}`)}}, nil, nil
+			}
+			if result := steps[0].Results[0]; !result.IsError || result.Content != `tool "delete_task" is not available` {
+				t.Errorf("unexpected tool result: %+v", result)
+			}
+			return nil, json.RawMessage(`{"ids":[1]}`), nil
+		},
+	}, {
+		name:     "it should not offer the tools after the step limit",
+		maxSteps: 2,
+		model: func(tools []*mcp.Tool, steps []agentic.ToolStep) ([]agentic.ToolCall, json.RawMessage, error) {
+			if len(tools) == 0 {
+				if len(steps) != 2 {
+					t.Errorf("unexpected tool steps before the answer: %d", len(steps))
+				}
+				return nil, json.RawMessage(`{"ids":[1]}`), nil
+			}
+			return []agentic.ToolCall{{ID: "1", Name: "get_comments", Arguments: json.RawMessage(`{"taskId":1}`)}}, nil, nil
+		},
+	}, {
+		name:     "it should only repeat the MCP operations when the session is lost",
+		maxSteps: 2,
+		retryMCP: true,
+		model: func(_ []*mcp.Tool, steps []agentic.ToolStep) ([]agentic.ToolCall, json.RawMessage, error) {
+			if retriedModelCalls.Add(1) > 2 {
+				t.Errorf("model requests repeated")
+			}
+			if len(steps) == 0 {
+				return []agentic.ToolCall{{ID: "1", Name: "get_comments", Arguments: json.RawMessage(`{"taskId":1}`)}}, nil, nil
+			}
+			return nil, json.RawMessage(`{"ids":[1]}`), nil
+		},
+	}, {
+		name:     "it should fail when the model doesn't answer within the step limit",
+		maxSteps: 2,
+		model: func(_ []*mcp.Tool, _ []agentic.ToolStep) ([]agentic.ToolCall, json.RawMessage, error) {
+			return []agentic.ToolCall{{ID: "1", Name: "get_comments", Arguments: json.RawMessage(`{"taskId":1}`)}}, nil, nil
+		},
+		expectedError: "model didn't answer after 2 tool steps",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted atomic.Bool
+			session := mcpToolsSession(t, &deleted)
+
+			agent, err := agentic.NewAgent(t.Context(), tt.model, sessionRunner{session: session, retry: tt.retryMCP},
+				agentic.WithAgentAllowedTools("get_comments"),
+				agentic.WithAgentMaxSteps(tt.maxSteps),
+			)
+			if err != nil {
+				t.Fatalf("failed to create agent: %v", err)
+			}
+
+			output, err := agent.Complete(t.Context(), nil, nil)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if string(output) != `{"ids":[1]}` {
+				t.Errorf("unexpected output %s", output)
+			}
+			if deleted.Load() {
+				t.Errorf("tool that isn't allowed was called")
+			}
+		})
+	}
+}
+
+func Test_NewAgent(t *testing.T) {
+	var deleted atomic.Bool
+	session := mcpToolsSession(t, &deleted)
+
+	model := completeFunc(func(context.Context, []*mcp.PromptMessage, *jsonschema.Schema) (json.RawMessage, error) {
+		return nil, nil
+	})
+	if _, err := agentic.NewAgent(t.Context(), model, sessionRunner{session: session}); err == nil ||
+		err.Error() != "model doesn't support tool calls" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// mcpToolsSession connects to an in-memory MCP server with a tool to read the
+// comments of a task, and another to delete the task.
+func mcpToolsSession(t *testing.T, deleted *atomic.Bool) *mcp.ClientSession {
+	t.Helper()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "1.0.0"}, nil)
+	inputSchema := &jsonschema.Schema{
+		Type: "object",
+		Properties: map[string]*jsonschema.Schema{
+			"taskId": {Type: "integer"},
+		},
+	}
+	server.AddTool(&mcp.Tool{Name: "get_comments", InputSchema: inputSchema},
+		func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "Needs a Go developer."}},
+			}, nil
+		},
+	)
+	server.AddTool(&mcp.Tool{Name: "delete_task", InputSchema: inputSchema},
+		func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			deleted.Store(true)
+			return &mcp.CallToolResult{}, nil
+		},
+	)
+
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(t.Context(), serverTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect MCP server: %v", err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+	session, err := client.Connect(t.Context(), clientTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect MCP client: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := session.Close(); err != nil {
+			t.Logf("failed to close MCP client session: %v", err)
+		}
+		if err := serverSession.Wait(); err != nil {
+			t.Logf("failed to wait MCP server session: %v", err)
+		}
+	})
+	return session
+}
+
+// sessionRunner runs the MCP operations over the same session. When retry is
+// set every operation is executed twice, as if the session was lost.
+type sessionRunner struct {
+	session *mcp.ClientSession
+	retry   bool
+}
+
+func (r sessionRunner) Do(_ context.Context, fn func(*mcp.ClientSession) error) error {
+	if err := fn(r.session); err != nil || !r.retry {
+		return err
+	}
+	return fn(r.session)
+}
+
+type toolCallerFunc func([]*mcp.Tool, []agentic.ToolStep) ([]agentic.ToolCall, json.RawMessage, error)
+
+func (f toolCallerFunc) Init(string, *slog.Logger) error {
+	return nil
+}
+
+func (f toolCallerFunc) Complete(
+	context.Context,
+	[]*mcp.PromptMessage,
+	*jsonschema.Schema,
+) (json.RawMessage, error) {
+	return nil, nil
+}
+
+func (f toolCallerFunc) CompleteWithTools(
+	_ context.Context,
+	_ []*mcp.PromptMessage,
+	tools []*mcp.Tool,
+	steps []agentic.ToolStep,
+	_ *jsonschema.Schema,
+) ([]agentic.ToolCall, json.RawMessage, error) {
+	return f(tools, steps)
+}
@@ -2,52 +2,126 @@ package agentic
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net/http"
 
+	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-var registered map[string]Agentic
+var registered map[string]func() Agentic
 
 // Register registers an agentic implementation with the given name. The name is
-// used to identify the agentic implementation when initializing it. The agentic
-// implementation must implement the Agentic interface.
-func Register(name string, agentic Agentic) {
+// used to identify the agentic implementation when initializing it. The factory
+// creates a new instance of the agentic implementation, so the same
+// implementation can be initialized multiple times with different DSNs.
+func Register(name string, factory func() Agentic) {
 	if registered == nil {
-		registered = make(map[string]Agentic)
+		registered = make(map[string]func() Agentic)
 	}
-	registered[name] = agentic
+	registered[name] = factory
 }
 
-// Init initializes the agentic system with the provided name, and DSN. The name
-// must be from a pre-registered agentic implementation. The DSN is specific to
-// the agentic implementation and is used to configure it.
-func Init(name, dsn string, logger *slog.Logger) Agentic {
-	if name == "" {
-		return nil
+// Options contains the options used when initializing an agentic
+// implementation.
+type Options struct {
+	httpClient *http.Client
+}
+
+// Option is a function that sets an option for the agentic implementation.
+type Option func(*Options)
+
+// WithHTTPClient sets the HTTP client used to reach the model, for the
+// implementations that support it (see HTTPClientSetter). By default
+// http.DefaultClient is used.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *Options) {
+		o.httpClient = client
+	}
+}
+
+// New creates and initializes a new instance of the agentic implementation
+// registered with the name. The DSN is specific to the agentic implementation
+// and is used to configure it.
+func New(name, dsn string, logger *slog.Logger, optFuncs ...Option) (Agentic, error) {
+	var options Options
+	for _, optFunc := range optFuncs {
+		optFunc(&options)
 	}
-	agentic, ok := registered[name]
+
+	factory, ok := registered[name]
 	if !ok {
-		panic(fmt.Errorf("unknown agentic implementation: %s", name))
+		return nil, fmt.Errorf("unknown agentic implementation: %s", name)
 	}
+	agentic := factory()
 	if err := agentic.Init(dsn, logger); err != nil {
-		panic(fmt.Errorf("failed to initialize agentic implementation: %w", err))
+		return nil, fmt.Errorf("failed to initialize agentic implementation: %w", err)
+	}
+	if setter, ok := agentic.(HTTPClientSetter); ok && options.httpClient != nil {
+		setter.SetHTTPClient(options.httpClient)
 	}
-	return agentic
+	return agentic, nil
 }
 
 // Agentic stores mechanisms to build autonomous systems capable of making
 // decisions and performing tasks without constant human intervention.
 type Agentic interface {
+	Completer
+
 	// Init initializes the agentic system with the provided DSN.
 	Init(dsn string, logger *slog.Logger) error
+}
+
+// HTTPClientSetter is implemented by the agentic implementations that reach the
+// model over HTTP, allowing to replace the default HTTP client.
+type HTTPClientSetter interface {
+	// SetHTTPClient sets the HTTP client used to send the requests.
+	SetHTTPClient(client *http.Client)
+}
 
-	// FindTaskSkillsAndJobRoles finds the skills and job roles for a given task.
-	// It uses the task data, available skills, and available job roles to
-	// determine the most relevant skills and job roles IDs for the task.
-	FindTaskSkillsAndJobRoles(
+// Completer requests structured outputs from a model.
+type Completer interface {
+	// Complete sends the prompt messages to the model, requesting an output that
+	// follows the JSON schema, using the structured output mode of the model.
+	// The returned output is already validated against the schema (see
+	// ValidateOutput).
+	Complete(
 		ctx context.Context,
 		promptMessages []*mcp.PromptMessage,
-	) (skillIDs, jobRoleIDs []int64, reasoning string, err error)
+		schema *jsonschema.Schema,
+	) (json.RawMessage, error)
+}
+
+// Merge defines how a model composed by other models, like the ensemble,
+// combines the outputs of its models for a request.
+type Merge string
+
+// List of possible merges.
+const (
+	// MergeFirst uses the output of the first model that answered. It is used
+	// when the context doesn't define a merge.
+	MergeFirst Merge = "first"
+
+	// MergeTaskSkillsAndJobRoles votes the skills and job roles of the outputs,
+	// that must follow the TaskSkillsAndJobRolesSchema.
+	MergeTaskSkillsAndJobRoles Merge = "taskSkillsAndJobRoles"
+)
+
+type mergeKey struct{}
+
+// WithMerge returns a context defining how composed models combine the
+// outputs of the requests.
+func WithMerge(ctx context.Context, merge Merge) context.Context {
+	return context.WithValue(ctx, mergeKey{}, merge)
+}
+
+// MergeFromContext returns the merge defined in the context, or MergeFirst
+// when not defined.
+func MergeFromContext(ctx context.Context) Merge {
+	if merge, ok := ctx.Value(mergeKey{}).(Merge); ok {
+		return merge
+	}
+	return MergeFirst
 }
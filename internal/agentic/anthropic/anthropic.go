@@ -8,15 +8,35 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
 )
 
-var _ agentic.Agentic = (*anthropic)(nil)
+var (
+	_ agentic.Agentic          = (*anthropic)(nil)
+	_ agentic.ToolCaller       = (*anthropic)(nil)
+	_ agentic.HTTPClientSetter = (*anthropic)(nil)
+)
+
+// defaultBaseURL is the base URL of the Anthropic API.
+const defaultBaseURL = "https://api.anthropic.com/v1"
+
+// imageTypes are the image formats accepted by the model.
+var imageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// defaultMaxTokens is the maximum number of tokens generated by the model for
+// each request, when not defined in the DSN.
+const defaultMaxTokens = 1024
 
 func init() {
-	agentic.Register("anthropic", &anthropic{})
+	agentic.Register("anthropic", func() agentic.Agentic {
+		return &anthropic{}
+	})
 }
 
 // anthropic is an american company that provides a suite of AI tools and
@@ -30,50 +50,107 @@ func init() {
 // The API reference is available at:
 // https://docs.anthropic.com/en/api
 type anthropic struct {
-	client *http.Client
-	logger *slog.Logger
-	model  string
-	token  string
+	client   *http.Client
+	endpoint string
+	headers  http.Header
+	logger   *slog.Logger
+	model    string
+	token    string
+	tuning   agentic.Tuning
 }
 
 // Init initializes the anthropic instance with the provided DSN. The DSN must
-// have the format:
+// have one of the formats:
 //
-//	`model:token`.
+//	`anthropic[+http]://token@[host[:port]][/path]/model[?parameters]`
+//	`model:token[?parameters]`
 //
 // The model name should be the name of the model to be used (e.g.
-// "claude-1"). The token should be the Anthropic API key.
+// "claude-1"). The token should be the Anthropic API key. In the URL format
+// the host and the path replace the ones of the default base URL (e.g.
+// anthropic://token@gateway.internal/anthropic/v1/claude-sonnet-4-0). The
+// optional parameters use the URL query format:
 //
-// TODO(rafaeljusto): Add support for custom HTTP client.
+//   - base_url: URL of the API, to use a gateway or a compatible server.
+//     Defaults to https://api.anthropic.com/v1.
+//   - header: extra HTTP header with the format "Name: Value" (e.g.
+//     "anthropic-beta: ..."). It can be repeated.
+//   - temperature, top_p, top_k: sampling of the model.
+//   - max_tokens: maximum number of tokens generated. Defaults to 1024.
+//   - timeout: limit of each request (e.g. "30s").
+//   - retries: number of times a request is sent again when the API is
+//     unavailable.
 func (a *anthropic) Init(dsn string, logger *slog.Logger) error {
 	a.client = http.DefaultClient
 	a.logger = logger
 
-	dsnParts := strings.Split(dsn, ":")
-	if len(dsnParts) != 2 {
-		return fmt.Errorf("invalid DSN format: %s", dsn)
+	allowed := []string{"base_url", "header", "temperature", "top_p", "top_k", "max_tokens", "timeout", "retries"}
+	baseURL := defaultBaseURL
+	var parameters url.Values
+	if agentic.HasScheme(dsn, "anthropic") {
+		parsedDSN, err := agentic.ParseURLDSN(dsn, defaultBaseURL, allowed...)
+		if err != nil {
+			return err
+		}
+		a.model = parsedDSN.Model
+		a.token = parsedDSN.User.Username()
+		baseURL = parsedDSN.BaseURL
+		parameters = parsedDSN.Parameters
+	} else {
+		var err error
+		if dsn, parameters, err = agentic.SplitDSN(dsn, allowed...); err != nil {
+			return err
+		}
+		dsnParts := strings.Split(dsn, ":")
+		if len(dsnParts) != 2 {
+			return fmt.Errorf("invalid DSN format, expected model:token")
+		}
+		a.model = dsnParts[0]
+		a.token = dsnParts[1]
+	}
+	if a.token == "" {
+		return fmt.Errorf("missing token in DSN")
+	}
+
+	if parameters.Has("base_url") {
+		baseURL = parameters.Get("base_url")
+	}
+	var err error
+	if a.endpoint, err = url.JoinPath(baseURL, "messages"); err != nil {
+		return fmt.Errorf("invalid base URL: %w", err)
+	}
+	if a.headers, err = agentic.ParseHeaders(parameters["header"]); err != nil {
+		return err
+	}
+	if a.tuning, err = agentic.ParseTuning(parameters); err != nil {
+		return err
 	}
-	a.model = dsnParts[0]
-	a.token = dsnParts[1]
 	return nil
 }
 
+// SetHTTPClient sets the HTTP client used to send the requests.
+func (a *anthropic) SetHTTPClient(client *http.Client) {
+	a.client = client
+}
+
 func (a *anthropic) do(ctx context.Context, aiRequest request) (response, error) {
 	body, err := json.Marshal(aiRequest)
 	if err != nil {
 		return response{}, fmt.Errorf("failed to encode request: %w", err)
 	}
 
-	url := "https://api.anthropic.com/v1/messages"
-	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, bytes.NewBuffer(body))
 	if err != nil {
 		return response{}, fmt.Errorf("failed to create request: %w", err)
 	}
+	for name, values := range a.headers {
+		httpRequest.Header[name] = values
+	}
 	httpRequest.Header.Set("x-api-key", a.token)
 	httpRequest.Header.Set("anthropic-version", "2023-06-01")
 	httpRequest.Header.Set("Content-Type", "application/json")
 
-	httpResponse, err := a.client.Do(httpRequest)
+	httpResponse, err := a.tuning.Send(a.client, httpRequest)
 	if err != nil {
 		return response{}, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -86,59 +163,256 @@ func (a *anthropic) do(ctx context.Context, aiRequest request) (response, error)
 	}()
 
 	if httpResponse.StatusCode != http.StatusOK {
+		statusErr := &agentic.StatusError{StatusCode: httpResponse.StatusCode}
 		if body, err := io.ReadAll(httpResponse.Body); err == nil {
-			return response{}, fmt.Errorf("unexpected status code: %d, body: %s", httpResponse.StatusCode, string(body))
+			statusErr.Body = errorMessage(body)
 		}
-		return response{}, fmt.Errorf("unexpected status code: %d", httpResponse.StatusCode)
+		return response{}, statusErr
 	}
 
 	var aiResponse response
 	if err = json.NewDecoder(httpResponse.Body).Decode(&aiResponse); err != nil {
-		return response{}, fmt.Errorf("failed to decode response: %w", err)
+		return response{}, &agentic.OutputError{Err: fmt.Errorf("failed to decode response: %w", err)}
 	}
+	agentic.RecordUsage(ctx, agentic.Usage{
+		Provider:     "anthropic",
+		Model:        a.model,
+		InputTokens:  aiResponse.Usage.InputTokens,
+		OutputTokens: aiResponse.Usage.OutputTokens,
+	})
 	return aiResponse, nil
 }
 
 type request struct {
-	Model     string           `json:"model"`
-	Messages  []requestMessage `json:"messages"`
-	MaxTokens int              `json:"max_tokens"`
+	Model       string           `json:"model"`
+	System      []content        `json:"system,omitempty"`
+	Messages    []requestMessage `json:"messages"`
+	MaxTokens   int64            `json:"max_tokens"`
+	Temperature *float64         `json:"temperature,omitempty"`
+	TopP        *float64         `json:"top_p,omitempty"`
+	TopK        *int64           `json:"top_k,omitempty"`
+	Tools       []tool           `json:"tools,omitempty"`
+	ToolChoice  *toolChoice      `json:"tool_choice,omitempty"`
 }
 
-func (r *request) addSystemMessage(content string) {
-	r.Messages = append(r.Messages, requestMessage{
-		Role:    "system",
-		Content: content,
+// setTuning applies the sampling settings defined in the DSN.
+func (r *request) setTuning(tuning agentic.Tuning) {
+	r.MaxTokens = defaultMaxTokens
+	if tuning.MaxTokens != nil {
+		r.MaxTokens = *tuning.MaxTokens
+	}
+	r.Temperature = tuning.Temperature
+	r.TopP = tuning.TopP
+	r.TopK = tuning.TopK
+}
+
+// setSchema forces the model to answer calling a tool with the JSON schema as
+// input, which is the way to obtain structured outputs from the Messages API.
+// When other tools were added, the model is free to call any of them, and the
+// answer is only available when it calls the schema tool.
+func (r *request) setSchema(name string, schema *jsonschema.Schema) {
+	r.Tools = append(r.Tools, tool{
+		Name:        name,
+		Description: "Report the answer using this structured output.",
+		InputSchema: schema,
 	})
+	if len(r.Tools) == 1 {
+		r.ToolChoice = &toolChoice{
+			Type: "tool",
+			Name: name,
+		}
+	} else {
+		r.ToolChoice = &toolChoice{
+			Type: "any",
+		}
+	}
 }
 
-func (r *request) addUserMessage(content string) {
+// addTool allows the model to call the MCP tool.
+func (r *request) addTool(mcpTool *mcp.Tool) {
+	r.Tools = append(r.Tools, tool{
+		Name:        mcpTool.Name,
+		Description: mcpTool.Description,
+		InputSchema: mcpTool.InputSchema,
+	})
+}
+
+// addToolStep adds the tool calls requested by the model, followed by their
+// results.
+func (r *request) addToolStep(step agentic.ToolStep) {
+	toolUses := make([]content, 0, len(step.Calls))
+	for _, call := range step.Calls {
+		input := call.Arguments
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		toolUses = append(toolUses, content{
+			Type:  "tool_use",
+			ID:    call.ID,
+			Name:  call.Name,
+			Input: input,
+		})
+	}
+	r.Messages = append(r.Messages, requestMessage{
+		Role:    "assistant",
+		Content: toolUses,
+	})
+
+	toolResults := make([]content, 0, len(step.Results))
+	for i, result := range step.Results {
+		toolResults = append(toolResults, content{
+			Type:      "tool_result",
+			ToolUseID: step.Calls[i].ID,
+			Content:   result.Content,
+			IsError:   result.IsError,
+		})
+	}
 	r.Messages = append(r.Messages, requestMessage{
 		Role:    "user",
-		Content: content,
+		Content: toolResults,
+	})
+}
+
+// addSystemMessage adds the text to the system prompt. The Messages API
+// doesn't accept the system role in the messages, so the instructions are sent
+// in a top-level field instead.
+func (r *request) addSystemMessage(text string) {
+	r.System = append(r.System, content{
+		Type: "text",
+		Text: text,
+	})
+}
+
+// addMessage adds the message to the user or assistant turn. Consecutive
+// messages of the same role are sent as multiple blocks of the same turn.
+// Images are only sent by the user, in the formats supported by the model;
+// otherwise they are described in a text block.
+func (r *request) addMessage(message agentic.Message) {
+	block := content{
+		Type: "text",
+		Text: message.TextOnly(),
+	}
+	if message.Image != nil && message.Role == agentic.MessageRoleUser &&
+		slices.Contains(imageTypes, message.Image.MIMEType) {
+		block = content{
+			Type: "image",
+			Source: &imageSource{
+				Type:      "base64",
+				MediaType: message.Image.MIMEType,
+				Data:      message.Image.Base64(),
+			},
+		}
+	}
+	role := string(message.Role)
+	if last := len(r.Messages) - 1; last >= 0 && r.Messages[last].Role == role {
+		r.Messages[last].Content = append(r.Messages[last].Content, block)
+		return
+	}
+	r.Messages = append(r.Messages, requestMessage{
+		Role:    role,
+		Content: []content{block},
 	})
 }
 
 type requestMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string    `json:"role"`
+	Content []content `json:"content"`
+}
+
+type tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	InputSchema any    `json:"input_schema"`
+}
+
+type toolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 type response struct {
-	Contents []content `json:"content"`
+	Contents   []content `json:"content"`
+	StopReason string    `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int64 `json:"input_tokens"`
+		OutputTokens int64 `json:"output_tokens"`
+	} `json:"usage"`
 }
 
-func (r *response) decode(target any) error {
-	if len(r.Contents) == 0 {
-		return fmt.Errorf("no content in response")
+// check verifies if the model finished the answer. A truncated answer can't be
+// used, as the tool input would be incomplete.
+func (r *response) check() error {
+	switch r.StopReason {
+	case "max_tokens":
+		return fmt.Errorf("response truncated after %d output tokens", r.Usage.OutputTokens)
+	case "refusal":
+		return fmt.Errorf("model refused to answer")
 	}
-	if len(r.Contents) > 1 {
-		return fmt.Errorf("multiple contents in response")
+	return nil
+}
+
+// toolInput returns the input of the tool call with the given name.
+func (r *response) toolInput(name string) (json.RawMessage, error) {
+	for _, content := range r.Contents {
+		if content.Type == "tool_use" && content.Name == name {
+			return content.Input, nil
+		}
+	}
+	return nil, fmt.Errorf("no %q tool use in response", name)
+}
+
+// toolCalls returns the tool calls requested by the model, except the ones to
+// the tool with the given name.
+func (r *response) toolCalls(exceptName string) []agentic.ToolCall {
+	var calls []agentic.ToolCall
+	for _, content := range r.Contents {
+		if content.Type != "tool_use" || content.Name == exceptName {
+			continue
+		}
+		calls = append(calls, agentic.ToolCall{
+			ID:        content.ID,
+			Name:      content.Name,
+			Arguments: content.Input,
+		})
 	}
-	return json.Unmarshal([]byte(r.Contents[0].Text), target)
+	return calls
 }
 
 type content struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Source    *imageSource    `json:"source,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+type imageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// errorResponse is the body of the failed requests.
+//
+// https://docs.anthropic.com/en/api/errors
+type errorResponse struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// errorMessage extracts the error type and message from the body of a failed
+// request. If the body doesn't follow the error schema, it is returned as is.
+func errorMessage(body []byte) string {
+	var errResponse errorResponse
+	if err := json.Unmarshal(body, &errResponse); err != nil || errResponse.Error.Type == "" {
+		return string(body)
+	}
+	return errResponse.Error.Type + ": " + errResponse.Error.Message
 }
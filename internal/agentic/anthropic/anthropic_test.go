@@ -0,0 +1,429 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+func Test_Complete(t *testing.T) {
+	tests := []struct {
+		name           string
+		responseStatus int
+		fixture        string
+		expectedOutput string
+		expectedUsage  []agentic.Usage
+		expectedError  string
+	}{{
+		name:           "it should force the tool use with the schema",
+		responseStatus: http.StatusOK,
+		fixture:        "tool_use.json",
+		expectedOutput: `{"ids":[1,2]}`,
+		expectedUsage: []agentic.Usage{{
+			Provider:     "anthropic",
+			Model:        "claude-sonnet-4-0",
+			InputTokens:  210,
+			OutputTokens: 32,
+		}},
+	}, {
+		name:           "it should fail when the tool isn't used",
+		responseStatus: http.StatusOK,
+		fixture:        "text.json",
+		expectedError:  `no "answer" tool use in response`,
+	}, {
+		name:           "it should fail when the tool input doesn't follow the schema",
+		responseStatus: http.StatusOK,
+		fixture:        "invalid_input.json",
+		expectedError:  "output doesn't follow the schema",
+	}, {
+		name:           "it should fail when the response is truncated",
+		responseStatus: http.StatusOK,
+		fixture:        "max_tokens.json",
+		expectedError:  "response truncated after 1024 output tokens",
+	}, {
+		name:           "it should fail when the API rejects the request",
+		responseStatus: http.StatusBadRequest,
+		fixture:        "invalid_request_error.json",
+		expectedError: "unexpected status code: 400, body: " +
+			"invalid_request_error: tools.0.input_schema: JSON schema is invalid",
+	}, {
+		name:           "it should fail when the API is overloaded",
+		responseStatus: 529,
+		fixture:        "overloaded_error.json",
+		expectedError:  "unexpected status code: 529, body: overloaded_error: Overloaded",
+	}}
+
+	expectedRequest := `{
+		"model": "claude-sonnet-4-0",
+		"system": [{"type": "text", "text": "You are a project manager."}],
+		"messages": [{
+			"role": "user",
+			"content": [
+				{"type": "text", "text": "The task is about Go."},
+				{"type": "text", "text": "List the IDs."}
+			]
+		}],
+		"max_tokens": 1024,
+		"tools": [{
+			"name": "answer",
+			"description": "Report the answer using this structured output.",
+			"input_schema": {
+				"type": "object",
+				"title": "answer",
+				"properties": {
+					"ids": {"type": ["null", "array"], "items": {"type": "integer"}, "description": "IDs of the items"}
+				},
+				"required": ["ids"],
+				"additionalProperties": false
+			}
+		}],
+		"tool_choice": {"type": "tool", "name": "answer"}
+	}`
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var model anthropic
+			if err := model.Init("claude-sonnet-4-0:abc123", slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("failed to initialize: %v", err)
+			}
+			model.endpoint = fixtureServer(t, expectedRequest, tt.responseStatus, tt.fixture)
+
+			ctx, recorder := agentic.WithUsageRecorder(t.Context())
+			output, err := model.Complete(ctx, []*mcp.PromptMessage{{
+				Role:    "system",
+				Content: &mcp.TextContent{Text: "You are a project manager."},
+			}, {
+				Role:    "user",
+				Content: &mcp.TextContent{Text: "The task is about Go."},
+			}, {
+				Role:    "user",
+				Content: &mcp.TextContent{Text: "List the IDs."},
+			}}, answerSchema(t))
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSON(t, tt.expectedOutput, string(output))
+			if usages := recorder.Usages(); !reflect.DeepEqual(usages, tt.expectedUsage) {
+				t.Errorf("unexpected usage %v, expected %v", usages, tt.expectedUsage)
+			}
+		})
+	}
+}
+
+func Test_CompleteMultimodal(t *testing.T) {
+	expectedRequest := `{
+		"model": "claude-sonnet-4-0",
+		"system": [{"type": "text", "text": "You are a project manager."}],
+		"messages": [{
+			"role": "user",
+			"content": [{"type": "text", "text": "Task: add a login page."}]
+		}, {
+			"role": "assistant",
+			"content": [{"type": "text", "text": "{\"ids\":[1]}"}]
+		}, {
+			"role": "user",
+			"content": [
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "cG5n"}},
+				{"type": "text", "text": "Resource file:///spec.md:\nUse Go."},
+				{"type": "text", "text": "[image file:///diagram.bmp (image/bmp) omitted]"}
+			]
+		}],
+		"max_tokens": 1024,
+		"tools": [{
+			"name": "answer",
+			"description": "Report the answer using this structured output.",
+			"input_schema": {
+				"type": "object",
+				"title": "answer",
+				"properties": {
+					"ids": {"type": ["null", "array"], "items": {"type": "integer"}, "description": "IDs of the items"}
+				},
+				"required": ["ids"],
+				"additionalProperties": false
+			}
+		}],
+		"tool_choice": {"type": "tool", "name": "answer"}
+	}`
+
+	var model anthropic
+	if err := model.Init("claude-sonnet-4-0:abc123", slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	model.endpoint = fixtureServer(t, expectedRequest, http.StatusOK, "tool_use.json")
+
+	output, err := model.Complete(t.Context(), multimodalPrompt(), answerSchema(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertJSON(t, `{"ids":[1,2]}`, string(output))
+}
+
+// multimodalPrompt is a few-shot prompt with an image and embedded resources.
+func multimodalPrompt() []*mcp.PromptMessage {
+	return []*mcp.PromptMessage{{
+		Role:    "system",
+		Content: &mcp.TextContent{Text: "You are a project manager."},
+	}, {
+		Role:    "user",
+		Content: &mcp.TextContent{Text: "Task: add a login page."},
+	}, {
+		Role:    "assistant",
+		Content: &mcp.TextContent{Text: `{"ids":[1]}`},
+	}, {
+		Role:    "user",
+		Content: &mcp.ImageContent{MIMEType: "image/png", Data: []byte("png")},
+	}, {
+		Role: "user",
+		Content: &mcp.EmbeddedResource{
+			Resource: &mcp.ResourceContents{URI: "file:///spec.md", MIMEType: "text/markdown", Text: "Use Go."},
+		},
+	}, {
+		Role: "user",
+		Content: &mcp.EmbeddedResource{
+			Resource: &mcp.ResourceContents{URI: "file:///diagram.bmp", MIMEType: "image/bmp", Blob: []byte("bmp")},
+		},
+	}}
+}
+
+// fixtureServer starts a server that checks the request sent to the Messages
+// API, answering with the recorded response stored in the testdata directory.
+// It returns the URL of the server.
+func fixtureServer(t *testing.T, expectedRequest string, status int, fixture string) string {
+	t.Helper()
+
+	responseBody, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "abc123" {
+			t.Errorf("unexpected API key header %q", r.Header.Get("x-api-key"))
+		}
+		if r.Header.Get("anthropic-version") != "2023-06-01" {
+			t.Errorf("unexpected version header %q", r.Header.Get("anthropic-version"))
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request body: %v", err)
+			return
+		}
+		assertJSON(t, expectedRequest, string(body))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(responseBody)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func answerSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+
+	type answer struct {
+		IDs []int64 `json:"ids" jsonschema:"IDs of the items"`
+	}
+	schema, err := jsonschema.For[answer](nil)
+	if err != nil {
+		t.Fatalf("failed to build schema: %v", err)
+	}
+	schema.Title = "answer"
+	return schema
+}
+
+func assertJSON(t *testing.T, expected, actual string) {
+	t.Helper()
+
+	var expectedValue, actualValue any
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		t.Errorf("failed to decode expected JSON: %v", err)
+		return
+	}
+	if err := json.Unmarshal([]byte(actual), &actualValue); err != nil {
+		t.Errorf("failed to decode JSON %q: %v", actual, err)
+		return
+	}
+	if !reflect.DeepEqual(expectedValue, actualValue) {
+		t.Errorf("unexpected JSON:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func Test_CompleteWithTools(t *testing.T) {
+	expectedRequest := `{
+		"model": "claude-sonnet-4-0",
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": "List the IDs."}]},
+			{"role": "assistant", "content": [
+				{"type": "tool_use", "id": "toolu_1", "name": "get_comments", "input": {"taskId": 1}},
+				{"type": "tool_use", "id": "toolu_2", "name": "delete_task", "input": {}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": "Needs a Go developer."},
+				{"type": "tool_result", "tool_use_id": "toolu_2", "content": "tool not available", "is_error": true}
+			]}
+		],
+		"max_tokens": 1024,
+		"tools": [{
+			"name": "get_comments",
+			"description": "Comments of a task.",
+			"input_schema": {"type": "object", "properties": {"taskId": {"type": "integer"}}}
+		}, {
+			"name": "answer",
+			"description": "Report the answer using this structured output.",
+			"input_schema": {
+				"type": "object",
+				"title": "answer",
+				"properties": {
+					"ids": {"type": ["null", "array"], "items": {"type": "integer"}, "description": "IDs of the items"}
+				},
+				"required": ["ids"],
+				"additionalProperties": false
+			}
+		}],
+		"tool_choice": {"type": "any"}
+	}`
+
+	var model anthropic
+	if err := model.Init("claude-sonnet-4-0:abc123", slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	model.endpoint = fixtureServer(t, expectedRequest, http.StatusOK, "tool_calls.json")
+
+	calls, output, err := model.CompleteWithTools(t.Context(), []*mcp.PromptMessage{{
+		Role:    "user",
+		Content: &mcp.TextContent{Text: "List the IDs."},
+	}}, []*mcp.Tool{{
+		Name:        "get_comments",
+		Description: "Comments of a task.",
+		InputSchema: map[string]any{"type": "object", "properties": map[string]any{"taskId": map[string]any{"type": "integer"}}},
+	}}, []agentic.ToolStep{{
+		Calls: []agentic.ToolCall{
+			{ID: "toolu_1", Name: "get_comments", Arguments: json.RawMessage(`{"taskId":1}`)},
+			{ID: "toolu_2", Name: "delete_task"},
+		},
+		Results: []agentic.ToolResult{
+			{Content: "Needs a Go developer."},
+			{Content: "tool not available", IsError: true},
+		},
+	}}, answerSchema(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output != nil {
+		t.Errorf("unexpected output %s", output)
+	}
+	expectedCalls := []agentic.ToolCall{{ID: "toolu_3", Name: "get_comments", Arguments: json.RawMessage(`{"taskId": 2}`)}}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("unexpected calls %+v, expected %+v", calls, expectedCalls)
+	}
+}
+
+func Test_Init(t *testing.T) {
+	tests := []struct {
+		name             string
+		dsn              string
+		expectedEndpoint string
+		expectedHeaders  http.Header
+		expectedTuning   agentic.Tuning
+		expectedError    string
+	}{{
+		name:             "it should use the Anthropic API by default",
+		dsn:              "claude-sonnet-4-0:abc123",
+		expectedEndpoint: "https://api.anthropic.com/v1/messages",
+		expectedHeaders:  http.Header{},
+	}, {
+		name:             "it should use the base URL and the extra headers",
+		dsn:              "claude-sonnet-4-0:abc123?base_url=http://gateway.internal/anthropic/v1&header=anthropic-beta: tools",
+		expectedEndpoint: "http://gateway.internal/anthropic/v1/messages",
+		expectedHeaders:  http.Header{"Anthropic-Beta": {"tools"}},
+	}, {
+		name:          "it should reject unknown parameters",
+		dsn:           "claude-sonnet-4-0:abc123?deployment=claude",
+		expectedError: "unknown DSN parameter: deployment",
+	}, {
+		name:             "it should accept the URL format with tuning parameters",
+		dsn:              "anthropic://abc123@/claude-sonnet-4-0?max_tokens=2048&temperature=0&top_k=5&timeout=30s&retries=2",
+		expectedEndpoint: "https://api.anthropic.com/v1/messages",
+		expectedHeaders:  http.Header{},
+		expectedTuning: agentic.Tuning{
+			Temperature: new(float64(0)),
+			TopK:        new(int64(5)),
+			MaxTokens:   new(int64(2048)),
+			Timeout:     30 * time.Second,
+			Retries:     2,
+		},
+	}, {
+		name:             "it should replace the host and the path of the API",
+		dsn:              "anthropic+http://abc123@gateway.internal/anthropic/v1/claude-sonnet-4-0",
+		expectedEndpoint: "http://gateway.internal/anthropic/v1/messages",
+		expectedHeaders:  http.Header{},
+	}, {
+		name:             "it should keep the path of the API with only a host",
+		dsn:              "anthropic://abc123@gateway.internal/claude-sonnet-4-0",
+		expectedEndpoint: "https://gateway.internal/v1/messages",
+		expectedHeaders:  http.Header{},
+	}, {
+		name:          "it should reject invalid tuning parameters",
+		dsn:           "anthropic://abc123@/claude-sonnet-4-0?temperature=hot",
+		expectedError: "invalid temperature",
+	}, {
+		name:          "it should not leak the token in an invalid DSN",
+		dsn:           "claude-sonnet-4-0:abc123:extra",
+		expectedError: "invalid DSN format, expected model:token",
+	}, {
+		name:          "it should not leak the token in an invalid URL",
+		dsn:           "anthropic://abc123@gateway.internal:port/claude-sonnet-4-0",
+		expectedError: "invalid DSN format",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var model anthropic
+			err := model.Init(tt.dsn, slog.New(slog.DiscardHandler))
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				if strings.Contains(err.Error(), "abc123") {
+					t.Errorf("error leaks the token: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if model.model != "claude-sonnet-4-0" || model.token != "abc123" {
+				t.Errorf("unexpected model %q or token %q", model.model, model.token)
+			}
+			if model.endpoint != tt.expectedEndpoint {
+				t.Errorf("unexpected endpoint %q, expected %q", model.endpoint, tt.expectedEndpoint)
+			}
+			if !reflect.DeepEqual(model.headers, tt.expectedHeaders) {
+				t.Errorf("unexpected headers %v, expected %v", model.headers, tt.expectedHeaders)
+			}
+			if !reflect.DeepEqual(model.tuning, tt.expectedTuning) {
+				t.Errorf("unexpected tuning %+v, expected %+v", model.tuning, tt.expectedTuning)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+// Complete sends the prompt messages to the model, requesting an output that
+// follows the JSON schema. The schema is enforced by forcing the model to call
+// a tool with the schema as input.
+func (a *anthropic) Complete(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	schema *jsonschema.Schema,
+) (json.RawMessage, error) {
+	_, output, err := a.CompleteWithTools(ctx, promptMessages, nil, nil, schema)
+	return output, err
+}
+
+// CompleteWithTools sends the prompt messages and the previous tool steps to
+// the model, exposing the tools together with the schema tool. The model must
+// call a tool: the schema tool to answer, or the other tools to gather more
+// information.
+func (a *anthropic) CompleteWithTools(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	tools []*mcp.Tool,
+	steps []agentic.ToolStep,
+	schema *jsonschema.Schema,
+) ([]agentic.ToolCall, json.RawMessage, error) {
+	if schema == nil {
+		return nil, nil, fmt.Errorf("missing output schema")
+	}
+	messages, err := agentic.Messages(promptMessages)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var aiRequest request
+	aiRequest.Model = a.model
+	aiRequest.setTuning(a.tuning)
+	for _, message := range messages {
+		switch message.Role {
+		case agentic.MessageRoleSystem:
+			aiRequest.addSystemMessage(message.TextOnly())
+		case agentic.MessageRoleUser, agentic.MessageRoleAssistant:
+			aiRequest.addMessage(message)
+		}
+	}
+	for _, tool := range tools {
+		aiRequest.addTool(tool)
+	}
+	for _, step := range steps {
+		aiRequest.addToolStep(step)
+	}
+	name := agentic.SchemaName(schema)
+	aiRequest.setSchema(name, schema)
+
+	aiResponse, err := a.do(ctx, aiRequest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to complete: %w", err)
+	}
+	if err := aiResponse.check(); err != nil {
+		return nil, nil, &agentic.OutputError{Err: fmt.Errorf("failed to read completion: %w", err)}
+	}
+	input, err := aiResponse.toolInput(name)
+	if err != nil {
+		if calls := aiResponse.toolCalls(name); len(calls) > 0 {
+			return calls, nil, nil
+		}
+		return nil, nil, &agentic.OutputError{Err: fmt.Errorf("failed to read completion: %w", err)}
+	}
+	output, err := agentic.ValidateOutput(string(input), schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, output, nil
+}
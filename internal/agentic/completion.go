@@ -0,0 +1,207 @@
+package agentic
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultSchemaName is the name used for schemas without a valid title.
+const defaultSchemaName = "output"
+
+// MessageRole is the author of a message sent to the model.
+type MessageRole string
+
+// List of possible message roles.
+const (
+	// MessageRoleSystem is used for the instructions of the model.
+	MessageRoleSystem MessageRole = "system"
+
+	// MessageRoleUser is used for the content provided by the user.
+	MessageRoleUser MessageRole = "user"
+
+	// MessageRoleAssistant is used for previous answers of the model, like the
+	// examples of a few-shot prompt.
+	MessageRoleAssistant MessageRole = "assistant"
+)
+
+// Message is a prompt message in a format that is easily converted to the
+// request of each model. A message has either a text or an image.
+type Message struct {
+	Role  MessageRole
+	Text  string
+	Image *Image
+}
+
+// Image is an image sent to the model, like an attachment of the task.
+type Image struct {
+	// URI identifies the image, when it was embedded as a resource.
+	URI string
+
+	// MIMEType is the media type of the image (e.g. "image/png").
+	MIMEType string
+
+	// Data is the content of the image.
+	Data []byte
+}
+
+// Base64 returns the content of the image encoded in base64.
+func (i *Image) Base64() string {
+	return base64.StdEncoding.EncodeToString(i.Data)
+}
+
+// DataURL returns the image as a data URL (e.g. "data:image/png;base64,...").
+func (i *Image) DataURL() string {
+	return "data:" + i.MIMEType + ";base64," + i.Base64()
+}
+
+// TextOnly returns the text of the message, replacing the image by a short
+// description. It is used by the models, or the message roles, that don't
+// accept images.
+func (m Message) TextOnly() string {
+	if m.Image == nil {
+		return m.Text
+	}
+	if m.Image.URI != "" {
+		return fmt.Sprintf("[image %s (%s) omitted]", m.Image.URI, m.Image.MIMEType)
+	}
+	return fmt.Sprintf("[image (%s) omitted]", m.Image.MIMEType)
+}
+
+// Messages converts the MCP prompt messages into messages for the model. Text
+// and image contents, and embedded resources, are supported with the system,
+// user or assistant roles. Embedded text resources are converted to text
+// messages identified by their URI, embedded images to image messages, and
+// other binary resources are replaced by a short description.
+func Messages(promptMessages []*mcp.PromptMessage) ([]Message, error) {
+	messages := make([]Message, 0, len(promptMessages))
+	for _, msg := range promptMessages {
+		role := MessageRole(msg.Role)
+		switch role {
+		case MessageRoleSystem, MessageRoleUser, MessageRoleAssistant:
+		default:
+			return nil, fmt.Errorf("unknown prompt message role: %s", msg.Role)
+		}
+
+		message := Message{Role: role}
+		switch content := msg.Content.(type) {
+		case *mcp.TextContent:
+			if content == nil {
+				return nil, fmt.Errorf("nil text content in prompt message")
+			}
+			message.Text = content.Text
+		case *mcp.ImageContent:
+			if content == nil {
+				return nil, fmt.Errorf("nil image content in prompt message")
+			}
+			message.Image = &Image{
+				MIMEType: content.MIMEType,
+				Data:     content.Data,
+			}
+		case *mcp.EmbeddedResource:
+			if content == nil || content.Resource == nil {
+				return nil, fmt.Errorf("nil embedded resource in prompt message")
+			}
+			message = resourceMessage(role, content.Resource)
+		default:
+			return nil, fmt.Errorf("unsupported prompt message content type: %T", msg.Content)
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// resourceMessage converts the embedded resource into a message.
+func resourceMessage(role MessageRole, resource *mcp.ResourceContents) Message {
+	switch {
+	case resource.Blob == nil:
+		return Message{
+			Role: role,
+			Text: fmt.Sprintf("Resource %s:\n%s", resource.URI, resource.Text),
+		}
+	case strings.HasPrefix(resource.MIMEType, "image/"):
+		return Message{
+			Role: role,
+			Image: &Image{
+				URI:      resource.URI,
+				MIMEType: resource.MIMEType,
+				Data:     resource.Blob,
+			},
+		}
+	default:
+		return Message{
+			Role: role,
+			Text: fmt.Sprintf("[resource %s (%s) omitted]", resource.URI, resource.MIMEType),
+		}
+	}
+}
+
+// SchemaName returns a name for the schema, used by the models that require
+// the structured output to be identified. The schema title is used when it
+// only contains letters, digits, underscores or hyphens.
+func SchemaName(schema *jsonschema.Schema) string {
+	if schema == nil || schema.Title == "" {
+		return defaultSchemaName
+	}
+	for _, r := range schema.Title {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' && r != '-' {
+			return defaultSchemaName
+		}
+	}
+	return schema.Title
+}
+
+// StatusError is returned when the API of the model answers with an unexpected
+// status code.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error returns the status code and the body of the response.
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status code: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// OutputError is returned when the output of the model can't be decoded or
+// doesn't follow the schema.
+type OutputError struct {
+	Err error
+}
+
+// Error returns the reason of the invalid output.
+func (e *OutputError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the reason of the invalid output.
+func (e *OutputError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateOutput checks if the model output is a JSON following the schema.
+func ValidateOutput(output string, schema *jsonschema.Schema) (json.RawMessage, error) {
+	output = strings.TrimSpace(output)
+
+	var instance any
+	if err := json.Unmarshal([]byte(output), &instance); err != nil {
+		return nil, &OutputError{Err: fmt.Errorf("invalid JSON output: %w", err)}
+	}
+	if schema != nil {
+		resolved, err := schema.Resolve(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve schema: %w", err)
+		}
+		if err := resolved.Validate(instance); err != nil {
+			return nil, &OutputError{Err: fmt.Errorf("output doesn't follow the schema: %w", err)}
+		}
+	}
+	return json.RawMessage(output), nil
+}
@@ -0,0 +1,290 @@
+package agentic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SplitDSN separates the parameters of the DSN, defined after a "?" with the
+// URL query format (e.g. "model:token?base_url=http://localhost:8080"). Only
+// the allowed parameters are accepted.
+func SplitDSN(dsn string, allowed ...string) (string, url.Values, error) {
+	dsn, rawParameters, found := strings.Cut(dsn, "?")
+	if !found {
+		return dsn, url.Values{}, nil
+	}
+	parameters, err := url.ParseQuery(rawParameters)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid DSN parameters: %w", err)
+	}
+	for name := range parameters {
+		if !slices.Contains(allowed, name) {
+			return "", nil, fmt.Errorf("unknown DSN parameter: %s", name)
+		}
+	}
+	return dsn, parameters, nil
+}
+
+// ParseHeaders parses the HTTP headers defined in the DSN parameters, with the
+// format "Name: Value".
+func ParseHeaders(values []string) (http.Header, error) {
+	headers := make(http.Header, len(values))
+	for _, value := range values {
+		name, headerValue, found := strings.Cut(value, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid header format, expected \"Name: Value\"")
+		}
+		headers.Add(textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(headerValue))
+	}
+	return headers, nil
+}
+
+// HasScheme checks if the DSN has the URL format with the scheme of the
+// provider (e.g. "anthropic://"). The scheme may select the protocol used to
+// reach the API with a suffix (e.g. "ollama+https://").
+func HasScheme(dsn, scheme string) bool {
+	return strings.HasPrefix(dsn, scheme+"://") ||
+		strings.HasPrefix(dsn, scheme+"+http://") ||
+		strings.HasPrefix(dsn, scheme+"+https://")
+}
+
+// URLDSN is a DSN with the URL format:
+//
+//	scheme[+http|+https]://[key@][host[:port]][/path]/model[?parameters]
+type URLDSN struct {
+	// Model is the last segment of the path. Slashes in the model name must be
+	// escaped as %2F.
+	Model string
+
+	// User contains the API key as username, or the credentials of the server.
+	User *url.Userinfo
+
+	// BaseURL is the URL of the API. The host and the path default to the ones
+	// of the default base URL, and the protocol is defined by the scheme
+	// suffix or by the default base URL.
+	BaseURL string
+
+	// Parameters are the optional parameters in the URL query format.
+	Parameters url.Values
+}
+
+// ParseURLDSN parses a DSN with the URL format (see URLDSN). Only the allowed
+// parameters are accepted. When there's no default base URL the host is
+// required, and HTTPS is used unless defined otherwise by the scheme.
+func ParseURLDSN(dsn, defaultBaseURL string, allowed ...string) (URLDSN, error) {
+	parsedURL, err := url.Parse(dsn)
+	if err != nil {
+		// the parse error contains the DSN, which has the API key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return URLDSN{}, fmt.Errorf("invalid DSN format: %w", err)
+	}
+
+	parameters := parsedURL.Query()
+	for name := range parameters {
+		if !slices.Contains(allowed, name) {
+			return URLDSN{}, fmt.Errorf("unknown DSN parameter: %s", name)
+		}
+	}
+
+	path := strings.Trim(parsedURL.EscapedPath(), "/")
+	separator := strings.LastIndex(path, "/")
+	model, err := url.PathUnescape(path[separator+1:])
+	if err != nil {
+		return URLDSN{}, fmt.Errorf("invalid model name in DSN: %w", err)
+	}
+	if model == "" {
+		return URLDSN{}, fmt.Errorf("missing model name in DSN")
+	}
+
+	baseURL := &url.URL{Scheme: "https"}
+	if defaultBaseURL != "" {
+		if baseURL, err = url.Parse(defaultBaseURL); err != nil {
+			return URLDSN{}, fmt.Errorf("invalid default base URL: %w", err)
+		}
+	} else if parsedURL.Host == "" {
+		return URLDSN{}, fmt.Errorf("missing host in DSN")
+	}
+	if _, protocol, found := strings.Cut(parsedURL.Scheme, "+"); found {
+		baseURL.Scheme = protocol
+	}
+	if parsedURL.Host != "" {
+		baseURL.Host = parsedURL.Host
+	}
+	if separator > 0 {
+		if baseURL.Path, err = url.PathUnescape("/" + path[:separator]); err != nil {
+			return URLDSN{}, fmt.Errorf("invalid path in DSN: %w", err)
+		}
+		baseURL.RawPath = ""
+	}
+
+	return URLDSN{
+		Model:      model,
+		User:       parsedURL.User,
+		BaseURL:    baseURL.String(),
+		Parameters: parameters,
+	}, nil
+}
+
+// Tuning contains the settings of the requests to the model defined in the
+// DSN. Nil sampling settings keep the default of the model.
+type Tuning struct {
+	// Temperature controls the randomness of the answers.
+	Temperature *float64
+
+	// TopP limits the tokens sampled to the ones within the probability mass.
+	TopP *float64
+
+	// TopK limits the tokens sampled to the most probable ones.
+	TopK *int64
+
+	// MaxTokens is the maximum number of tokens generated by the model.
+	MaxTokens *int64
+
+	// Seed makes the sampling reproducible, when supported by the model.
+	Seed *int64
+
+	// Timeout limits each attempt to send a request. When zero, only the
+	// context limits the request.
+	Timeout time.Duration
+
+	// Retries is the number of times a request is sent again when the API is
+	// unavailable (transport errors, 5xx and 429 responses).
+	Retries int64
+}
+
+// ParseTuning parses the tuning parameters of the DSN: temperature, top_p,
+// top_k, max_tokens, seed, timeout and retries. Providers only accept the ones
+// they support.
+func ParseTuning(parameters url.Values) (Tuning, error) {
+	var tuning Tuning
+	var errs error
+
+	parseFloat := func(name string, valid func(float64) bool) *float64 {
+		if !parameters.Has(name) {
+			return nil
+		}
+		value, err := strconv.ParseFloat(parameters.Get(name), 64)
+		if err == nil && !valid(value) {
+			err = fmt.Errorf("out of range")
+		}
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid %s: %w", name, err))
+			return nil
+		}
+		return &value
+	}
+	parseInt := func(name string, valid func(int64) bool) *int64 {
+		if !parameters.Has(name) {
+			return nil
+		}
+		value, err := strconv.ParseInt(parameters.Get(name), 10, 64)
+		if err == nil && !valid(value) {
+			err = fmt.Errorf("out of range")
+		}
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid %s: %w", name, err))
+			return nil
+		}
+		return &value
+	}
+
+	tuning.Temperature = parseFloat("temperature", func(v float64) bool { return v >= 0 })
+	tuning.TopP = parseFloat("top_p", func(v float64) bool { return v > 0 && v <= 1 })
+	tuning.TopK = parseInt("top_k", func(v int64) bool { return v > 0 })
+	tuning.MaxTokens = parseInt("max_tokens", func(v int64) bool { return v > 0 })
+	tuning.Seed = parseInt("seed", func(int64) bool { return true })
+	if retries := parseInt("retries", func(v int64) bool { return v >= 0 }); retries != nil {
+		tuning.Retries = *retries
+	}
+	if parameters.Has("timeout") {
+		timeout, err := time.ParseDuration(parameters.Get("timeout"))
+		if err == nil && timeout <= 0 {
+			err = fmt.Errorf("out of range")
+		}
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid timeout: %w", err))
+		}
+		tuning.Timeout = timeout
+	}
+	return tuning, errs
+}
+
+// retryDelay is the wait before the first retry, doubled on each retry.
+var retryDelay = 500 * time.Millisecond
+
+// Send sends the HTTP request with the client, limiting each attempt with the
+// timeout and sending the request again while the API is unavailable. The
+// request body must be replayable (see http.Request.GetBody), which is the
+// case for requests created with a bytes.Buffer.
+func (t Tuning) Send(client *http.Client, request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	delay := retryDelay
+	for attempt := int64(0); ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if t.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, t.Timeout)
+		}
+		attemptRequest := request.Clone(attemptCtx)
+		if attempt > 0 && request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				cancel()
+				return nil, fmt.Errorf("failed to replay request body: %w", err)
+			}
+			attemptRequest.Body = body
+		}
+
+		response, err := client.Do(attemptRequest)
+		retry := attempt < t.Retries && ctx.Err() == nil &&
+			(err != nil || response.StatusCode == http.StatusTooManyRequests ||
+				response.StatusCode >= http.StatusInternalServerError)
+		if !retry {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			// the attempt context must be kept until the body is read
+			response.Body = &cancelBody{ReadCloser: response.Body, cancel: cancel}
+			return response, nil
+		}
+
+		if response != nil {
+			_, _ = io.Copy(io.Discard, response.Body)
+			_ = response.Body.Close()
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// cancelBody releases the context of the request when the response body is
+// closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the context of the request.
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,227 @@
+package agentic_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+func Test_ParseURLDSN(t *testing.T) {
+	tests := []struct {
+		name           string
+		dsn            string
+		defaultBaseURL string
+		expectedDSN    agentic.URLDSN
+		expectedError  string
+	}{{
+		name:           "it should use the default base URL",
+		dsn:            "anthropic://abc123@/claude-sonnet-4-0?max_tokens=2048",
+		defaultBaseURL: "https://api.anthropic.com/v1",
+		expectedDSN: agentic.URLDSN{
+			Model:      "claude-sonnet-4-0",
+			User:       url.User("abc123"),
+			BaseURL:    "https://api.anthropic.com/v1",
+			Parameters: url.Values{"max_tokens": {"2048"}},
+		},
+	}, {
+		name:           "it should replace the host and the path",
+		dsn:            "anthropic+http://abc123@localhost:8080/proxy/v1/claude-sonnet-4-0",
+		defaultBaseURL: "https://api.anthropic.com/v1",
+		expectedDSN: agentic.URLDSN{
+			Model:      "claude-sonnet-4-0",
+			User:       url.User("abc123"),
+			BaseURL:    "http://localhost:8080/proxy/v1",
+			Parameters: url.Values{},
+		},
+	}, {
+		name: "it should unescape the model name",
+		dsn:  "openai-compatible://localhost:8000/v1/meta-llama%2FLlama-3.1-8B-Instruct",
+		expectedDSN: agentic.URLDSN{
+			Model:      "meta-llama/Llama-3.1-8B-Instruct",
+			BaseURL:    "https://localhost:8000/v1",
+			Parameters: url.Values{},
+		},
+	}, {
+		name:          "it should require the host without a default base URL",
+		dsn:           "openai-compatible:///llama3.2",
+		expectedError: "missing host in DSN",
+	}, {
+		name:           "it should require the model",
+		dsn:            "anthropic://abc123@api.anthropic.com/",
+		defaultBaseURL: "https://api.anthropic.com/v1",
+		expectedError:  "missing model name in DSN",
+	}, {
+		name:           "it should reject unknown parameters",
+		dsn:            "anthropic://abc123@/claude-sonnet-4-0?region=eu",
+		defaultBaseURL: "https://api.anthropic.com/v1",
+		expectedError:  "unknown DSN parameter: region",
+	}, {
+		name:           "it should not leak the API key",
+		dsn:            "anthropic://abc123@api.anthropic.com:port/claude-sonnet-4-0",
+		defaultBaseURL: "https://api.anthropic.com/v1",
+		expectedError:  "invalid DSN format",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, err := agentic.ParseURLDSN(tt.dsn, tt.defaultBaseURL, "max_tokens")
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				if strings.Contains(err.Error(), "abc123") {
+					t.Errorf("error leaks the API key: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(dsn, tt.expectedDSN) {
+				t.Errorf("unexpected DSN %+v, expected %+v", dsn, tt.expectedDSN)
+			}
+		})
+	}
+}
+
+func Test_ParseTuning(t *testing.T) {
+	tests := []struct {
+		name           string
+		parameters     string
+		expectedTuning agentic.Tuning
+		expectedError  string
+	}{{
+		name:       "it should parse all parameters",
+		parameters: "temperature=0&top_p=0.9&top_k=40&max_tokens=2048&seed=-1&timeout=30s&retries=2",
+		expectedTuning: agentic.Tuning{
+			Temperature: new(float64(0)),
+			TopP:        new(0.9),
+			TopK:        new(int64(40)),
+			MaxTokens:   new(int64(2048)),
+			Seed:        new(int64(-1)),
+			Timeout:     30 * time.Second,
+			Retries:     2,
+		},
+	}, {
+		name:       "it should keep the defaults without parameters",
+		parameters: "",
+	}, {
+		name:          "it should reject invalid values",
+		parameters:    "temperature=hot&timeout=soon",
+		expectedError: "invalid temperature",
+	}, {
+		name:          "it should reject values out of range",
+		parameters:    "top_p=1.5",
+		expectedError: "invalid top_p: out of range",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parameters, err := url.ParseQuery(tt.parameters)
+			if err != nil {
+				t.Fatalf("failed to parse parameters: %v", err)
+			}
+			tuning, err := agentic.ParseTuning(parameters)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tuning, tt.expectedTuning) {
+				t.Errorf("unexpected tuning %+v, expected %+v", tuning, tt.expectedTuning)
+			}
+		})
+	}
+}
+
+func Test_TuningSend(t *testing.T) {
+	tests := []struct {
+		name             string
+		tuning           agentic.Tuning
+		statuses         []int
+		delay            time.Duration
+		expectedAttempts int64
+		expectedStatus   int
+		expectedError    bool
+	}{{
+		name:             "it should send the request again while the API is unavailable",
+		tuning:           agentic.Tuning{Retries: 1},
+		statuses:         []int{http.StatusTooManyRequests, http.StatusOK},
+		expectedAttempts: 2,
+		expectedStatus:   http.StatusOK,
+	}, {
+		name:             "it should return the last response when the retries are exhausted",
+		tuning:           agentic.Tuning{},
+		statuses:         []int{http.StatusServiceUnavailable},
+		expectedAttempts: 1,
+		expectedStatus:   http.StatusServiceUnavailable,
+	}, {
+		name:             "it should not send rejected requests again",
+		tuning:           agentic.Tuning{Retries: 3},
+		statuses:         []int{http.StatusBadRequest},
+		expectedAttempts: 1,
+		expectedStatus:   http.StatusBadRequest,
+	}, {
+		name:             "it should limit each attempt with the timeout",
+		tuning:           agentic.Tuning{Timeout: 10 * time.Millisecond},
+		statuses:         []int{http.StatusOK},
+		delay:            time.Second,
+		expectedAttempts: 1,
+		expectedError:    true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body bytes.Buffer
+				if _, err := body.ReadFrom(r.Body); err != nil || body.String() != "{}" {
+					t.Errorf("unexpected body %q (%v)", body.String(), err)
+				}
+				attempt := attempts.Add(1)
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(tt.delay):
+				}
+				w.WriteHeader(tt.statuses[min(int(attempt), len(tt.statuses))-1])
+			}))
+			t.Cleanup(server.Close)
+
+			request, err := http.NewRequestWithContext(t.Context(), http.MethodPost, server.URL, bytes.NewBufferString("{}"))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			response, err := tt.tuning.Send(http.DefaultClient, request)
+			if tt.expectedError {
+				if err == nil {
+					_ = response.Body.Close()
+					t.Fatalf("expected an error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				_ = response.Body.Close()
+				if response.StatusCode != tt.expectedStatus {
+					t.Errorf("unexpected status %d, expected %d", response.StatusCode, tt.expectedStatus)
+				}
+			}
+			if attempts := attempts.Load(); attempts != tt.expectedAttempts {
+				t.Errorf("unexpected attempts %d, expected %d", attempts, tt.expectedAttempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+// Package ensemble provides an agentic implementation that combines the
+// answers of multiple models.
+package ensemble
@@ -0,0 +1,324 @@
+package ensemble
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+var (
+	_ agentic.Agentic          = (*ensemble)(nil)
+	_ agentic.HTTPClientSetter = (*ensemble)(nil)
+)
+
+func init() {
+	agentic.Register("ensemble", func() agentic.Agentic {
+		return &ensemble{}
+	})
+}
+
+// strategy defines how the skills and job roles suggested by the models are
+// combined.
+type strategy string
+
+// List of possible strategies.
+const (
+	// strategyMajority keeps the suggestions of more than half of the models,
+	// weighted.
+	strategyMajority strategy = "majority"
+
+	// strategyUnion keeps the suggestions of all models.
+	strategyUnion strategy = "union"
+)
+
+// ensemble queries multiple models in parallel and combines their answers, as
+// defined by the merge of the request context (see agentic.WithMerge). When
+// finding the skills and job roles of a task, the suggestions are voted and the
+// confidence of each suggestion is the weighted agreement between the models.
+// For other requests the answer of the first model is used.
+//
+// Tool calls are not supported, so the ensemble can't be used in agent mode.
+type ensemble struct {
+	members  []member
+	strategy strategy
+	logger   *slog.Logger
+}
+
+// member is a model of the ensemble.
+type member struct {
+	name    string
+	agentic agentic.Agentic
+	weight  float64
+}
+
+// Init initializes the ensemble with the provided DSN. The DSN is a JSON
+// object with the models, and the strategy to combine the skills and job roles
+// (majority or union):
+//
+//	{
+//	  "strategy": "majority",
+//	  "providers": [
+//	    {"name": "anthropic", "dsn": "model:token", "weight": 2},
+//	    {"name": "openai", "dsn": "model:token"}
+//	  ]
+//	}
+//
+// The weight of each model defaults to 1. At least two models are required.
+func (e *ensemble) Init(dsn string, logger *slog.Logger) error {
+	e.logger = logger
+
+	var config struct {
+		Strategy  strategy `json:"strategy"`
+		Providers []struct {
+			Name   string  `json:"name"`
+			DSN    string  `json:"dsn"`
+			Weight float64 `json:"weight"`
+		} `json:"providers"`
+	}
+	if err := json.Unmarshal([]byte(dsn), &config); err != nil {
+		return fmt.Errorf("invalid DSN format: %w", err)
+	}
+
+	switch config.Strategy {
+	case "":
+		e.strategy = strategyMajority
+	case strategyMajority, strategyUnion:
+		e.strategy = config.Strategy
+	default:
+		return fmt.Errorf("unknown strategy: %s", config.Strategy)
+	}
+
+	if len(config.Providers) < 2 {
+		return fmt.Errorf("at least two providers are required")
+	}
+	names := make(map[string]struct{}, len(config.Providers))
+	for i, provider := range config.Providers {
+		if provider.Weight < 0 {
+			return fmt.Errorf("invalid weight for provider %s: %g", provider.Name, provider.Weight)
+		}
+		if provider.Weight == 0 {
+			provider.Weight = 1
+		}
+
+		model, err := agentic.New(provider.Name, provider.DSN, logger)
+		if err != nil {
+			return fmt.Errorf("failed to initialize provider %s: %w", provider.Name, err)
+		}
+
+		name := provider.Name
+		if _, ok := names[name]; ok {
+			name += "-" + strconv.Itoa(i+1)
+		}
+		names[name] = struct{}{}
+
+		e.members = append(e.members, member{
+			name:    name,
+			agentic: model,
+			weight:  provider.Weight,
+		})
+	}
+	return nil
+}
+
+// SetHTTPClient sets the HTTP client of all models that support it.
+func (e *ensemble) SetHTTPClient(client *http.Client) {
+	for _, member := range e.members {
+		if setter, ok := member.agentic.(agentic.HTTPClientSetter); ok {
+			setter.SetHTTPClient(client)
+		}
+	}
+}
+
+// Complete sends the prompt messages to all models in parallel, combining the
+// answers as defined by the merge of the context. Models that fail don't vote,
+// and the request only fails when all of them fail.
+func (e *ensemble) Complete(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	schema *jsonschema.Schema,
+) (json.RawMessage, error) {
+	answers, err := e.ask(ctx, promptMessages, schema)
+	if err != nil {
+		return nil, err
+	}
+	switch merge := agentic.MergeFromContext(ctx); merge {
+	case agentic.MergeFirst:
+		return answers[0].output, nil
+	case agentic.MergeTaskSkillsAndJobRoles:
+		return e.combine(answers)
+	default:
+		return nil, fmt.Errorf("unsupported merge: %s", merge)
+	}
+}
+
+// answer is the output of a model of the ensemble.
+type answer struct {
+	member member
+	output json.RawMessage
+}
+
+// ask sends the prompt messages to all models, returning the answers in the
+// same order of the models.
+func (e *ensemble) ask(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	schema *jsonschema.Schema,
+) ([]answer, error) {
+	outputs := make([]json.RawMessage, len(e.members))
+	errs := make([]error, len(e.members))
+
+	var wg sync.WaitGroup
+	for i, member := range e.members {
+		wg.Go(func() {
+			outputs[i], errs[i] = member.agentic.Complete(ctx, promptMessages, schema)
+		})
+	}
+	wg.Wait()
+
+	var answers []answer
+	for i, member := range e.members {
+		if errs[i] != nil {
+			e.logger.Warn("ensemble model failed",
+				slog.String("provider", member.name),
+				slog.String("error", errs[i].Error()),
+			)
+			errs[i] = fmt.Errorf("%s: %w", member.name, errs[i])
+			continue
+		}
+		answers = append(answers, answer{member: member, output: outputs[i]})
+	}
+	if len(answers) == 0 {
+		return nil, fmt.Errorf("all ensemble models failed: %w", errors.Join(errs...))
+	}
+	return answers, nil
+}
+
+// combine votes the skills and job roles suggested by the models. The models
+// that failed count as disagreeing with every suggestion. The reasoning of the
+// models that agreed with at least one elected suggestion is kept.
+func (e *ensemble) combine(answers []answer) (json.RawMessage, error) {
+	var totalWeight float64
+	for _, member := range e.members {
+		totalWeight += member.weight
+	}
+
+	skillVotes, jobRoleVotes := newVotes(), newVotes()
+	reasonings := make([]string, len(answers))
+	for i, answer := range answers {
+		var output agentic.TaskSkillsAndJobRolesOutput
+		if err := json.Unmarshal(answer.output, &output); err != nil {
+			return nil, &agentic.OutputError{
+				Err: fmt.Errorf("failed to decode %s output: %w", answer.member.name, err),
+			}
+		}
+		skills, jobRoles := output.Suggestions()
+		skillVotes.add(answer.member, skills)
+		jobRoleVotes.add(answer.member, jobRoles)
+		reasonings[i] = output.Reasoning
+	}
+
+	agreeing := make(map[string]bool, len(answers))
+	var combined agentic.TaskSkillsAndJobRolesOutput
+	combined.SkillIDs, combined.SkillConfidences = e.elect("skill", skillVotes, totalWeight, agreeing)
+	combined.JobRoleIDs, combined.JobRoleConfidences = e.elect("jobRole", jobRoleVotes, totalWeight, agreeing)
+
+	var reasoning []string
+	for i, answer := range answers {
+		if agreeing[answer.member.name] && reasonings[i] != "" {
+			reasoning = append(reasoning, answer.member.name+": "+reasonings[i])
+		}
+	}
+	combined.Reasoning = strings.Join(reasoning, "\n")
+
+	output, err := json.Marshal(combined)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode combined output: %w", err)
+	}
+	return output, nil
+}
+
+// elect selects the suggestions according to the strategy, logging the ones
+// that weren't suggested by all models. The confidence of a suggestion is the
+// weighted average of the confidences, where the models that didn't suggest
+// it count as zero.
+func (e *ensemble) elect(
+	kind string,
+	votes *votes,
+	totalWeight float64,
+	agreeing map[string]bool,
+) ([]int64, []agentic.Confidence) {
+	ids := make([]int64, 0, len(votes.order))
+	confidences := make([]agentic.Confidence, 0, len(votes.order))
+	for _, id := range votes.order {
+		vote := votes.byID[id]
+		agreement := vote.weight / totalWeight
+		if agreement < 1 {
+			e.logger.Info("ensemble models disagree",
+				slog.String("kind", kind),
+				slog.Int64("id", id),
+				slog.Float64("agreement", agreement),
+				slog.Any("providers", vote.members),
+			)
+		}
+		if e.strategy == strategyMajority && agreement <= 0.5 {
+			continue
+		}
+		ids = append(ids, id)
+		confidences = append(confidences, agentic.Confidence{
+			ID:         id,
+			Confidence: vote.confidence / totalWeight,
+		})
+		for _, name := range vote.members {
+			agreeing[name] = true
+		}
+	}
+	return ids, confidences
+}
+
+// votes stores the suggestions of the models, in the order they first
+// appeared.
+type votes struct {
+	order []int64
+	byID  map[int64]*vote
+}
+
+// vote is the weighted sum of the models that suggested the same skill or job
+// role.
+type vote struct {
+	weight     float64
+	confidence float64
+	members    []string
+}
+
+func newVotes() *votes {
+	return &votes{
+		byID: make(map[int64]*vote),
+	}
+}
+
+func (v *votes) add(member member, suggestions []agentic.Suggestion) {
+	for _, suggestion := range suggestions {
+		current, ok := v.byID[suggestion.ID]
+		if !ok {
+			current = new(vote)
+			v.byID[suggestion.ID] = current
+			v.order = append(v.order, suggestion.ID)
+		} else if current.members[len(current.members)-1] == member.name {
+			// duplicated suggestion from the same model
+			continue
+		}
+		current.weight += member.weight
+		current.confidence += member.weight * suggestion.Confidence
+		current.members = append(current.members, member.name)
+	}
+}
@@ -0,0 +1,260 @@
+package ensemble_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+	_ "github.com/rafaeljusto/teamwork-ai/internal/agentic/ensemble"
+)
+
+func init() {
+	agentic.Register("static", func() agentic.Agentic {
+		return &static{}
+	})
+}
+
+func Test_FindTaskSkillsAndJobRoles(t *testing.T) {
+	// the models agree on skill 1, and two of three models agree on job roles
+	// 10 and 11
+	providers := `[
+		{"name": "static", "dsn": ` + output([]int64{1, 2}, []int64{10}, "First.") + `},
+		{"name": "static", "dsn": ` + output([]int64{1}, []int64{10, 11}, "Second.") + `},
+		{"name": "static", "dsn": ` + output([]int64{1, 3}, []int64{11}, "Third.") + `}
+	]`
+
+	tests := []struct {
+		name              string
+		dsn               string
+		expectedSkills    []agentic.Suggestion
+		expectedJobRoles  []agentic.Suggestion
+		expectedReasoning string
+		expectedError     string
+	}{{
+		name: "it should keep the suggestions of the majority",
+		dsn:  `{"strategy": "majority", "providers": ` + providers + `}`,
+		expectedSkills: []agentic.Suggestion{
+			{ID: 1, Confidence: 1},
+		},
+		expectedJobRoles: []agentic.Suggestion{
+			{ID: 10, Confidence: 2.0 / 3},
+			{ID: 11, Confidence: 2.0 / 3},
+		},
+		expectedReasoning: "static: First.\nstatic-2: Second.\nstatic-3: Third.",
+	}, {
+		name: "it should keep all suggestions with the agreement as confidence",
+		dsn:  `{"strategy": "union", "providers": ` + providers + `}`,
+		expectedSkills: []agentic.Suggestion{
+			{ID: 1, Confidence: 1},
+			{ID: 2, Confidence: 1.0 / 3},
+			{ID: 3, Confidence: 1.0 / 3},
+		},
+		expectedJobRoles: []agentic.Suggestion{
+			{ID: 10, Confidence: 2.0 / 3},
+			{ID: 11, Confidence: 2.0 / 3},
+		},
+		expectedReasoning: "static: First.\nstatic-2: Second.\nstatic-3: Third.",
+	}, {
+		name: "it should weight the votes of each model",
+		dsn: `{"providers": [
+			{"name": "static", "dsn": ` + output([]int64{1}, []int64{10}, "First.") + `, "weight": 3},
+			{"name": "static", "dsn": ` + output([]int64{2}, []int64{11}, "Second.") + `}
+		]}`,
+		expectedSkills: []agentic.Suggestion{
+			{ID: 1, Confidence: 0.75},
+		},
+		expectedJobRoles: []agentic.Suggestion{
+			{ID: 10, Confidence: 0.75},
+		},
+		expectedReasoning: "static: First.",
+	}, {
+		name: "it should count the models that fail as disagreement",
+		dsn: `{"providers": [
+			{"name": "static", "dsn": "unavailable"},
+			{"name": "static", "dsn": ` + output([]int64{1}, []int64{10}, "Second.") + `}
+		]}`,
+		expectedSkills:   []agentic.Suggestion{},
+		expectedJobRoles: []agentic.Suggestion{},
+	}, {
+		name: "it should keep the suggestions of the models that answer with the union",
+		dsn: `{"strategy": "union", "providers": [
+			{"name": "static", "dsn": "unavailable"},
+			{"name": "static", "dsn": ` + output([]int64{1}, []int64{10}, "Second.") + `}
+		]}`,
+		expectedSkills: []agentic.Suggestion{
+			{ID: 1, Confidence: 0.5},
+		},
+		expectedJobRoles: []agentic.Suggestion{
+			{ID: 10, Confidence: 0.5},
+		},
+		expectedReasoning: "static-2: Second.",
+	}, {
+		name: "it should fail when all models fail",
+		dsn: `{"providers": [
+			{"name": "static", "dsn": "unavailable"},
+			{"name": "static", "dsn": "unavailable"}
+		]}`,
+		expectedError: "all ensemble models failed",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := agentic.New("ensemble", tt.dsn, slog.New(slog.DiscardHandler))
+			if err != nil {
+				t.Fatalf("failed to initialize ensemble: %v", err)
+			}
+
+			skills, jobRoles, reasoning, err := agentic.FindTaskSkillsAndJobRoles(t.Context(), model, nil)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(skills, tt.expectedSkills) {
+				t.Errorf("unexpected skills %v, expected %v", skills, tt.expectedSkills)
+			}
+			if !reflect.DeepEqual(jobRoles, tt.expectedJobRoles) {
+				t.Errorf("unexpected job roles %v, expected %v", jobRoles, tt.expectedJobRoles)
+			}
+			if reasoning != tt.expectedReasoning {
+				t.Errorf("unexpected reasoning %q, expected %q", reasoning, tt.expectedReasoning)
+			}
+		})
+	}
+}
+
+func Test_Complete(t *testing.T) {
+	dsn := `{"providers": [
+		{"name": "static", "dsn": ` + output([]int64{1}, []int64{10}, "First.") + `},
+		{"name": "static", "dsn": ` + output([]int64{2}, []int64{10}, "Second.") + `}
+	]}`
+	model, err := agentic.New("ensemble", dsn, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("failed to initialize ensemble: %v", err)
+	}
+
+	// an equal schema built elsewhere doesn't change how the answers are merged
+	schema, err := jsonschema.For[agentic.TaskSkillsAndJobRolesOutput](nil)
+	if err != nil {
+		t.Fatalf("failed to build schema: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		ctx            context.Context
+		expectedOutput agentic.TaskSkillsAndJobRolesOutput
+	}{{
+		name: "it should use the first answer without a merge",
+		ctx:  t.Context(),
+		expectedOutput: agentic.TaskSkillsAndJobRolesOutput{
+			SkillIDs:   []int64{1},
+			JobRoleIDs: []int64{10},
+			Reasoning:  "First.",
+		},
+	}, {
+		name: "it should vote the skills and job roles when requested",
+		ctx:  agentic.WithMerge(t.Context(), agentic.MergeTaskSkillsAndJobRoles),
+		expectedOutput: agentic.TaskSkillsAndJobRolesOutput{
+			SkillIDs:           []int64{},
+			JobRoleIDs:         []int64{10},
+			SkillConfidences:   []agentic.Confidence{},
+			JobRoleConfidences: []agentic.Confidence{{ID: 10, Confidence: 1}},
+			Reasoning:          "static: First.\nstatic-2: Second.",
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encodedOutput, err := model.Complete(tt.ctx, nil, schema)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var output agentic.TaskSkillsAndJobRolesOutput
+			if err := json.Unmarshal(encodedOutput, &output); err != nil {
+				t.Fatalf("failed to decode output: %v", err)
+			}
+			if !reflect.DeepEqual(output, tt.expectedOutput) {
+				t.Errorf("unexpected output %+v, expected %+v", output, tt.expectedOutput)
+			}
+		})
+	}
+}
+
+func Test_Init(t *testing.T) {
+	tests := []struct {
+		name          string
+		dsn           string
+		expectedError string
+	}{{
+		name:          "it should require at least two providers",
+		dsn:           `{"providers": [{"name": "static", "dsn": "{}"}]}`,
+		expectedError: "at least two providers are required",
+	}, {
+		name:          "it should reject unknown strategies",
+		dsn:           `{"strategy": "random", "providers": []}`,
+		expectedError: "unknown strategy: random",
+	}, {
+		name:          "it should reject unknown providers",
+		dsn:           `{"providers": [{"name": "static", "dsn": "{}"}, {"name": "unknown"}]}`,
+		expectedError: "unknown agentic implementation: unknown",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := agentic.New("ensemble", tt.dsn, slog.New(slog.DiscardHandler))
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+// static answers with the output defined in the DSN, or is unavailable if the
+// DSN is "unavailable".
+type static struct {
+	output string
+}
+
+func (s *static) Init(dsn string, _ *slog.Logger) error {
+	s.output = dsn
+	return nil
+}
+
+func (s *static) Complete(
+	_ context.Context,
+	_ []*mcp.PromptMessage,
+	schema *jsonschema.Schema,
+) (json.RawMessage, error) {
+	if s.output == "unavailable" {
+		return nil, &agentic.StatusError{StatusCode: 503}
+	}
+	return agentic.ValidateOutput(s.output, schema)
+}
+
+// output builds the DSN of a static model answering with the skills, job roles
+// and reasoning.
+func output(skillIDs, jobRoleIDs []int64, reasoning string) string {
+	encodedOutput, err := json.Marshal(agentic.TaskSkillsAndJobRolesOutput{
+		SkillIDs:   skillIDs,
+		JobRoleIDs: jobRoleIDs,
+		Reasoning:  reasoning,
+	})
+	if err != nil {
+		panic(err)
+	}
+	encodedDSN, err := json.Marshal(string(encodedOutput))
+	if err != nil {
+		panic(err)
+	}
+	return string(encodedDSN)
+}
@@ -0,0 +1,159 @@
+package agentic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// metrics stores the number of answers and failures of each provider, and the
+// number of times the next provider was tried. They are exposed with the
+// expvar package.
+var metrics = expvar.NewMap("agentic")
+
+var (
+	_ Completer  = (*Failover)(nil)
+	_ ToolCaller = (*Failover)(nil)
+)
+
+// FailoverProvider is a model tried by the Failover.
+type FailoverProvider struct {
+	// Name identifies the provider in the logs and metrics.
+	Name string
+
+	// Agentic is the initialized model.
+	Agentic Agentic
+
+	// Timeout limits each request to the model. When zero, only the context
+	// limits the request.
+	Timeout time.Duration
+}
+
+// Failover sends the requests to the first provider, trying the next ones
+// when a provider is unavailable (transport errors, 5xx and 429 responses) or
+// answers with an invalid output. Other failures, like a rejected request, are
+// returned without trying the next providers.
+type Failover struct {
+	providers []FailoverProvider
+	logger    *slog.Logger
+}
+
+// NewFailover creates a Failover trying the providers in the given order.
+func NewFailover(providers []FailoverProvider, logger *slog.Logger) *Failover {
+	return &Failover{
+		providers: providers,
+		logger:    logger,
+	}
+}
+
+// Complete sends the prompt messages to the providers, in order, until one of
+// them answers following the JSON schema.
+func (f *Failover) Complete(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	schema *jsonschema.Schema,
+) (json.RawMessage, error) {
+	var output json.RawMessage
+	err := f.try(ctx, func(ctx context.Context, provider FailoverProvider) (err error) {
+		output, err = provider.Agentic.Complete(ctx, promptMessages, schema)
+		return err
+	})
+	return output, err
+}
+
+// CompleteWithTools sends the prompt messages and the previous tool steps to
+// the providers, in order, until one of them requests tool calls or answers
+// following the JSON schema. Providers that can't call tools are ignored.
+func (f *Failover) CompleteWithTools(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	tools []*mcp.Tool,
+	steps []ToolStep,
+	schema *jsonschema.Schema,
+) ([]ToolCall, json.RawMessage, error) {
+	var calls []ToolCall
+	var output json.RawMessage
+	err := f.try(ctx, func(ctx context.Context, provider FailoverProvider) (err error) {
+		toolCaller, ok := provider.Agentic.(ToolCaller)
+		if !ok {
+			return errSkipProvider
+		}
+		calls, output, err = toolCaller.CompleteWithTools(ctx, promptMessages, tools, steps, schema)
+		return err
+	})
+	return calls, output, err
+}
+
+// errSkipProvider informs that the provider can't handle the request.
+var errSkipProvider = errors.New("provider can't handle the request")
+
+func (f *Failover) try(ctx context.Context, fn func(context.Context, FailoverProvider) error) error {
+	var errs []error
+	for i, provider := range f.providers {
+		logger := f.logger.With(
+			slog.String("provider", provider.Name),
+		)
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if provider.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, provider.Timeout)
+		}
+		err := fn(attemptCtx, provider)
+		cancel()
+
+		switch {
+		case err == nil:
+			metrics.Add(provider.Name+".answered", 1)
+			logger.Info("provider answered")
+			return nil
+		case errors.Is(err, errSkipProvider):
+			continue
+		}
+
+		metrics.Add(provider.Name+".failed", 1)
+		if ctx.Err() != nil || !shouldFailover(err) {
+			return err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name, err))
+		if i < len(f.providers)-1 {
+			metrics.Add("failovers", 1)
+			logger.Warn("provider failed, trying the next one",
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return fmt.Errorf("no provider can handle the request")
+	case 1:
+		return errors.Unwrap(errs[0])
+	default:
+		return fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+	}
+}
+
+// shouldFailover checks if the error means that the provider is unavailable
+// or misbehaving, so the next provider should be tried.
+func shouldFailover(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var outputErr *OutputError
+	if errors.As(err, &outputErr) {
+		return true
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,135 @@
+package agentic_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+func Test_Failover(t *testing.T) {
+	tests := []struct {
+		name             string
+		primaryErr       error
+		primaryTimeout   time.Duration
+		secondaryErr     error
+		expectedAnswer   string
+		expectedError    string
+		expectSecondCall bool
+	}{{
+		name:           "it should answer with the primary provider",
+		expectedAnswer: "primary",
+	}, {
+		name:             "it should fail over on server errors",
+		primaryErr:       &agentic.StatusError{StatusCode: 503},
+		expectedAnswer:   "secondary",
+		expectSecondCall: true,
+	}, {
+		name:             "it should fail over when rate limited",
+		primaryErr:       &agentic.StatusError{StatusCode: 429},
+		expectedAnswer:   "secondary",
+		expectSecondCall: true,
+	}, {
+		name:             "it should fail over on transport errors",
+		primaryErr:       &url.Error{Op: "Post", URL: "https://example.com", Err: errors.New("connection refused")},
+		expectedAnswer:   "secondary",
+		expectSecondCall: true,
+	}, {
+		name:             "it should fail over on invalid outputs",
+		primaryErr:       &agentic.OutputError{Err: errors.New("invalid JSON output")},
+		expectedAnswer:   "secondary",
+		expectSecondCall: true,
+	}, {
+		name:             "it should fail over when the attempt times out",
+		primaryTimeout:   time.Millisecond,
+		expectedAnswer:   "secondary",
+		expectSecondCall: true,
+	}, {
+		name:          "it should not fail over on rejected requests",
+		primaryErr:    &agentic.StatusError{StatusCode: 400, Body: "invalid model"},
+		expectedError: "unexpected status code: 400, body: invalid model",
+	}, {
+		name:             "it should fail when all providers fail",
+		primaryErr:       &agentic.StatusError{StatusCode: 500},
+		secondaryErr:     &agentic.StatusError{StatusCode: 502},
+		expectedError:    "all providers failed",
+		expectSecondCall: true,
+	}}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primaryName := fmt.Sprintf("primary-%d", i)
+			secondaryName := fmt.Sprintf("secondary-%d", i)
+
+			// the metrics are global, so only the changes made by this test are
+			// checked
+			answeredMetric := fmt.Sprintf("%s-%d.answered", tt.expectedAnswer, i)
+			answeredBefore := agenticMetric(answeredMetric)
+
+			var secondCall bool
+			failover := agentic.NewFailover([]agentic.FailoverProvider{{
+				Name: primaryName,
+				Agentic: completeFunc(func(ctx context.Context, _ []*mcp.PromptMessage, _ *jsonschema.Schema) (json.RawMessage, error) {
+					if tt.primaryTimeout > 0 {
+						<-ctx.Done()
+						return nil, ctx.Err()
+					}
+					if tt.primaryErr != nil {
+						return nil, tt.primaryErr
+					}
+					return json.RawMessage(`"primary"`), nil
+				}),
+				Timeout: tt.primaryTimeout,
+			}, {
+				Name: secondaryName,
+				Agentic: completeFunc(func(context.Context, []*mcp.PromptMessage, *jsonschema.Schema) (json.RawMessage, error) {
+					secondCall = true
+					if tt.secondaryErr != nil {
+						return nil, tt.secondaryErr
+					}
+					return json.RawMessage(`"secondary"`), nil
+				}),
+			}}, slog.New(slog.DiscardHandler))
+
+			output, err := failover.Complete(t.Context(), nil, nil)
+			if secondCall != tt.expectSecondCall {
+				t.Errorf("expected second call %t, got %t", tt.expectSecondCall, secondCall)
+			}
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(output) != `"`+tt.expectedAnswer+`"` {
+				t.Errorf("unexpected output %s", output)
+			}
+
+			if answered := agenticMetric(answeredMetric) - answeredBefore; answered != 1 {
+				t.Errorf("expected the answer of %s to be recorded, got %d", tt.expectedAnswer, answered)
+			}
+		})
+	}
+}
+
+// agenticMetric returns the current value of the agentic metric, or zero when
+// it wasn't created yet.
+func agenticMetric(name string) int64 {
+	if value, ok := expvar.Get("agentic").(*expvar.Map).Get(name).(*expvar.Int); ok {
+		return value.Value()
+	}
+	return 0
+}
@@ -0,0 +1,3 @@
+// Package fixture provides an agentic implementation that records the answers
+// of a model to files, and replays them later without reaching the model.
+package fixture
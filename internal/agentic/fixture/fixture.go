@@ -0,0 +1,210 @@
+package fixture
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+var (
+	_ agentic.Agentic          = (*fixture)(nil)
+	_ agentic.HTTPClientSetter = (*fixture)(nil)
+)
+
+func init() {
+	agentic.Register("fixture", func() agentic.Agentic {
+		return &fixture{}
+	})
+}
+
+// mode defines if the answers are recorded or replayed.
+type mode string
+
+// List of possible modes.
+const (
+	// modeRecord sends the prompts to a model, storing the answers.
+	modeRecord mode = "record"
+
+	// modeReplay answers with the stored answers, without reaching a model.
+	modeReplay mode = "replay"
+)
+
+// fixture stores the answers of a model in a directory, one file per prompt,
+// named after the hash of the prompt messages and the output schema. The
+// recorded answers are replayed later, allowing to run the server offline with
+// realistic and deterministic answers.
+//
+// Tool calls are not supported, so it can't be used in agent mode.
+type fixture struct {
+	mode     mode
+	dir      string
+	provider agentic.Agentic
+	logger   *slog.Logger
+}
+
+// Init initializes the fixture with the provided DSN. The DSN is a JSON object
+// with the mode (record or replay), the directory of the fixtures and, in
+// record mode, the model that answers the prompts:
+//
+//	{
+//	  "mode": "record",
+//	  "dir": "testdata/fixtures",
+//	  "provider": {"name": "openai", "dsn": "model:token"}
+//	}
+func (f *fixture) Init(dsn string, logger *slog.Logger) error {
+	f.logger = logger
+
+	var config struct {
+		Mode     mode   `json:"mode"`
+		Dir      string `json:"dir"`
+		Provider struct {
+			Name string `json:"name"`
+			DSN  string `json:"dsn"`
+		} `json:"provider"`
+	}
+	if err := json.Unmarshal([]byte(dsn), &config); err != nil {
+		return fmt.Errorf("invalid DSN format: %w", err)
+	}
+	if config.Dir == "" {
+		return fmt.Errorf("missing fixtures directory")
+	}
+	f.mode = config.Mode
+	f.dir = config.Dir
+
+	switch f.mode {
+	case modeRecord:
+		if config.Provider.Name == "" {
+			return fmt.Errorf("missing provider to record")
+		}
+		var err error
+		if f.provider, err = agentic.New(config.Provider.Name, config.Provider.DSN, logger); err != nil {
+			return fmt.Errorf("failed to initialize provider %s: %w", config.Provider.Name, err)
+		}
+		if err := os.MkdirAll(f.dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create fixtures directory: %w", err)
+		}
+	case modeReplay:
+		if _, err := os.Stat(f.dir); err != nil {
+			return fmt.Errorf("failed to open fixtures directory: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown mode: %s", f.mode)
+	}
+	return nil
+}
+
+// SetHTTPClient sets the HTTP client of the recorded model, if it supports it.
+func (f *fixture) SetHTTPClient(client *http.Client) {
+	if setter, ok := f.provider.(agentic.HTTPClientSetter); ok {
+		setter.SetHTTPClient(client)
+	}
+}
+
+// Complete answers with the recorded output of the prompt in replay mode, or
+// sends the prompt to the model and records its output in record mode.
+func (f *fixture) Complete(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	schema *jsonschema.Schema,
+) (json.RawMessage, error) {
+	key, err := hash(promptMessages, schema)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(f.dir, key+".json")
+
+	if f.mode == modeReplay {
+		return f.replay(path, schema)
+	}
+
+	output, err := f.provider.Complete(ctx, promptMessages, schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.record(path, entry{Messages: promptMessages, Output: output}); err != nil {
+		return nil, err
+	}
+	f.logger.Debug("fixture recorded",
+		slog.String("path", path),
+	)
+	return output, nil
+}
+
+// replay reads the output stored in the path, validating it against the schema.
+func (f *fixture) replay(path string, schema *jsonschema.Schema) (json.RawMessage, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no fixture recorded for the prompt: %s not found, record it again", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	var recorded entry
+	if err := json.Unmarshal(content, &recorded); err != nil {
+		return nil, fmt.Errorf("failed to decode fixture %s: %w", path, err)
+	}
+	return agentic.ValidateOutput(string(recorded.Output), schema)
+}
+
+// record stores the entry in the path. The file is replaced atomically, so a
+// concurrent replay never reads a partial fixture.
+func (f *fixture) record(path string, recorded entry) error {
+	content, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fixture: %w", err)
+	}
+	file, err := os.CreateTemp(f.dir, ".fixture-*")
+	if err != nil {
+		return fmt.Errorf("failed to create fixture: %w", err)
+	}
+	defer func() {
+		// after a successful rename the temporary file doesn't exist anymore
+		_ = os.Remove(file.Name())
+	}()
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to store fixture: %w", err)
+	}
+	return nil
+}
+
+// entry is the content of a fixture file. The prompt messages are only stored
+// to make the fixtures easier to review.
+type entry struct {
+	Messages []*mcp.PromptMessage `json:"messages"`
+	Output   json.RawMessage      `json:"output"`
+}
+
+// hash identifies the prompt messages and the output schema.
+func hash(promptMessages []*mcp.PromptMessage, schema *jsonschema.Schema) (string, error) {
+	content, err := json.Marshal(struct {
+		Messages []*mcp.PromptMessage `json:"messages"`
+		Schema   *jsonschema.Schema   `json:"schema"`
+	}{
+		Messages: promptMessages,
+		Schema:   schema,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode prompt: %w", err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
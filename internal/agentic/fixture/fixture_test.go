@@ -0,0 +1,205 @@
+package fixture_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+	_ "github.com/rafaeljusto/teamwork-ai/internal/agentic/fixture"
+)
+
+func init() {
+	agentic.Register("static", func() agentic.Agentic {
+		return &static{}
+	})
+}
+
+func Test_RecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	logger := slog.New(slog.DiscardHandler)
+	output := `{
+		"skillIds": [1],
+		"jobRoleIds": [10],
+		"skillConfidences": [{"id": 1, "confidence": 0.9}],
+		"jobRoleConfidences": null,
+		"reasoning": "The task mentions Go."
+	}`
+
+	recorder, err := agentic.New("fixture", dsn(t, "record", dir, output), logger)
+	if err != nil {
+		t.Fatalf("failed to initialize recorder: %v", err)
+	}
+	recorded, err := recorder.Complete(t.Context(), prompt("Write a Go service."), agentic.TaskSkillsAndJobRolesSchema())
+	if err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+	assertJSON(t, output, string(recorded))
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %v", err)
+	}
+	if len(files) != 1 || !strings.HasSuffix(files[0].Name(), ".json") {
+		t.Fatalf("unexpected fixtures %v", files)
+	}
+
+	tests := []struct {
+		name           string
+		promptMessages []*mcp.PromptMessage
+		schema         *jsonschema.Schema
+		expectedOutput string
+		expectedError  string
+	}{{
+		name:           "it should replay the recorded output",
+		promptMessages: prompt("Write a Go service."),
+		schema:         agentic.TaskSkillsAndJobRolesSchema(),
+		expectedOutput: output,
+	}, {
+		name:           "it should fail when the prompt wasn't recorded",
+		promptMessages: prompt("Write a Rust service."),
+		schema:         agentic.TaskSkillsAndJobRolesSchema(),
+		expectedError:  "no fixture recorded for the prompt",
+	}, {
+		name:           "it should fail when the schema wasn't recorded",
+		promptMessages: prompt("Write a Go service."),
+		schema:         summarySchema(t),
+		expectedError:  "no fixture recorded for the prompt",
+	}}
+
+	replayer, err := agentic.New("fixture", dsn(t, "replay", dir, ""), logger)
+	if err != nil {
+		t.Fatalf("failed to initialize replayer: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := replayer.Complete(t.Context(), tt.promptMessages, tt.schema)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSON(t, tt.expectedOutput, string(output))
+		})
+	}
+}
+
+func Test_Init(t *testing.T) {
+	tests := []struct {
+		name          string
+		dsn           string
+		expectedError string
+	}{{
+		name:          "it should require the directory",
+		dsn:           `{"mode": "replay"}`,
+		expectedError: "missing fixtures directory",
+	}, {
+		name:          "it should reject unknown modes",
+		dsn:           `{"mode": "rewind", "dir": "testdata"}`,
+		expectedError: "unknown mode: rewind",
+	}, {
+		name:          "it should require the provider when recording",
+		dsn:           `{"mode": "record", "dir": "testdata"}`,
+		expectedError: "missing provider to record",
+	}, {
+		name:          "it should require an existing directory when replaying",
+		dsn:           `{"mode": "replay", "dir": "missing"}`,
+		expectedError: "failed to open fixtures directory",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := agentic.New("fixture", tt.dsn, slog.New(slog.DiscardHandler))
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+// static answers with the output defined in the DSN.
+type static struct {
+	output string
+}
+
+func (s *static) Init(dsn string, _ *slog.Logger) error {
+	s.output = dsn
+	return nil
+}
+
+func (s *static) Complete(
+	_ context.Context,
+	_ []*mcp.PromptMessage,
+	schema *jsonschema.Schema,
+) (json.RawMessage, error) {
+	return agentic.ValidateOutput(s.output, schema)
+}
+
+// dsn builds the DSN of the fixture, recording a static model answering with
+// the output.
+func dsn(t *testing.T, mode, dir, output string) string {
+	t.Helper()
+
+	encodedDSN, err := json.Marshal(map[string]any{
+		"mode": mode,
+		"dir":  dir,
+		"provider": map[string]string{
+			"name": "static",
+			"dsn":  output,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode DSN: %v", err)
+	}
+	return string(encodedDSN)
+}
+
+func summarySchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+
+	type summary struct {
+		Summary string `json:"summary" jsonschema:"summary of the task"`
+	}
+	schema, err := jsonschema.For[summary](nil)
+	if err != nil {
+		t.Fatalf("failed to build schema: %v", err)
+	}
+	return schema
+}
+
+func prompt(text string) []*mcp.PromptMessage {
+	return []*mcp.PromptMessage{{
+		Role:    "system",
+		Content: &mcp.TextContent{Text: "You are a project manager."},
+	}, {
+		Role:    "user",
+		Content: &mcp.TextContent{Text: text},
+	}}
+}
+
+func assertJSON(t *testing.T, expected, actual string) {
+	t.Helper()
+
+	var expectedValue, actualValue any
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		t.Errorf("failed to decode expected JSON: %v", err)
+		return
+	}
+	if err := json.Unmarshal([]byte(actual), &actualValue); err != nil {
+		t.Errorf("failed to decode JSON %q: %v", actual, err)
+		return
+	}
+	if !reflect.DeepEqual(expectedValue, actualValue) {
+		t.Errorf("unexpected JSON:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
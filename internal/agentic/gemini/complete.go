@@ -0,0 +1,61 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+// Complete sends the prompt messages to the model, requesting a JSON output
+// that follows the schema. The system messages are sent as the system
+// instruction.
+func (g *gemini) Complete(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	jsonSchema *jsonschema.Schema,
+) (json.RawMessage, error) {
+	if jsonSchema == nil {
+		return nil, fmt.Errorf("missing output schema")
+	}
+	messages, err := agentic.Messages(promptMessages)
+	if err != nil {
+		return nil, err
+	}
+	responseSchema, err := newSchema(jsonSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert output schema: %w", err)
+	}
+
+	var aiRequest request
+	for _, message := range messages {
+		switch message.Role {
+		case agentic.MessageRoleSystem:
+			aiRequest.addSystemMessage(message.TextOnly())
+		case agentic.MessageRoleUser, agentic.MessageRoleAssistant:
+			aiRequest.addMessage(message)
+		}
+	}
+	aiRequest.GenerationConfig = &generationConfig{
+		ResponseMimeType: "application/json",
+		ResponseSchema:   responseSchema,
+		Temperature:      g.tuning.Temperature,
+		TopP:             g.tuning.TopP,
+		TopK:             g.tuning.TopK,
+		MaxOutputTokens:  g.tuning.MaxTokens,
+		Seed:             g.tuning.Seed,
+	}
+
+	aiResponse, err := g.do(ctx, aiRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete: %w", err)
+	}
+	text, err := aiResponse.text()
+	if err != nil {
+		return nil, &agentic.OutputError{Err: fmt.Errorf("failed to read completion: %w", err)}
+	}
+	return agentic.ValidateOutput(text, jsonSchema)
+}
@@ -0,0 +1,2 @@
+// Package gemini provides a client for the Google Gemini API.
+package gemini
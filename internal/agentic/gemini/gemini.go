@@ -0,0 +1,319 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+var (
+	_ agentic.Agentic          = (*gemini)(nil)
+	_ agentic.HTTPClientSetter = (*gemini)(nil)
+)
+
+// defaultBaseURL is the base URL of the Gemini API.
+const defaultBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// imageTypes are the image formats accepted by the model.
+var imageTypes = []string{"image/jpeg", "image/png", "image/webp", "image/heic", "image/heif"}
+
+func init() {
+	agentic.Register("gemini", func() agentic.Agentic {
+		return &gemini{}
+	})
+}
+
+// gemini is the family of models from Google. This specific instance
+// implements all required functions to allow the Teamwork AI agentic
+// implementation, using the generateContent method of the Gemini API.
+//
+// Tool calls are not supported, so it can't be used in agent mode.
+//
+// The API reference is available at:
+// https://ai.google.dev/api/generate-content
+type gemini struct {
+	client   *http.Client
+	endpoint string
+	headers  http.Header
+	logger   *slog.Logger
+	model    string
+	key      string
+	tuning   agentic.Tuning
+}
+
+// Init initializes the Gemini instance with the provided DSN. The DSN must
+// have one of the formats:
+//
+//	`gemini[+http]://key@[host[:port]][/path]/model[?parameters]`
+//	`http[s]://key@host[:port][/path]/model[?parameters]`
+//	`model:key[?parameters]`
+//
+// The model name should be the name of the model to be used (e.g.
+// "gemini-2.5-flash"). The key should be the Gemini API key. With the gemini
+// scheme the host and the path replace the ones of the default base URL, while
+// with the http and https schemes the base URL is the DSN without the key and
+// the model (e.g.
+// https://key@generativelanguage.googleapis.com/v1beta/gemini-2.5-flash). The
+// optional parameters use the URL query format:
+//
+//   - base_url: URL of the API, to use a gateway or a local stand-in.
+//     Defaults to https://generativelanguage.googleapis.com/v1beta.
+//   - header: extra HTTP header with the format "Name: Value". It can be
+//     repeated.
+//   - temperature, top_p, top_k, seed: sampling of the model.
+//   - max_tokens: maximum number of tokens generated.
+//   - timeout: limit of each request (e.g. "30s").
+//   - retries: number of times a request is sent again when the API is
+//     unavailable.
+func (g *gemini) Init(dsn string, logger *slog.Logger) error {
+	g.client = http.DefaultClient
+	g.logger = logger
+
+	allowed := []string{"base_url", "header", "temperature", "top_p", "top_k", "max_tokens", "seed", "timeout", "retries"}
+	baseURL := defaultBaseURL
+	var parameters url.Values
+	if strings.HasPrefix(dsn, "http://") || strings.HasPrefix(dsn, "https://") || agentic.HasScheme(dsn, "gemini") {
+		defaultURL := defaultBaseURL
+		if !agentic.HasScheme(dsn, "gemini") {
+			// the protocol, the host and the path are always defined in the DSN
+			dsn, defaultURL = "gemini+"+dsn, ""
+		}
+		parsedDSN, err := agentic.ParseURLDSN(dsn, defaultURL, allowed...)
+		if err != nil {
+			return err
+		}
+		g.model = parsedDSN.Model
+		g.key = parsedDSN.User.Username()
+		baseURL = parsedDSN.BaseURL
+		parameters = parsedDSN.Parameters
+	} else {
+		var err error
+		if dsn, parameters, err = agentic.SplitDSN(dsn, allowed...); err != nil {
+			return err
+		}
+		var found bool
+		if g.model, g.key, found = strings.Cut(dsn, ":"); !found {
+			return fmt.Errorf("invalid DSN format, expected model:key")
+		}
+	}
+	if g.model == "" {
+		return fmt.Errorf("missing model name in DSN")
+	}
+	if g.key == "" {
+		return fmt.Errorf("missing API key in DSN")
+	}
+
+	if parameters.Has("base_url") {
+		baseURL = parameters.Get("base_url")
+	}
+	var err error
+	if g.endpoint, err = url.JoinPath(baseURL, "models", g.model+":generateContent"); err != nil {
+		return fmt.Errorf("invalid base URL: %w", err)
+	}
+	if g.headers, err = agentic.ParseHeaders(parameters["header"]); err != nil {
+		return err
+	}
+	if g.tuning, err = agentic.ParseTuning(parameters); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetHTTPClient sets the HTTP client used to send the requests.
+func (g *gemini) SetHTTPClient(client *http.Client) {
+	g.client = client
+}
+
+func (g *gemini) do(ctx context.Context, aiRequest request) (response, error) {
+	body, err := json.Marshal(aiRequest)
+	if err != nil {
+		return response{}, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, g.endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return response{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range g.headers {
+		httpRequest.Header[name] = values
+	}
+	httpRequest.Header.Set("x-goog-api-key", g.key)
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	httpResponse, err := g.tuning.Send(g.client, httpRequest)
+	if err != nil {
+		return response{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() {
+		if err := httpResponse.Body.Close(); err != nil {
+			g.logger.Error("failed to close response body",
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		statusErr := &agentic.StatusError{StatusCode: httpResponse.StatusCode}
+		if body, err := io.ReadAll(httpResponse.Body); err == nil {
+			statusErr.Body = errorMessage(body)
+		}
+		return response{}, statusErr
+	}
+
+	var aiResponse response
+	if err = json.NewDecoder(httpResponse.Body).Decode(&aiResponse); err != nil {
+		return response{}, &agentic.OutputError{Err: fmt.Errorf("failed to decode response: %w", err)}
+	}
+	agentic.RecordUsage(ctx, agentic.Usage{
+		Provider:     "gemini",
+		Model:        g.model,
+		InputTokens:  aiResponse.UsageMetadata.PromptTokenCount,
+		OutputTokens: aiResponse.UsageMetadata.CandidatesTokenCount,
+	})
+	return aiResponse, nil
+}
+
+type request struct {
+	SystemInstruction *requestContent   `json:"systemInstruction,omitempty"`
+	Contents          []requestContent  `json:"contents"`
+	GenerationConfig  *generationConfig `json:"generationConfig,omitempty"`
+}
+
+// addSystemMessage adds the text to the system instruction, which is separated
+// from the conversation in the Gemini API.
+func (r *request) addSystemMessage(text string) {
+	if r.SystemInstruction == nil {
+		r.SystemInstruction = new(requestContent)
+	}
+	r.SystemInstruction.Parts = append(r.SystemInstruction.Parts, part{Text: text})
+}
+
+// addMessage adds the message to the user or model turn. Consecutive messages
+// of the same role are sent as multiple parts of the same turn. Images are only
+// sent by the user, in the formats supported by the model; otherwise they are
+// described in the text.
+func (r *request) addMessage(message agentic.Message) {
+	newPart := part{Text: message.TextOnly()}
+	if message.Image != nil && message.Role == agentic.MessageRoleUser &&
+		slices.Contains(imageTypes, message.Image.MIMEType) {
+		newPart = part{
+			InlineData: &inlineData{
+				MimeType: message.Image.MIMEType,
+				Data:     message.Image.Base64(),
+			},
+		}
+	}
+	// The assistant is identified as the model in the Gemini API.
+	role := "user"
+	if message.Role == agentic.MessageRoleAssistant {
+		role = "model"
+	}
+	if last := len(r.Contents) - 1; last >= 0 && r.Contents[last].Role == role {
+		r.Contents[last].Parts = append(r.Contents[last].Parts, newPart)
+		return
+	}
+	r.Contents = append(r.Contents, requestContent{
+		Role:  role,
+		Parts: []part{newPart},
+	})
+}
+
+type requestContent struct {
+	Role  string `json:"role,omitempty"`
+	Parts []part `json:"parts"`
+}
+
+type part struct {
+	Text       string      `json:"text,omitempty"`
+	InlineData *inlineData `json:"inlineData,omitempty"`
+	Thought    bool        `json:"thought,omitempty"`
+}
+
+type inlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type generationConfig struct {
+	ResponseMimeType string   `json:"responseMimeType"`
+	ResponseSchema   *schema  `json:"responseSchema"`
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	TopK             *int64   `json:"topK,omitempty"`
+	MaxOutputTokens  *int64   `json:"maxOutputTokens,omitempty"`
+	Seed             *int64   `json:"seed,omitempty"`
+}
+
+type response struct {
+	Candidates []struct {
+		Content struct {
+			Parts []part `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount     int64 `json:"promptTokenCount"`
+		CandidatesTokenCount int64 `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// text returns the text of the first candidate. The thoughts of the model are
+// ignored.
+func (r *response) text() (string, error) {
+	if r.PromptFeedback.BlockReason != "" {
+		return "", fmt.Errorf("prompt blocked: %s", r.PromptFeedback.BlockReason)
+	}
+	if len(r.Candidates) == 0 {
+		return "", fmt.Errorf("no candidates in response")
+	}
+	candidate := r.Candidates[0]
+	switch candidate.FinishReason {
+	case "", "STOP":
+	case "MAX_TOKENS":
+		return "", fmt.Errorf("response truncated by the token limit")
+	default:
+		return "", fmt.Errorf("response blocked: %s", candidate.FinishReason)
+	}
+
+	var text strings.Builder
+	for _, part := range candidate.Content.Parts {
+		if !part.Thought {
+			text.WriteString(part.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no text in response")
+	}
+	return text.String(), nil
+}
+
+// errorResponse is the body of the failed requests.
+type errorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// errorMessage extracts the error status and message from the body of a failed
+// request. If the body doesn't follow the error schema, it is returned as is.
+func errorMessage(body []byte) string {
+	var errResponse errorResponse
+	if err := json.Unmarshal(body, &errResponse); err != nil || errResponse.Error.Status == "" {
+		return string(body)
+	}
+	return errResponse.Error.Status + ": " + errResponse.Error.Message
+}
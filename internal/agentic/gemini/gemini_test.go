@@ -0,0 +1,284 @@
+package gemini
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+func Test_Complete(t *testing.T) {
+	expectedRequest := `{
+		"systemInstruction": {"parts": [{"text": "You are a project manager."}]},
+		"contents": [{
+			"role": "user",
+			"parts": [{"text": "List the IDs."}, {"text": "Only the open ones."}]
+		}],
+		"generationConfig": {
+			"responseMimeType": "application/json",
+			"responseSchema": {
+				"type": "OBJECT",
+				"properties": {
+					"ids": {"type": "ARRAY", "nullable": true, "items": {"type": "INTEGER"}, "description": "IDs of the items"}
+				},
+				"propertyOrdering": ["ids"],
+				"required": ["ids"]
+			}
+		}
+	}`
+
+	tests := []struct {
+		name           string
+		responseStatus int
+		responseBody   string
+		expectedOutput string
+		expectedUsage  []agentic.Usage
+		expectedError  string
+	}{{
+		name:           "it should request a structured output",
+		responseStatus: http.StatusOK,
+		responseBody: `{
+			"candidates": [{
+				"content": {"role": "model", "parts": [
+					{"text": "The task mentions Go.", "thought": true},
+					{"text": "{\"ids\":"},
+					{"text": "[1,2]}"}
+				]},
+				"finishReason": "STOP"
+			}],
+			"usageMetadata": {"promptTokenCount": 80, "candidatesTokenCount": 9, "totalTokenCount": 89}
+		}`,
+		expectedOutput: `{"ids":[1,2]}`,
+		expectedUsage: []agentic.Usage{{
+			Provider:     "gemini",
+			Model:        "gemini-2.5-flash",
+			InputTokens:  80,
+			OutputTokens: 9,
+		}},
+	}, {
+		name:           "it should fail when the response is truncated",
+		responseStatus: http.StatusOK,
+		responseBody: `{
+			"candidates": [{
+				"content": {"role": "model", "parts": [{"text": "{\"ids\": [1,"}]},
+				"finishReason": "MAX_TOKENS"
+			}]
+		}`,
+		expectedError: "response truncated by the token limit",
+	}, {
+		name:           "it should fail when the response is blocked",
+		responseStatus: http.StatusOK,
+		responseBody: `{
+			"candidates": [{"content": {"parts": []}, "finishReason": "SAFETY"}]
+		}`,
+		expectedError: "response blocked: SAFETY",
+	}, {
+		name:           "it should fail when the prompt is blocked",
+		responseStatus: http.StatusOK,
+		responseBody:   `{"promptFeedback": {"blockReason": "PROHIBITED_CONTENT"}}`,
+		expectedError:  "prompt blocked: PROHIBITED_CONTENT",
+	}, {
+		name:           "it should fail when the output doesn't follow the schema",
+		responseStatus: http.StatusOK,
+		responseBody: `{
+			"candidates": [{
+				"content": {"role": "model", "parts": [{"text": "{\"ids\": \"1\"}"}]},
+				"finishReason": "STOP"
+			}]
+		}`,
+		expectedError: "output doesn't follow the schema",
+	}, {
+		name:           "it should describe the errors of the API",
+		responseStatus: http.StatusTooManyRequests,
+		responseBody: `{
+			"error": {"code": 429, "message": "Resource has been exhausted.", "status": "RESOURCE_EXHAUSTED"}
+		}`,
+		expectedError: "RESOURCE_EXHAUSTED: Resource has been exhausted.",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1beta/models/gemini-2.5-flash:generateContent" {
+					t.Errorf("unexpected path %q", r.URL.Path)
+				}
+				if r.Header.Get("x-goog-api-key") != "abc123" {
+					t.Errorf("unexpected API key header %q", r.Header.Get("x-goog-api-key"))
+				}
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("failed to read request body: %v", err)
+					return
+				}
+				assertJSON(t, expectedRequest, string(body))
+
+				w.WriteHeader(tt.responseStatus)
+				_, _ = w.Write([]byte(tt.responseBody))
+			}))
+			t.Cleanup(server.Close)
+
+			var model gemini
+			dsn := "gemini-2.5-flash:abc123?base_url=" + server.URL + "/v1beta"
+			if err := model.Init(dsn, slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("failed to initialize: %v", err)
+			}
+
+			ctx, recorder := agentic.WithUsageRecorder(t.Context())
+			output, err := model.Complete(ctx, []*mcp.PromptMessage{{
+				Role:    "system",
+				Content: &mcp.TextContent{Text: "You are a project manager."},
+			}, {
+				Role:    "user",
+				Content: &mcp.TextContent{Text: "List the IDs."},
+			}, {
+				Role:    "user",
+				Content: &mcp.TextContent{Text: "Only the open ones."},
+			}}, answerSchema(t))
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSON(t, tt.expectedOutput, string(output))
+			if usages := recorder.Usages(); !reflect.DeepEqual(usages, tt.expectedUsage) {
+				t.Errorf("unexpected usage %v, expected %v", usages, tt.expectedUsage)
+			}
+		})
+	}
+}
+
+func Test_Init(t *testing.T) {
+	tests := []struct {
+		name             string
+		dsn              string
+		expectedModel    string
+		expectedEndpoint string
+		expectedHeaders  http.Header
+		expectedTuning   agentic.Tuning
+		expectedError    string
+	}{{
+		name:             "it should use the default endpoint",
+		dsn:              "gemini-2.5-flash:abc123",
+		expectedModel:    "gemini-2.5-flash",
+		expectedEndpoint: "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent",
+		expectedHeaders:  http.Header{},
+	}, {
+		name:             "it should override the endpoint and add headers",
+		dsn:              "gemini-2.5-pro:abc123?base_url=https://gateway.example.com/google/v1&header=X-Team:%20ai",
+		expectedModel:    "gemini-2.5-pro",
+		expectedEndpoint: "https://gateway.example.com/google/v1/models/gemini-2.5-pro:generateContent",
+		expectedHeaders:  http.Header{"X-Team": []string{"ai"}},
+	}, {
+		name:             "it should accept the URL format",
+		dsn:              "https://abc123@generativelanguage.googleapis.com/v1beta/gemini-2.5-flash",
+		expectedModel:    "gemini-2.5-flash",
+		expectedEndpoint: "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent",
+		expectedHeaders:  http.Header{},
+	}, {
+		name:             "it should accept the URL format without path",
+		dsn:              "http://abc123@localhost:8080/gemini-2.5-flash",
+		expectedModel:    "gemini-2.5-flash",
+		expectedEndpoint: "http://localhost:8080/models/gemini-2.5-flash:generateContent",
+		expectedHeaders:  http.Header{},
+	}, {
+		name:             "it should accept the gemini scheme with tuning parameters",
+		dsn:              "gemini://abc123@/gemini-2.5-flash?temperature=0&seed=42&max_tokens=2048&timeout=30s",
+		expectedModel:    "gemini-2.5-flash",
+		expectedEndpoint: "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent",
+		expectedHeaders:  http.Header{},
+		expectedTuning: agentic.Tuning{
+			Temperature: new(float64(0)),
+			MaxTokens:   new(int64(2048)),
+			Seed:        new(int64(42)),
+			Timeout:     30 * time.Second,
+		},
+	}, {
+		name:          "it should require the API key",
+		dsn:           "https://generativelanguage.googleapis.com/v1beta/gemini-2.5-flash",
+		expectedError: "missing API key in DSN",
+	}, {
+		name:          "it should reject an invalid format",
+		dsn:           "gemini-2.5-flash",
+		expectedError: "invalid DSN format, expected model:key",
+	}, {
+		name:          "it should reject unknown parameters",
+		dsn:           "gemini-2.5-flash:abc123?deployment=gemini",
+		expectedError: "unknown DSN parameter: deployment",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var model gemini
+			err := model.Init(tt.dsn, slog.New(slog.DiscardHandler))
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if model.model != tt.expectedModel {
+				t.Errorf("unexpected model %q", model.model)
+			}
+			if model.key != "abc123" {
+				t.Errorf("unexpected key %q", model.key)
+			}
+			if model.endpoint != tt.expectedEndpoint {
+				t.Errorf("unexpected endpoint %q", model.endpoint)
+			}
+			if !reflect.DeepEqual(model.headers, tt.expectedHeaders) {
+				t.Errorf("unexpected headers %v", model.headers)
+			}
+			if !reflect.DeepEqual(model.tuning, tt.expectedTuning) {
+				t.Errorf("unexpected tuning %+v, expected %+v", model.tuning, tt.expectedTuning)
+			}
+		})
+	}
+}
+
+func answerSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+
+	type answer struct {
+		IDs []int64 `json:"ids" jsonschema:"IDs of the items"`
+	}
+	schema, err := jsonschema.For[answer](nil)
+	if err != nil {
+		t.Fatalf("failed to build schema: %v", err)
+	}
+	schema.Title = "answer"
+	return schema
+}
+
+func assertJSON(t *testing.T, expected, actual string) {
+	t.Helper()
+
+	var expectedValue, actualValue any
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		t.Errorf("failed to decode expected JSON: %v", err)
+		return
+	}
+	if err := json.Unmarshal([]byte(actual), &actualValue); err != nil {
+		t.Errorf("failed to decode JSON %q: %v", actual, err)
+		return
+	}
+	if !reflect.DeepEqual(expectedValue, actualValue) {
+		t.Errorf("unexpected JSON:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
@@ -0,0 +1,100 @@
+package gemini
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// schema is the subset of the OpenAPI schema accepted by Gemini to define the
+// structured output.
+//
+// https://ai.google.dev/api/caching#Schema
+type schema struct {
+	Type             string             `json:"type"`
+	Format           string             `json:"format,omitempty"`
+	Description      string             `json:"description,omitempty"`
+	Nullable         bool               `json:"nullable,omitempty"`
+	Enum             []string           `json:"enum,omitempty"`
+	Items            *schema            `json:"items,omitempty"`
+	MinItems         *int               `json:"minItems,omitempty"`
+	MaxItems         *int               `json:"maxItems,omitempty"`
+	Minimum          *float64           `json:"minimum,omitempty"`
+	Maximum          *float64           `json:"maximum,omitempty"`
+	Properties       map[string]*schema `json:"properties,omitempty"`
+	PropertyOrdering []string           `json:"propertyOrdering,omitempty"`
+	Required         []string           `json:"required,omitempty"`
+	AnyOf            []*schema          `json:"anyOf,omitempty"`
+}
+
+// newSchema converts the JSON schema to the Gemini schema. Types combined with
+// "null" are converted to nullable types, and keywords without an equivalent,
+// like additionalProperties, are ignored. References aren't supported.
+func newSchema(jsonSchema *jsonschema.Schema) (*schema, error) {
+	if jsonSchema.Ref != "" {
+		return nil, fmt.Errorf("unsupported schema reference: %s", jsonSchema.Ref)
+	}
+
+	s := &schema{
+		Format:           jsonSchema.Format,
+		Description:      jsonSchema.Description,
+		MinItems:         jsonSchema.MinItems,
+		MaxItems:         jsonSchema.MaxItems,
+		Minimum:          jsonSchema.Minimum,
+		Maximum:          jsonSchema.Maximum,
+		PropertyOrdering: jsonSchema.PropertyOrder,
+		Required:         jsonSchema.Required,
+	}
+
+	types := jsonSchema.Types
+	if jsonSchema.Type != "" {
+		types = []string{jsonSchema.Type}
+	}
+	if slices.Contains(types, "null") {
+		s.Nullable = true
+		types = slices.DeleteFunc(slices.Clone(types), func(t string) bool { return t == "null" })
+	}
+	switch len(types) {
+	case 0:
+		if len(jsonSchema.AnyOf) == 0 {
+			return nil, fmt.Errorf("missing schema type")
+		}
+	case 1:
+		s.Type = strings.ToUpper(types[0])
+	default:
+		return nil, fmt.Errorf("unsupported multiple schema types: %s", strings.Join(types, ", "))
+	}
+
+	for _, value := range jsonSchema.Enum {
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("unsupported non-string enum value: %v", value)
+		}
+		s.Enum = append(s.Enum, text)
+	}
+
+	var err error
+	if jsonSchema.Items != nil {
+		if s.Items, err = newSchema(jsonSchema.Items); err != nil {
+			return nil, err
+		}
+	}
+	if len(jsonSchema.Properties) > 0 {
+		s.Properties = make(map[string]*schema, len(jsonSchema.Properties))
+		for name, property := range jsonSchema.Properties {
+			if s.Properties[name], err = newSchema(property); err != nil {
+				return nil, fmt.Errorf("invalid property %s: %w", name, err)
+			}
+		}
+	}
+	for _, subschema := range jsonSchema.AnyOf {
+		converted, err := newSchema(subschema)
+		if err != nil {
+			return nil, err
+		}
+		s.AnyOf = append(s.AnyOf, converted)
+	}
+	return s, nil
+}
@@ -0,0 +1,78 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+// Complete sends the prompt messages to the model, requesting an output that
+// follows the JSON schema. The schema is enforced by the structured outputs of
+// the chat API.
+func (o *ollama) Complete(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	schema *jsonschema.Schema,
+) (json.RawMessage, error) {
+	_, output, err := o.CompleteWithTools(ctx, promptMessages, nil, nil, schema)
+	return output, err
+}
+
+// CompleteWithTools sends the prompt messages and the previous tool steps to
+// the model, exposing the tools as functions. The model either requests tool
+// calls or answers following the JSON schema.
+func (o *ollama) CompleteWithTools(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	tools []*mcp.Tool,
+	steps []agentic.ToolStep,
+	schema *jsonschema.Schema,
+) ([]agentic.ToolCall, json.RawMessage, error) {
+	if schema == nil {
+		return nil, nil, fmt.Errorf("missing output schema")
+	}
+	messages, err := agentic.Messages(promptMessages)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var aiRequest request
+	aiRequest.Model = o.model
+	aiRequest.setTuning(o.tuning)
+	aiRequest.Format = schema
+	for _, message := range messages {
+		switch message.Role {
+		case agentic.MessageRoleSystem:
+			aiRequest.addSystemMessage(message.TextOnly())
+		case agentic.MessageRoleUser, agentic.MessageRoleAssistant:
+			aiRequest.addMessage(message)
+		}
+	}
+	for _, tool := range tools {
+		aiRequest.addTool(tool)
+	}
+	for _, step := range steps {
+		aiRequest.addToolStep(step)
+	}
+
+	aiResponse, err := o.do(ctx, aiRequest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to complete: %w", err)
+	}
+	if calls := aiResponse.toolCalls(); len(calls) > 0 {
+		return calls, nil, nil
+	}
+	text, err := aiResponse.text()
+	if err != nil {
+		return nil, nil, &agentic.OutputError{Err: fmt.Errorf("failed to read completion: %w", err)}
+	}
+	output, err := agentic.ValidateOutput(text, schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, output, nil
+}
@@ -4,19 +4,36 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
 
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
 )
 
-var _ agentic.Agentic = (*ollama)(nil)
+var (
+	_ agentic.Agentic          = (*ollama)(nil)
+	_ agentic.ToolCaller       = (*ollama)(nil)
+	_ agentic.HTTPClientSetter = (*ollama)(nil)
+)
+
+// defaultServer is the URL of a local Ollama server.
+const defaultServer = "http://localhost:11434"
+
+// imageTypes are the image formats accepted by the vision models.
+var imageTypes = []string{"image/jpeg", "image/png"}
 
 func init() {
-	agentic.Register("ollama", &ollama{})
+	agentic.Register("ollama", func() agentic.Agentic {
+		return &ollama{}
+	})
 }
 
 // ollama is an open-source, cross-platform framework that simplifies running
@@ -31,38 +48,83 @@ type ollama struct {
 	client *http.Client
 	model  string
 	logger *slog.Logger
+	tuning agentic.Tuning
 }
 
 // Init initializes the Ollama instance with the provided DSN. The DSN must have
-// the format:
+// one of the formats:
 //
-//	`http[s]://[username[:password]@]host[:port]/model`.
+//	`ollama[+https]://[username[:password]@][host[:port]][/path]/model[?parameters]`
+//	`http[s]://[username[:password]@]host[:port]/model[?parameters]`
 //
 // The server URL should point to the Ollama base URL, and the model name should
-// be the name of the model to be used (e.g. "llama3.2").
+// be the name of the model to be used (e.g. "llama3.2"). With the ollama
+// scheme the server defaults to http://localhost:11434, and slashes in the
+// model name must be escaped as %2F. The optional parameters use the URL query
+// format:
 //
-// TODO(rafaeljusto): Add support for custom HTTP client.
+//   - temperature, top_p, top_k, seed: sampling of the model.
+//   - max_tokens: maximum number of tokens generated.
+//   - timeout: limit of each request (e.g. "30s").
+//   - retries: number of times a request is sent again when the server is
+//     unavailable.
 func (o *ollama) Init(dsn string, logger *slog.Logger) error {
 	o.client = http.DefaultClient
 	o.logger = logger
 
-	parsedURL, err := url.Parse(dsn)
-	if err != nil {
-		return fmt.Errorf("failed to parse DSN: %w", err)
-	}
-	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return fmt.Errorf("invalid scheme: %s", parsedURL.Scheme)
-	}
-	if parsedURL.Path == "" {
-		return fmt.Errorf("missing model name in DSN")
+	allowed := []string{"temperature", "top_p", "top_k", "max_tokens", "seed", "timeout", "retries"}
+	var parameters url.Values
+	if agentic.HasScheme(dsn, "ollama") {
+		parsedDSN, err := agentic.ParseURLDSN(dsn, defaultServer, allowed...)
+		if err != nil {
+			return err
+		}
+		serverURL, err := url.Parse(parsedDSN.BaseURL)
+		if err != nil {
+			return fmt.Errorf("invalid server URL: %w", err)
+		}
+		serverURL.User = parsedDSN.User
+		o.model = parsedDSN.Model
+		o.server = serverURL.String()
+		parameters = parsedDSN.Parameters
+	} else {
+		var err error
+		if dsn, parameters, err = agentic.SplitDSN(dsn, allowed...); err != nil {
+			return err
+		}
+		parsedURL, err := url.Parse(dsn)
+		if err != nil {
+			// the parse error contains the DSN, which may have credentials
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return fmt.Errorf("failed to parse DSN: %w", err)
+		}
+		if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+			return fmt.Errorf("invalid scheme: %s", parsedURL.Scheme)
+		}
+		if parsedURL.Path == "" {
+			return fmt.Errorf("missing model name in DSN")
+		}
+		o.model = parsedURL.Path[1:]
+
+		parsedURL.Path = ""
+		o.server = parsedURL.String()
 	}
-	o.model = parsedURL.Path[1:]
 
-	parsedURL.Path = ""
-	o.server = parsedURL.String()
+	var err error
+	if o.tuning, err = agentic.ParseTuning(parameters); err != nil {
+		return err
+	}
 	return nil
 }
 
+// SetHTTPClient sets the HTTP client used to send the requests.
+func (o *ollama) SetHTTPClient(client *http.Client) {
+	o.client = client
+}
+
 func (o *ollama) do(ctx context.Context, aiRequest request) (response, error) {
 	body, err := json.Marshal(aiRequest)
 	if err != nil {
@@ -80,7 +142,7 @@ func (o *ollama) do(ctx context.Context, aiRequest request) (response, error) {
 	}
 	httpRequest.Header.Set("Content-Type", "application/json")
 
-	httpResponse, err := o.client.Do(httpRequest)
+	httpResponse, err := o.tuning.Send(o.client, httpRequest)
 	if err != nil {
 		return response{}, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -93,23 +155,57 @@ func (o *ollama) do(ctx context.Context, aiRequest request) (response, error) {
 	}()
 
 	if httpResponse.StatusCode != http.StatusOK {
+		statusErr := &agentic.StatusError{StatusCode: httpResponse.StatusCode}
 		if body, err := io.ReadAll(httpResponse.Body); err == nil {
-			return response{}, fmt.Errorf("unexpected status code: %d, body: %s", httpResponse.StatusCode, string(body))
+			statusErr.Body = string(body)
 		}
-		return response{}, fmt.Errorf("unexpected status code: %d", httpResponse.StatusCode)
+		return response{}, statusErr
 	}
 
 	var aiResponse response
 	if err = json.NewDecoder(httpResponse.Body).Decode(&aiResponse); err != nil {
-		return response{}, fmt.Errorf("failed to decode response: %w", err)
+		return response{}, &agentic.OutputError{Err: fmt.Errorf("failed to decode response: %w", err)}
 	}
+	agentic.RecordUsage(ctx, agentic.Usage{
+		Provider:     "ollama",
+		Model:        o.model,
+		InputTokens:  aiResponse.PromptEvalCount,
+		OutputTokens: aiResponse.EvalCount,
+	})
 	return aiResponse, nil
 }
 
 type request struct {
-	Model    string           `json:"model"`
-	Messages []requestMessage `json:"messages"`
-	Stream   bool             `json:"stream"`
+	Model    string             `json:"model"`
+	Messages []requestMessage   `json:"messages"`
+	Tools    []tool             `json:"tools,omitempty"`
+	Stream   bool               `json:"stream"`
+	Format   *jsonschema.Schema `json:"format,omitempty"`
+	Options  *options           `json:"options,omitempty"`
+}
+
+// setTuning applies the sampling settings defined in the DSN.
+func (r *request) setTuning(tuning agentic.Tuning) {
+	if tuning.Temperature == nil && tuning.TopP == nil && tuning.TopK == nil &&
+		tuning.MaxTokens == nil && tuning.Seed == nil {
+		return
+	}
+	r.Options = &options{
+		Temperature: tuning.Temperature,
+		TopP:        tuning.TopP,
+		TopK:        tuning.TopK,
+		NumPredict:  tuning.MaxTokens,
+		Seed:        tuning.Seed,
+	}
+}
+
+// options are the parameters of the model.
+type options struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	TopK        *int64   `json:"top_k,omitempty"`
+	NumPredict  *int64   `json:"num_predict,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
 }
 
 func (r *request) addSystemMessage(content string) {
@@ -119,25 +215,118 @@ func (r *request) addSystemMessage(content string) {
 	})
 }
 
-func (r *request) addUserMessage(content string) {
+// addMessage adds the message of the user or of the assistant. Images are only
+// sent by the user, in the formats supported by the model; otherwise they are
+// described in the text.
+func (r *request) addMessage(message agentic.Message) {
+	if message.Image != nil && message.Role == agentic.MessageRoleUser &&
+		slices.Contains(imageTypes, message.Image.MIMEType) {
+		r.Messages = append(r.Messages, requestMessage{
+			Role:   "user",
+			Images: []string{message.Image.Base64()},
+		})
+		return
+	}
 	r.Messages = append(r.Messages, requestMessage{
-		Role:    "user",
-		Content: content,
+		Role:    string(message.Role),
+		Content: message.TextOnly(),
+	})
+}
+
+// addTool allows the model to call the MCP tool.
+func (r *request) addTool(mcpTool *mcp.Tool) {
+	r.Tools = append(r.Tools, tool{
+		Type: "function",
+		Function: toolFunction{
+			Name:        mcpTool.Name,
+			Description: mcpTool.Description,
+			Parameters:  mcpTool.InputSchema,
+		},
+	})
+}
+
+// addToolStep adds the tool calls requested by the model, followed by their
+// results.
+func (r *request) addToolStep(step agentic.ToolStep) {
+	toolCalls := make([]toolCall, 0, len(step.Calls))
+	for _, call := range step.Calls {
+		toolCalls = append(toolCalls, toolCall{
+			Function: toolCallFunction{
+				Name:      call.Name,
+				Arguments: call.Arguments,
+			},
+		})
+	}
+	r.Messages = append(r.Messages, requestMessage{
+		Role:      "assistant",
+		ToolCalls: toolCalls,
 	})
+
+	for i, result := range step.Results {
+		content := result.Content
+		if result.IsError {
+			content = "Error: " + content
+		}
+		r.Messages = append(r.Messages, requestMessage{
+			Role:     "tool",
+			Content:  content,
+			ToolName: step.Calls[i].Name,
+		})
+	}
 }
 
 type requestMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []toolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+}
+
+type tool struct {
+	Type     string       `json:"type"`
+	Function toolFunction `json:"function"`
+}
+
+type toolFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters"`
+}
+
+type toolCall struct {
+	Function toolCallFunction `json:"function"`
+}
+
+type toolCallFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
 }
 
 type response struct {
 	Message struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
+		Role      string     `json:"role"`
+		Content   string     `json:"content"`
+		ToolCalls []toolCall `json:"tool_calls"`
 	} `json:"message"`
+	PromptEvalCount int64 `json:"prompt_eval_count"`
+	EvalCount       int64 `json:"eval_count"`
+}
+
+// toolCalls returns the tool calls requested by the model. Ollama doesn't
+// identify the calls, so they are identified by their position.
+func (r *response) toolCalls() []agentic.ToolCall {
+	var calls []agentic.ToolCall
+	for i, call := range r.Message.ToolCalls {
+		calls = append(calls, agentic.ToolCall{
+			ID:        "call_" + strconv.Itoa(i),
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	return calls
 }
 
-func (r *response) decode(target any) error {
-	return json.Unmarshal([]byte(r.Message.Content), target)
+func (r *response) text() (string, error) {
+	return r.Message.Content, nil
 }
@@ -8,15 +8,31 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
 )
 
-var _ agentic.Agentic = (*openai)(nil)
+var (
+	_ agentic.Agentic          = (*openai)(nil)
+	_ agentic.ToolCaller       = (*openai)(nil)
+	_ agentic.HTTPClientSetter = (*openai)(nil)
+)
+
+// defaultBaseURL is the base URL of the OpenAI API.
+const defaultBaseURL = "https://api.openai.com/v1"
+
+// imageTypes are the image formats accepted by the model.
+var imageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
 
 func init() {
-	agentic.Register("openai", &openai{})
+	agentic.Register("openai", func() agentic.Agentic {
+		return &openai{}
+	})
 }
 
 // openai is an american company that provides a suite of AI tools and services.
@@ -30,49 +46,142 @@ func init() {
 // The API reference is available at:
 // https://platform.openai.com/docs/api-reference/introduction
 type openai struct {
-	client *http.Client
-	logger *slog.Logger
-	model  string
-	token  string
+	client   *http.Client
+	endpoint string
+	headers  http.Header
+	apiKey   bool
+	logger   *slog.Logger
+	model    string
+	token    string
+	tuning   agentic.Tuning
 }
 
 // Init initializes the OpenAI instance with the provided DSN. The DSN must have
-// the format:
+// one of the formats:
 //
-//	`model:token`.
+//	`openai[+http]://token@[host[:port]][/path]/model[?parameters]`
+//	`model:token[?parameters]`
 //
 // The model name should be the name of the model to be used (e.g.
-// "gpt-3.5-turbo"). The token should be the OpenAI API key.
+// "gpt-3.5-turbo"). The token should be the OpenAI API key. In the URL format
+// the host and the path replace the ones of the default base URL (e.g.
+// openai://token@example.openai.azure.com/openai/gpt-4o). The optional
+// parameters use the URL query format:
 //
-// TODO(rafaeljusto): Add support for custom HTTP client.
+//   - base_url: URL of the API, to use a gateway or a compatible server.
+//     Defaults to https://api.openai.com/v1.
+//   - header: extra HTTP header with the format "Name: Value". It can be
+//     repeated.
+//   - deployment: Azure OpenAI deployment, added to the path of the base URL.
+//   - api_version: Azure OpenAI API version, sent in the api-version query.
+//   - auth: "bearer" (default) sends the token in the Authorization header,
+//     while "api-key" sends it in the api-key header required by Azure OpenAI.
+//   - temperature, top_p: sampling of the model.
+//   - max_tokens: maximum number of tokens generated.
+//   - timeout: limit of each request (e.g. "30s").
+//   - retries: number of times a request is sent again when the API is
+//     unavailable.
+//
+// For example, to use an Azure OpenAI deployment:
+//
+//	gpt-4o:token?base_url=https://example.openai.azure.com/openai&deployment=gpt-4o&api_version=2025-04-01-preview&auth=api-key
 func (o *openai) Init(dsn string, logger *slog.Logger) error {
 	o.client = http.DefaultClient
 	o.logger = logger
 
-	dsnParts := strings.Split(dsn, ":")
-	if len(dsnParts) != 2 {
-		return fmt.Errorf("invalid DSN format: %s", dsn)
+	allowed := []string{
+		"base_url", "header", "deployment", "api_version", "auth",
+		"temperature", "top_p", "max_tokens", "timeout", "retries",
+	}
+	baseURL := defaultBaseURL
+	var parameters url.Values
+	if agentic.HasScheme(dsn, "openai") {
+		parsedDSN, err := agentic.ParseURLDSN(dsn, defaultBaseURL, allowed...)
+		if err != nil {
+			return err
+		}
+		o.model = parsedDSN.Model
+		o.token = parsedDSN.User.Username()
+		baseURL = parsedDSN.BaseURL
+		parameters = parsedDSN.Parameters
+	} else {
+		var err error
+		if dsn, parameters, err = agentic.SplitDSN(dsn, allowed...); err != nil {
+			return err
+		}
+		dsnParts := strings.Split(dsn, ":")
+		if len(dsnParts) != 2 {
+			return fmt.Errorf("invalid DSN format, expected model:token")
+		}
+		o.model = dsnParts[0]
+		o.token = dsnParts[1]
+	}
+	if o.token == "" {
+		return fmt.Errorf("missing token in DSN")
+	}
+
+	if parameters.Has("base_url") {
+		baseURL = parameters.Get("base_url")
+	}
+	path := []string{"responses"}
+	if deployment := parameters.Get("deployment"); deployment != "" {
+		path = []string{"deployments", deployment, "responses"}
+	}
+	endpointURL, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL: %w", err)
+	}
+	endpointURL = endpointURL.JoinPath(path...)
+	if apiVersion := parameters.Get("api_version"); apiVersion != "" {
+		query := endpointURL.Query()
+		query.Set("api-version", apiVersion)
+		endpointURL.RawQuery = query.Encode()
+	}
+	o.endpoint = endpointURL.String()
+
+	if o.headers, err = agentic.ParseHeaders(parameters["header"]); err != nil {
+		return err
+	}
+	if o.tuning, err = agentic.ParseTuning(parameters); err != nil {
+		return err
+	}
+
+	switch auth := parameters.Get("auth"); auth {
+	case "", "bearer":
+	case "api-key":
+		o.apiKey = true
+	default:
+		return fmt.Errorf("unknown auth: %s", auth)
 	}
-	o.model = dsnParts[0]
-	o.token = dsnParts[1]
 	return nil
 }
 
+// SetHTTPClient sets the HTTP client used to send the requests.
+func (o *openai) SetHTTPClient(client *http.Client) {
+	o.client = client
+}
+
 func (o *openai) do(ctx context.Context, aiRequest request) (response, error) {
 	body, err := json.Marshal(aiRequest)
 	if err != nil {
 		return response{}, fmt.Errorf("failed to encode request: %w", err)
 	}
 
-	url := "https://api.openai.com/v1/responses"
-	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint, bytes.NewBuffer(body))
 	if err != nil {
 		return response{}, fmt.Errorf("failed to create request: %w", err)
 	}
-	httpRequest.Header.Set("Authorization", "Bearer "+o.token)
+	for name, values := range o.headers {
+		httpRequest.Header[name] = values
+	}
+	if o.apiKey {
+		httpRequest.Header.Set("api-key", o.token)
+	} else {
+		httpRequest.Header.Set("Authorization", "Bearer "+o.token)
+	}
 	httpRequest.Header.Set("Content-Type", "application/json")
 
-	httpResponse, err := o.client.Do(httpRequest)
+	httpResponse, err := o.tuning.Send(o.client, httpRequest)
 	if err != nil {
 		return response{}, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -85,22 +194,55 @@ func (o *openai) do(ctx context.Context, aiRequest request) (response, error) {
 	}()
 
 	if httpResponse.StatusCode != http.StatusOK {
+		statusErr := &agentic.StatusError{StatusCode: httpResponse.StatusCode}
 		if body, err := io.ReadAll(httpResponse.Body); err == nil {
-			return response{}, fmt.Errorf("unexpected status code: %d, body: %s", httpResponse.StatusCode, string(body))
+			statusErr.Body = string(body)
 		}
-		return response{}, fmt.Errorf("unexpected status code: %d", httpResponse.StatusCode)
+		return response{}, statusErr
 	}
 
 	var aiResponse response
 	if err = json.NewDecoder(httpResponse.Body).Decode(&aiResponse); err != nil {
-		return response{}, fmt.Errorf("failed to decode response: %w", err)
+		return response{}, &agentic.OutputError{Err: fmt.Errorf("failed to decode response: %w", err)}
 	}
+	agentic.RecordUsage(ctx, agentic.Usage{
+		Provider:     "openai",
+		Model:        o.model,
+		InputTokens:  aiResponse.Usage.InputTokens,
+		OutputTokens: aiResponse.Usage.OutputTokens,
+	})
 	return aiResponse, nil
 }
 
 type request struct {
-	Model    string           `json:"model"`
-	Messages []requestMessage `json:"input"`
+	Model string `json:"model"`
+	// Messages contains input items with different formats: requestMessage,
+	// requestFunctionCall and requestFunctionCallOutput.
+	Messages        []any        `json:"input"`
+	Tools           []tool       `json:"tools,omitempty"`
+	Text            *requestText `json:"text,omitempty"`
+	Temperature     *float64     `json:"temperature,omitempty"`
+	TopP            *float64     `json:"top_p,omitempty"`
+	MaxOutputTokens *int64       `json:"max_output_tokens,omitempty"`
+}
+
+// setTuning applies the sampling settings defined in the DSN.
+func (r *request) setTuning(tuning agentic.Tuning) {
+	r.Temperature = tuning.Temperature
+	r.TopP = tuning.TopP
+	r.MaxOutputTokens = tuning.MaxTokens
+}
+
+// setSchema requests a structured output following the JSON schema.
+func (r *request) setSchema(name string, schema *jsonschema.Schema) {
+	r.Text = &requestText{
+		Format: requestTextFormat{
+			Type:   "json_schema",
+			Name:   name,
+			Schema: schema,
+			Strict: true,
+		},
+	}
 }
 
 func (r *request) addSystemMessage(content string) {
@@ -110,46 +252,176 @@ func (r *request) addSystemMessage(content string) {
 	})
 }
 
-func (r *request) addUserMessage(content string) {
+// addMessage adds the message of the user or of the assistant. Images are only
+// sent by the user, in the formats supported by the model; otherwise they are
+// described in the text.
+func (r *request) addMessage(message agentic.Message) {
+	if message.Image != nil && message.Role == agentic.MessageRoleUser &&
+		slices.Contains(imageTypes, message.Image.MIMEType) {
+		r.Messages = append(r.Messages, requestMessage{
+			Role: "user",
+			Content: []requestContent{{
+				Type:     "input_image",
+				ImageURL: message.Image.DataURL(),
+			}},
+		})
+		return
+	}
 	r.Messages = append(r.Messages, requestMessage{
-		Role:    "user",
-		Content: content,
+		Role:    string(message.Role),
+		Content: message.TextOnly(),
+	})
+}
+
+// addTool allows the model to call the MCP tool. The MCP input schemas don't
+// follow the restrictions of the strict mode, so it is disabled.
+func (r *request) addTool(mcpTool *mcp.Tool) {
+	r.Tools = append(r.Tools, tool{
+		Type:        "function",
+		Name:        mcpTool.Name,
+		Description: mcpTool.Description,
+		Parameters:  mcpTool.InputSchema,
+		Strict:      false,
 	})
 }
 
+// addToolStep adds the function calls requested by the model, followed by
+// their outputs.
+func (r *request) addToolStep(step agentic.ToolStep) {
+	for _, call := range step.Calls {
+		r.Messages = append(r.Messages, requestFunctionCall{
+			Type:      "function_call",
+			CallID:    call.ID,
+			Name:      call.Name,
+			Arguments: string(call.Arguments),
+		})
+	}
+	for i, result := range step.Results {
+		output := result.Content
+		if result.IsError {
+			output = "Error: " + output
+		}
+		r.Messages = append(r.Messages, requestFunctionCallOutput{
+			Type:   "function_call_output",
+			CallID: step.Calls[i].ID,
+			Output: output,
+		})
+	}
+}
+
 type requestMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role string `json:"role"`
+	// Content is the text of the message, or a list of requestContent.
+	Content any `json:"content"`
+}
+
+type requestContent struct {
+	Type     string `json:"type"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+type requestFunctionCall struct {
+	Type      string `json:"type"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type requestFunctionCallOutput struct {
+	Type   string `json:"type"`
+	CallID string `json:"call_id"`
+	Output string `json:"output"`
+}
+
+type tool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters"`
+	Strict      bool   `json:"strict"`
+}
+
+type requestText struct {
+	Format requestTextFormat `json:"format"`
+}
+
+type requestTextFormat struct {
+	Type   string             `json:"type"`
+	Name   string             `json:"name"`
+	Schema *jsonschema.Schema `json:"schema"`
+	Strict bool               `json:"strict"`
 }
 
 type response struct {
+	Status            string `json:"status"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
 	Output []output `json:"output"`
+	Usage  struct {
+		InputTokens  int64 `json:"input_tokens"`
+		OutputTokens int64 `json:"output_tokens"`
+	} `json:"usage"`
 }
 
-func (r *response) decode(target any) error {
-	if len(r.Output) == 0 {
-		return fmt.Errorf("no outputs in response")
+// text returns the text of the message outputs. Other outputs, like the
+// reasoning of the model, are ignored.
+func (r *response) text() (string, error) {
+	if r.Status == "incomplete" {
+		if r.IncompleteDetails != nil {
+			return "", fmt.Errorf("incomplete response: %s", r.IncompleteDetails.Reason)
+		}
+		return "", fmt.Errorf("incomplete response")
 	}
-	if len(r.Output) > 1 {
-		return fmt.Errorf("multiple outputs in response")
+
+	var text strings.Builder
+	for _, output := range r.Output {
+		if output.Type != "message" {
+			continue
+		}
+		for _, content := range output.Content {
+			switch content.Type {
+			case "output_text":
+				text.WriteString(content.Text)
+			case "refusal":
+				return "", fmt.Errorf("model refused to answer: %s", content.Refusal)
+			}
+		}
 	}
-	if len(r.Output[0].Content) == 0 {
-		return fmt.Errorf("no content in output")
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no text in response")
 	}
-	if len(r.Output[0].Content) > 1 {
-		return fmt.Errorf("multiple contents in output")
+	return text.String(), nil
+}
+
+// toolCalls returns the function calls requested by the model.
+func (r *response) toolCalls() []agentic.ToolCall {
+	var calls []agentic.ToolCall
+	for _, output := range r.Output {
+		if output.Type != "function_call" {
+			continue
+		}
+		calls = append(calls, agentic.ToolCall{
+			ID:        output.CallID,
+			Name:      output.Name,
+			Arguments: json.RawMessage(output.Arguments),
+		})
 	}
-	return json.Unmarshal([]byte(r.Output[0].Content[0].Text), target)
+	return calls
 }
 
 type output struct {
-	Type    string    `json:"type"`
-	Status  string    `json:"status"`
-	Role    string    `json:"role"`
-	Content []content `json:"content"`
+	Type      string    `json:"type"`
+	Status    string    `json:"status"`
+	Role      string    `json:"role"`
+	Content   []content `json:"content"`
+	CallID    string    `json:"call_id"`
+	Name      string    `json:"name"`
+	Arguments string    `json:"arguments"`
 }
 
 type content struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type    string `json:"type"`
+	Text    string `json:"text"`
+	Refusal string `json:"refusal"`
 }
@@ -0,0 +1,541 @@
+package openai
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+func Test_Complete(t *testing.T) {
+	tests := []struct {
+		name           string
+		responseStatus int
+		responseBody   string
+		expectedOutput string
+		expectedUsage  []agentic.Usage
+		expectedError  string
+	}{{
+		name:           "it should request a structured output",
+		responseStatus: http.StatusOK,
+		responseBody: `{
+			"status": "completed",
+			"output": [{
+				"type": "reasoning",
+				"summary": []
+			}, {
+				"type": "message",
+				"status": "completed",
+				"role": "assistant",
+				"content": [{"type": "output_text", "text": "{\"ids\":[1,2]}"}]
+			}],
+			"usage": {"input_tokens": 120, "output_tokens": 15, "total_tokens": 135}
+		}`,
+		expectedOutput: `{"ids":[1,2]}`,
+		expectedUsage: []agentic.Usage{{
+			Provider:     "openai",
+			Model:        "gpt-4o",
+			InputTokens:  120,
+			OutputTokens: 15,
+		}},
+	}, {
+		name:           "it should fail when the model refuses to answer",
+		responseStatus: http.StatusOK,
+		responseBody: `{
+			"status": "completed",
+			"output": [{
+				"type": "message",
+				"role": "assistant",
+				"content": [{"type": "refusal", "refusal": "I can't help with that."}]
+			}]
+		}`,
+		expectedError: "model refused to answer: I can't help with that.",
+	}, {
+		name:           "it should fail when the response is incomplete",
+		responseStatus: http.StatusOK,
+		responseBody: `{
+			"status": "incomplete",
+			"incomplete_details": {"reason": "max_output_tokens"},
+			"output": []
+		}`,
+		expectedError: "incomplete response: max_output_tokens",
+	}, {
+		name:           "it should fail when the output doesn't follow the schema",
+		responseStatus: http.StatusOK,
+		responseBody: `{
+			"status": "completed",
+			"output": [{
+				"type": "message",
+				"role": "assistant",
+				"content": [{"type": "output_text", "text": "{\"ids\":\"1\"}"}]
+			}]
+		}`,
+		expectedError: "output doesn't follow the schema",
+	}, {
+		name:           "it should fail when the API returns an error",
+		responseStatus: http.StatusBadRequest,
+		responseBody:   `{"error": {"message": "Invalid schema"}}`,
+		expectedError:  "unexpected status code: 400",
+	}}
+
+	expectedRequest := `{
+		"model": "gpt-4o",
+		"input": [
+			{"role": "system", "content": "You are a project manager."},
+			{"role": "user", "content": "List the IDs."}
+		],
+		"text": {
+			"format": {
+				"type": "json_schema",
+				"name": "answer",
+				"schema": {
+					"type": "object",
+					"title": "answer",
+					"properties": {
+						"ids": {"type": ["null", "array"], "items": {"type": "integer"}, "description": "IDs of the items"}
+					},
+					"required": ["ids"],
+					"additionalProperties": false
+				},
+				"strict": true
+			}
+		}
+	}`
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer abc123" {
+					t.Errorf("unexpected authorization header %q", r.Header.Get("Authorization"))
+				}
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("failed to read request body: %v", err)
+					return
+				}
+				assertJSON(t, expectedRequest, string(body))
+
+				w.WriteHeader(tt.responseStatus)
+				_, _ = w.Write([]byte(tt.responseBody))
+			}))
+			t.Cleanup(server.Close)
+
+			var model openai
+			if err := model.Init("gpt-4o:abc123", slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("failed to initialize: %v", err)
+			}
+			model.endpoint = server.URL
+
+			ctx, recorder := agentic.WithUsageRecorder(t.Context())
+			output, err := model.Complete(ctx, []*mcp.PromptMessage{{
+				Role:    "system",
+				Content: &mcp.TextContent{Text: "You are a project manager."},
+			}, {
+				Role:    "user",
+				Content: &mcp.TextContent{Text: "List the IDs."},
+			}}, answerSchema(t))
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSON(t, tt.expectedOutput, string(output))
+			if usages := recorder.Usages(); !reflect.DeepEqual(usages, tt.expectedUsage) {
+				t.Errorf("unexpected usage %v, expected %v", usages, tt.expectedUsage)
+			}
+		})
+	}
+}
+
+func answerSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+
+	type answer struct {
+		IDs []int64 `json:"ids" jsonschema:"IDs of the items"`
+	}
+	schema, err := jsonschema.For[answer](nil)
+	if err != nil {
+		t.Fatalf("failed to build schema: %v", err)
+	}
+	schema.Title = "answer"
+	return schema
+}
+
+func assertJSON(t *testing.T, expected, actual string) {
+	t.Helper()
+
+	var expectedValue, actualValue any
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		t.Errorf("failed to decode expected JSON: %v", err)
+		return
+	}
+	if err := json.Unmarshal([]byte(actual), &actualValue); err != nil {
+		t.Errorf("failed to decode JSON %q: %v", actual, err)
+		return
+	}
+	if !reflect.DeepEqual(expectedValue, actualValue) {
+		t.Errorf("unexpected JSON:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func Test_CompleteWithTools(t *testing.T) {
+	expectedRequest := `{
+		"model": "gpt-4o",
+		"input": [
+			{"role": "user", "content": "List the IDs."},
+			{"type": "function_call", "call_id": "call_1", "name": "get_comments", "arguments": "{\"taskId\":1}"},
+			{"type": "function_call", "call_id": "call_2", "name": "delete_task", "arguments": "{}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "Needs a Go developer."},
+			{"type": "function_call_output", "call_id": "call_2", "output": "Error: tool not available"}
+		],
+		"tools": [{
+			"type": "function",
+			"name": "get_comments",
+			"description": "Comments of a task.",
+			"parameters": {"type": "object", "properties": {"taskId": {"type": "integer"}}},
+			"strict": false
+		}],
+		"text": {
+			"format": {
+				"type": "json_schema",
+				"name": "answer",
+				"schema": {
+					"type": "object",
+					"title": "answer",
+					"properties": {
+						"ids": {"type": ["null", "array"], "items": {"type": "integer"}, "description": "IDs of the items"}
+					},
+					"required": ["ids"],
+					"additionalProperties": false
+				},
+				"strict": true
+			}
+		}
+	}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request body: %v", err)
+			return
+		}
+		assertJSON(t, expectedRequest, string(body))
+
+		_, _ = w.Write([]byte(`{
+			"status": "completed",
+			"output": [{
+				"type": "function_call",
+				"call_id": "call_3",
+				"name": "get_comments",
+				"arguments": "{\"taskId\":2}"
+			}]
+		}`))
+	}))
+	t.Cleanup(server.Close)
+
+	var model openai
+	if err := model.Init("gpt-4o:abc123", slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	model.endpoint = server.URL
+
+	calls, output, err := model.CompleteWithTools(t.Context(), []*mcp.PromptMessage{{
+		Role:    "user",
+		Content: &mcp.TextContent{Text: "List the IDs."},
+	}}, []*mcp.Tool{{
+		Name:        "get_comments",
+		Description: "Comments of a task.",
+		InputSchema: map[string]any{"type": "object", "properties": map[string]any{"taskId": map[string]any{"type": "integer"}}},
+	}}, []agentic.ToolStep{{
+		Calls: []agentic.ToolCall{
+			{ID: "call_1", Name: "get_comments", Arguments: json.RawMessage(`{"taskId":1}`)},
+			{ID: "call_2", Name: "delete_task", Arguments: json.RawMessage(`{}`)},
+		},
+		Results: []agentic.ToolResult{
+			{Content: "Needs a Go developer."},
+			{Content: "tool not available", IsError: true},
+		},
+	}}, answerSchema(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output != nil {
+		t.Errorf("unexpected output %s", output)
+	}
+	expectedCalls := []agentic.ToolCall{{ID: "call_3", Name: "get_comments", Arguments: json.RawMessage(`{"taskId":2}`)}}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("unexpected calls %+v, expected %+v", calls, expectedCalls)
+	}
+}
+
+func Test_Init(t *testing.T) {
+	tests := []struct {
+		name             string
+		dsn              string
+		expectedEndpoint string
+		expectedHeaders  http.Header
+		expectedAPIKey   bool
+		expectedError    string
+	}{{
+		name:             "it should use the OpenAI API by default",
+		dsn:              "gpt-4o:abc123",
+		expectedEndpoint: "https://api.openai.com/v1/responses",
+		expectedHeaders:  http.Header{},
+	}, {
+		name:             "it should use the base URL and the extra headers",
+		dsn:              "gpt-4o:abc123?base_url=http://localhost:8080/v1&header=X-Team: ai&header=X-Env: test",
+		expectedEndpoint: "http://localhost:8080/v1/responses",
+		expectedHeaders:  http.Header{"X-Team": {"ai"}, "X-Env": {"test"}},
+	}, {
+		name: "it should use an Azure OpenAI deployment",
+		dsn: "gpt-4o:abc123?base_url=https://example.openai.azure.com/openai" +
+			"&deployment=gpt-4o&api_version=2025-04-01-preview&auth=api-key",
+		expectedEndpoint: "https://example.openai.azure.com/openai/deployments/gpt-4o/responses" +
+			"?api-version=2025-04-01-preview",
+		expectedHeaders: http.Header{},
+		expectedAPIKey:  true,
+	}, {
+		name:          "it should reject unknown parameters",
+		dsn:           "gpt-4o:abc123?region=eu",
+		expectedError: "unknown DSN parameter: region",
+	}, {
+		name:          "it should reject unknown auth modes",
+		dsn:           "gpt-4o:abc123?auth=basic",
+		expectedError: "unknown auth: basic",
+	}, {
+		name:          "it should reject invalid headers",
+		dsn:           "gpt-4o:abc123?header=X-Team",
+		expectedError: "invalid header format",
+	}, {
+		name:             "it should accept the URL format",
+		dsn:              "openai://abc123@example.openai.azure.com/openai/gpt-4o?deployment=gpt-4o&auth=api-key",
+		expectedEndpoint: "https://example.openai.azure.com/openai/deployments/gpt-4o/responses",
+		expectedHeaders:  http.Header{},
+		expectedAPIKey:   true,
+	}, {
+		name:          "it should reject tuning parameters not supported by the API",
+		dsn:           "openai://abc123@/gpt-4o?seed=42",
+		expectedError: "unknown DSN parameter: seed",
+	}, {
+		name:          "it should not leak the token in an invalid DSN",
+		dsn:           "gpt-4o:abc:123",
+		expectedError: "invalid DSN format, expected model:token",
+	}, {
+		name:          "it should require the token",
+		dsn:           "openai:///gpt-4o",
+		expectedError: "missing token in DSN",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var model openai
+			err := model.Init(tt.dsn, slog.New(slog.DiscardHandler))
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				if strings.Contains(err.Error(), "123") {
+					t.Errorf("error leaks the token: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if model.endpoint != tt.expectedEndpoint {
+				t.Errorf("unexpected endpoint %q, expected %q", model.endpoint, tt.expectedEndpoint)
+			}
+			if !reflect.DeepEqual(model.headers, tt.expectedHeaders) {
+				t.Errorf("unexpected headers %v, expected %v", model.headers, tt.expectedHeaders)
+			}
+			if model.apiKey != tt.expectedAPIKey {
+				t.Errorf("unexpected API key mode %t", model.apiKey)
+			}
+		})
+	}
+}
+
+func Test_CompleteAzure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/gpt-4o/responses" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if apiVersion := r.URL.Query().Get("api-version"); apiVersion != "2025-04-01-preview" {
+			t.Errorf("unexpected API version %q", apiVersion)
+		}
+		if r.Header.Get("api-key") != "abc123" {
+			t.Errorf("unexpected api-key header %q", r.Header.Get("api-key"))
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("unexpected authorization header %q", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("X-Team") != "ai" {
+			t.Errorf("unexpected X-Team header %q", r.Header.Get("X-Team"))
+		}
+		_, _ = w.Write([]byte(`{
+			"status": "completed",
+			"output": [{
+				"type": "message",
+				"role": "assistant",
+				"content": [{"type": "output_text", "text": "{\"ids\":[1]}"}]
+			}]
+		}`))
+	}))
+	t.Cleanup(server.Close)
+
+	var model openai
+	err := model.Init("gpt-4o:abc123?base_url="+server.URL+"/openai"+
+		"&deployment=gpt-4o&api_version=2025-04-01-preview&auth=api-key&header=X-Team: ai",
+		slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	output, err := model.Complete(t.Context(), []*mcp.PromptMessage{{
+		Role:    "user",
+		Content: &mcp.TextContent{Text: "List the IDs."},
+	}}, answerSchema(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertJSON(t, `{"ids":[1]}`, string(output))
+}
+
+func Test_CompleteTuning(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body struct {
+			Temperature     *float64 `json:"temperature"`
+			TopP            *float64 `json:"top_p"`
+			MaxOutputTokens *int64   `json:"max_output_tokens"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if body.Temperature == nil || *body.Temperature != 0 {
+			t.Errorf("unexpected temperature %v", body.Temperature)
+		}
+		if body.TopP == nil || *body.TopP != 0.9 {
+			t.Errorf("unexpected top_p %v", body.TopP)
+		}
+		if body.MaxOutputTokens == nil || *body.MaxOutputTokens != 512 {
+			t.Errorf("unexpected max_output_tokens %v", body.MaxOutputTokens)
+		}
+		_, _ = w.Write([]byte(`{
+			"status": "completed",
+			"output": [{
+				"type": "message",
+				"role": "assistant",
+				"content": [{"type": "output_text", "text": "{\"ids\":[1]}"}]
+			}]
+		}`))
+	}))
+	t.Cleanup(server.Close)
+
+	var model openai
+	dsn := strings.Replace(server.URL, "http://", "openai+http://abc123@", 1) +
+		"/v1/gpt-4o?temperature=0&top_p=0.9&max_tokens=512&timeout=5s&retries=1"
+	if err := model.Init(dsn, slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+
+	output, err := model.Complete(t.Context(), []*mcp.PromptMessage{{
+		Role:    "user",
+		Content: &mcp.TextContent{Text: "List the IDs."},
+	}}, answerSchema(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertJSON(t, `{"ids":[1]}`, string(output))
+	if attempts != 2 {
+		t.Errorf("unexpected number of attempts %d", attempts)
+	}
+}
+
+func Test_CompleteMultimodal(t *testing.T) {
+	expectedInput := `[
+		{"role": "system", "content": "You are a project manager."},
+		{"role": "user", "content": "Task: add a login page."},
+		{"role": "assistant", "content": "{\"ids\":[1]}"},
+		{"role": "user", "content": [{"type": "input_image", "image_url": "data:image/png;base64,cG5n"}]},
+		{"role": "user", "content": "Resource file:///spec.md:\nUse Go."},
+		{"role": "user", "content": "[image file:///diagram.bmp (image/bmp) omitted]"}
+	]`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input json.RawMessage `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		assertJSON(t, expectedInput, string(body.Input))
+
+		_, _ = w.Write([]byte(`{
+			"status": "completed",
+			"output": [{
+				"type": "message",
+				"role": "assistant",
+				"content": [{"type": "output_text", "text": "{\"ids\":[1]}"}]
+			}]
+		}`))
+	}))
+	t.Cleanup(server.Close)
+
+	var model openai
+	if err := model.Init("gpt-4o:abc123", slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("failed to initialize: %v", err)
+	}
+	model.endpoint = server.URL
+
+	output, err := model.Complete(t.Context(), multimodalPrompt(), answerSchema(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertJSON(t, `{"ids":[1]}`, string(output))
+}
+
+// multimodalPrompt is a few-shot prompt with an image and embedded resources.
+func multimodalPrompt() []*mcp.PromptMessage {
+	return []*mcp.PromptMessage{{
+		Role:    "system",
+		Content: &mcp.TextContent{Text: "You are a project manager."},
+	}, {
+		Role:    "user",
+		Content: &mcp.TextContent{Text: "Task: add a login page."},
+	}, {
+		Role:    "assistant",
+		Content: &mcp.TextContent{Text: `{"ids":[1]}`},
+	}, {
+		Role:    "user",
+		Content: &mcp.ImageContent{MIMEType: "image/png", Data: []byte("png")},
+	}, {
+		Role: "user",
+		Content: &mcp.EmbeddedResource{
+			Resource: &mcp.ResourceContents{URI: "file:///spec.md", MIMEType: "text/markdown", Text: "Use Go."},
+		},
+	}, {
+		Role: "user",
+		Content: &mcp.EmbeddedResource{
+			Resource: &mcp.ResourceContents{URI: "file:///diagram.bmp", MIMEType: "image/bmp", Blob: []byte("bmp")},
+		},
+	}}
+}
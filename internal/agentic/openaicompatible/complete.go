@@ -0,0 +1,54 @@
+package openaicompatible
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+// Complete sends the prompt messages to the model, requesting an output that
+// follows the JSON schema with the response format of the Chat Completions
+// API. As not all servers enforce the schema, the JSON is extracted from the
+// answer before being validated.
+func (o *openaiCompatible) Complete(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	schema *jsonschema.Schema,
+) (json.RawMessage, error) {
+	if schema == nil {
+		return nil, fmt.Errorf("missing output schema")
+	}
+	messages, err := agentic.Messages(promptMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	var aiRequest request
+	aiRequest.Model = o.model
+	aiRequest.setTuning(o.tuning)
+	for _, message := range messages {
+		switch message.Role {
+		case agentic.MessageRoleSystem:
+			aiRequest.addSystemMessage(message.TextOnly())
+		case agentic.MessageRoleUser, agentic.MessageRoleAssistant:
+			aiRequest.addMessage(message, o.vision)
+		}
+	}
+	if err := aiRequest.setSchema(o.responseFormat, agentic.SchemaName(schema), schema); err != nil {
+		return nil, err
+	}
+
+	aiResponse, err := o.do(ctx, aiRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete: %w", err)
+	}
+	text, err := aiResponse.text()
+	if err != nil {
+		return nil, &agentic.OutputError{Err: fmt.Errorf("failed to read completion: %w", err)}
+	}
+	return agentic.ValidateOutput(extractJSON(text), schema)
+}
@@ -0,0 +1,4 @@
+// Package openaicompatible provides a client for servers implementing the
+// OpenAI Chat Completions API, like vLLM, llama.cpp server, LM Studio and most
+// LLM gateways.
+package openaicompatible
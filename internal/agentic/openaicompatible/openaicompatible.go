@@ -0,0 +1,405 @@
+package openaicompatible
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+var (
+	_ agentic.Agentic          = (*openaiCompatible)(nil)
+	_ agentic.HTTPClientSetter = (*openaiCompatible)(nil)
+)
+
+func init() {
+	agentic.Register("openai-compatible", func() agentic.Agentic {
+		return &openaiCompatible{}
+	})
+}
+
+// responseFormat defines how the structured output is requested.
+type responseFormat string
+
+// List of possible response formats.
+const (
+	// responseFormatJSONSchema sends the JSON schema, so the server constrains
+	// the output to it.
+	responseFormatJSONSchema responseFormat = "json_schema"
+
+	// responseFormatJSONObject only requests a JSON output, describing the JSON
+	// schema in the prompt. It is useful for servers that don't support JSON
+	// schemas.
+	responseFormatJSONObject responseFormat = "json_object"
+)
+
+// imageTypes are the image formats accepted by the vision models.
+var imageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// openaiCompatible talks to the Chat Completions API, implemented by most
+// self-hosted servers and gateways. Servers differ in how strictly they follow
+// the OpenAI API, so the answers are parsed in a tolerant way.
+//
+// Tool calls are not supported, so it can't be used in agent mode.
+//
+// The API reference is available at:
+// https://platform.openai.com/docs/api-reference/chat
+type openaiCompatible struct {
+	client         *http.Client
+	endpoint       string
+	headers        http.Header
+	logger         *slog.Logger
+	model          string
+	apiKey         string
+	responseFormat responseFormat
+	vision         bool
+	tuning         agentic.Tuning
+}
+
+// Init initializes the instance with the provided DSN. The DSN must have one of
+// the formats:
+//
+//	`openai-compatible[+http]://[api_key@]host[:port][/path]/model[?parameters]`
+//	`model?base_url=url[&parameters]`
+//
+// The model name should be the name of the model loaded in the server (e.g.
+// "meta-llama/Llama-3.1-8B-Instruct"). In the URL format the base URL is the
+// DSN without the API key and the model, and slashes in the model name must be
+// escaped as %2F. The parameters use the URL query format:
+//
+//   - base_url: URL of the API, where /chat/completions is appended (e.g.
+//     http://localhost:8000/v1). Required without the URL format.
+//   - api_key: token sent in the Authorization header. Optional.
+//   - header: extra HTTP header with the format "Name: Value". It can be
+//     repeated.
+//   - response_format: "json_schema" (default) sends the JSON schema to the
+//     server, while "json_object" only requests a JSON output, describing the
+//     schema in the prompt.
+//   - vision: "true" sends the images of the prompt to the model. By default
+//     the images are only described in the text, as many models loaded in
+//     these servers don't accept images.
+//   - temperature, top_p, seed: sampling of the model.
+//   - max_tokens: maximum number of tokens generated.
+//   - timeout: limit of each request (e.g. "30s").
+//   - retries: number of times a request is sent again when the server is
+//     unavailable.
+func (o *openaiCompatible) Init(dsn string, logger *slog.Logger) error {
+	o.client = http.DefaultClient
+	o.logger = logger
+
+	allowed := []string{
+		"base_url", "api_key", "header", "response_format", "vision",
+		"temperature", "top_p", "max_tokens", "seed", "timeout", "retries",
+	}
+	var baseURL string
+	var parameters url.Values
+	if agentic.HasScheme(dsn, "openai-compatible") {
+		parsedDSN, err := agentic.ParseURLDSN(dsn, "", allowed...)
+		if err != nil {
+			return err
+		}
+		o.model = parsedDSN.Model
+		o.apiKey = parsedDSN.User.Username()
+		baseURL = parsedDSN.BaseURL
+		parameters = parsedDSN.Parameters
+	} else {
+		var err error
+		if o.model, parameters, err = agentic.SplitDSN(dsn, allowed...); err != nil {
+			return err
+		}
+	}
+	if o.model == "" {
+		return fmt.Errorf("missing model name in DSN")
+	}
+
+	if parameters.Has("base_url") {
+		baseURL = parameters.Get("base_url")
+	}
+	if baseURL == "" {
+		return fmt.Errorf("missing base_url in DSN")
+	}
+	var err error
+	if o.endpoint, err = url.JoinPath(baseURL, "chat", "completions"); err != nil {
+		return fmt.Errorf("invalid base URL: %w", err)
+	}
+	if parameters.Has("api_key") {
+		o.apiKey = parameters.Get("api_key")
+	}
+	if o.headers, err = agentic.ParseHeaders(parameters["header"]); err != nil {
+		return err
+	}
+
+	switch format := responseFormat(parameters.Get("response_format")); format {
+	case "":
+		o.responseFormat = responseFormatJSONSchema
+	case responseFormatJSONSchema, responseFormatJSONObject:
+		o.responseFormat = format
+	default:
+		return fmt.Errorf("unknown response format: %s", format)
+	}
+
+	if parameters.Has("vision") {
+		if o.vision, err = strconv.ParseBool(parameters.Get("vision")); err != nil {
+			return fmt.Errorf("invalid vision: %w", err)
+		}
+	}
+
+	if o.tuning, err = agentic.ParseTuning(parameters); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetHTTPClient sets the HTTP client used to send the requests.
+func (o *openaiCompatible) SetHTTPClient(client *http.Client) {
+	o.client = client
+}
+
+func (o *openaiCompatible) do(ctx context.Context, aiRequest request) (response, error) {
+	body, err := json.Marshal(aiRequest)
+	if err != nil {
+		return response{}, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return response{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range o.headers {
+		httpRequest.Header[name] = values
+	}
+	if o.apiKey != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	httpResponse, err := o.tuning.Send(o.client, httpRequest)
+	if err != nil {
+		return response{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() {
+		if err := httpResponse.Body.Close(); err != nil {
+			o.logger.Error("failed to close response body",
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		statusErr := &agentic.StatusError{StatusCode: httpResponse.StatusCode}
+		if body, err := io.ReadAll(httpResponse.Body); err == nil {
+			statusErr.Body = string(body)
+		}
+		return response{}, statusErr
+	}
+
+	var aiResponse response
+	if err = json.NewDecoder(httpResponse.Body).Decode(&aiResponse); err != nil {
+		return response{}, &agentic.OutputError{Err: fmt.Errorf("failed to decode response: %w", err)}
+	}
+	agentic.RecordUsage(ctx, agentic.Usage{
+		Provider:     "openai-compatible",
+		Model:        o.model,
+		InputTokens:  aiResponse.Usage.PromptTokens,
+		OutputTokens: aiResponse.Usage.CompletionTokens,
+	})
+	return aiResponse, nil
+}
+
+type request struct {
+	Model          string                 `json:"model"`
+	Messages       []requestMessage       `json:"messages"`
+	ResponseFormat *requestResponseFormat `json:"response_format,omitempty"`
+	Temperature    *float64               `json:"temperature,omitempty"`
+	TopP           *float64               `json:"top_p,omitempty"`
+	MaxTokens      *int64                 `json:"max_tokens,omitempty"`
+	Seed           *int64                 `json:"seed,omitempty"`
+}
+
+// setTuning applies the sampling settings defined in the DSN.
+func (r *request) setTuning(tuning agentic.Tuning) {
+	r.Temperature = tuning.Temperature
+	r.TopP = tuning.TopP
+	r.MaxTokens = tuning.MaxTokens
+	r.Seed = tuning.Seed
+}
+
+// setSchema requests an output following the JSON schema. With the JSON object
+// format the schema is described in the system message, as the server only
+// guarantees a valid JSON. Some chat templates only accept a single system
+// message at the beginning, so the description is added to the existing one.
+func (r *request) setSchema(format responseFormat, name string, schema *jsonschema.Schema) error {
+	switch format {
+	case responseFormatJSONObject:
+		encodedSchema, err := json.Marshal(schema)
+		if err != nil {
+			return fmt.Errorf("failed to encode schema: %w", err)
+		}
+		instructions := "Answer only with a JSON object following this JSON schema:\n" + string(encodedSchema)
+		if system, ok := r.systemText(); ok {
+			r.Messages[0].Content = system + "\n\n" + instructions
+		} else {
+			r.Messages = append([]requestMessage{{Role: "system", Content: instructions}}, r.Messages...)
+		}
+		r.ResponseFormat = &requestResponseFormat{
+			Type: string(responseFormatJSONObject),
+		}
+	default:
+		r.ResponseFormat = &requestResponseFormat{
+			Type: string(responseFormatJSONSchema),
+			JSONSchema: &requestJSONSchema{
+				Name:   name,
+				Schema: schema,
+				Strict: true,
+			},
+		}
+	}
+	return nil
+}
+
+func (r *request) addSystemMessage(content string) {
+	r.Messages = append(r.Messages, requestMessage{
+		Role:    "system",
+		Content: content,
+	})
+}
+
+// addMessage adds the message of the user or of the assistant. Images are only
+// sent by the user when the model accepts them; otherwise they are described in
+// the text.
+func (r *request) addMessage(message agentic.Message, vision bool) {
+	if vision && message.Image != nil && message.Role == agentic.MessageRoleUser &&
+		slices.Contains(imageTypes, message.Image.MIMEType) {
+		r.Messages = append(r.Messages, requestMessage{
+			Role: "user",
+			Content: []requestContent{{
+				Type:     "image_url",
+				ImageURL: &requestImageURL{URL: message.Image.DataURL()},
+			}},
+		})
+		return
+	}
+	r.Messages = append(r.Messages, requestMessage{
+		Role:    string(message.Role),
+		Content: message.TextOnly(),
+	})
+}
+
+// systemText returns the text of the first message, when it is a system
+// message.
+func (r *request) systemText() (string, bool) {
+	if len(r.Messages) == 0 || r.Messages[0].Role != "system" {
+		return "", false
+	}
+	text, ok := r.Messages[0].Content.(string)
+	return text, ok
+}
+
+type requestMessage struct {
+	Role string `json:"role"`
+	// Content is the text of the message, or a list of requestContent.
+	Content any `json:"content"`
+}
+
+type requestContent struct {
+	Type     string           `json:"type"`
+	ImageURL *requestImageURL `json:"image_url,omitempty"`
+}
+
+type requestImageURL struct {
+	URL string `json:"url"`
+}
+
+type requestResponseFormat struct {
+	Type       string             `json:"type"`
+	JSONSchema *requestJSONSchema `json:"json_schema,omitempty"`
+}
+
+type requestJSONSchema struct {
+	Name   string             `json:"name"`
+	Schema *jsonschema.Schema `json:"schema"`
+	Strict bool               `json:"strict"`
+}
+
+type response struct {
+	Choices []struct {
+		Message struct {
+			// Content is usually a text, but some servers answer with a list of
+			// content parts.
+			Content json.RawMessage `json:"content"`
+			Refusal string          `json:"refusal"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// text returns the content of the first choice.
+func (r *response) text() (string, error) {
+	if len(r.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+	choice := r.Choices[0]
+	if choice.Message.Refusal != "" {
+		return "", fmt.Errorf("model refused to answer: %s", choice.Message.Refusal)
+	}
+	if choice.FinishReason == "length" {
+		return "", fmt.Errorf("response truncated by the token limit")
+	}
+
+	var text string
+	if err := json.Unmarshal(choice.Message.Content, &text); err == nil {
+		return text, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(choice.Message.Content, &parts); err != nil {
+		return "", fmt.Errorf("unsupported message content: %s", choice.Message.Content)
+	}
+	var builder strings.Builder
+	for _, part := range parts {
+		if part.Type == "text" {
+			builder.WriteString(part.Text)
+		}
+	}
+	return builder.String(), nil
+}
+
+// extractJSON removes the noise that some models add around the JSON output:
+// the reasoning between <think> tags, Markdown code fences, and text before or
+// after the JSON object.
+func extractJSON(text string) string {
+	if _, after, found := strings.Cut(text, "</think>"); found {
+		text = after
+	}
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimPrefix(text, "json")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+		text = strings.TrimSpace(text)
+	}
+	if json.Valid([]byte(text)) {
+		return text
+	}
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start >= 0 && end > start {
+		return text[start : end+1]
+	}
+	return text
+}
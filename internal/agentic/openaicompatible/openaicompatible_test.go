@@ -0,0 +1,410 @@
+package openaicompatible
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+func Test_Complete(t *testing.T) {
+	schemaRequest := `{
+		"model": "meta-llama/Llama-3.1-8B-Instruct",
+		"messages": [
+			{"role": "system", "content": "You are a project manager."},
+			{"role": "user", "content": "List the IDs."}
+		],
+		"response_format": {
+			"type": "json_schema",
+			"json_schema": {
+				"name": "answer",
+				"schema": {
+					"type": "object",
+					"title": "answer",
+					"properties": {
+						"ids": {"type": ["null", "array"], "items": {"type": "integer"}, "description": "IDs of the items"}
+					},
+					"required": ["ids"],
+					"additionalProperties": false
+				},
+				"strict": true
+			}
+		}
+	}`
+
+	encodedSchema, err := json.Marshal(answerSchema(t))
+	if err != nil {
+		t.Fatalf("failed to encode schema: %v", err)
+	}
+	objectRequest, err := json.Marshal(map[string]any{
+		"model": "meta-llama/Llama-3.1-8B-Instruct",
+		"messages": []map[string]string{{
+			"role": "system",
+			"content": "You are a project manager.\n\n" +
+				"Answer only with a JSON object following this JSON schema:\n" + string(encodedSchema),
+		}, {
+			"role":    "user",
+			"content": "List the IDs.",
+		}},
+		"response_format": map[string]string{"type": "json_object"},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		dsnParameters   string
+		expectedRequest string
+		responseStatus  int
+		responseBody    string
+		expectedOutput  string
+		expectedUsage   []agentic.Usage
+		expectedError   string
+	}{{
+		name:            "it should request a structured output",
+		expectedRequest: schemaRequest,
+		responseStatus:  http.StatusOK,
+		responseBody: `{
+			"object": "chat.completion",
+			"choices": [{
+				"index": 0,
+				"message": {"role": "assistant", "content": "{\"ids\":[1,2]}"},
+				"finish_reason": "stop"
+			}],
+			"usage": {"prompt_tokens": 80, "completion_tokens": 9, "total_tokens": 89}
+		}`,
+		expectedOutput: `{"ids":[1,2]}`,
+		expectedUsage: []agentic.Usage{{
+			Provider:     "openai-compatible",
+			Model:        "meta-llama/Llama-3.1-8B-Instruct",
+			InputTokens:  80,
+			OutputTokens: 9,
+		}},
+	}, {
+		name:            "it should describe the schema in the prompt with the JSON object format",
+		dsnParameters:   "&response_format=json_object",
+		expectedRequest: string(objectRequest),
+		responseStatus:  http.StatusOK,
+		responseBody: `{
+			"choices": [{
+				"message": {"role": "assistant", "content": "{\"ids\":[1]}"},
+				"finish_reason": "stop"
+			}]
+		}`,
+		expectedOutput: `{"ids":[1]}`,
+		expectedUsage: []agentic.Usage{{
+			Provider: "openai-compatible",
+			Model:    "meta-llama/Llama-3.1-8B-Instruct",
+		}},
+	}, {
+		name:            "it should extract the JSON from the reasoning and code fences",
+		expectedRequest: schemaRequest,
+		responseStatus:  http.StatusOK,
+		responseBody: `{
+			"choices": [{
+				"message": {
+					"role": "assistant",
+					"content": "<think>The task mentions Go.</think>\n` + "```json\\n" + `{\"ids\": [3]}\n` + "```" + `"
+				},
+				"finish_reason": "stop"
+			}]
+		}`,
+		expectedOutput: `{"ids":[3]}`,
+		expectedUsage: []agentic.Usage{{
+			Provider: "openai-compatible",
+			Model:    "meta-llama/Llama-3.1-8B-Instruct",
+		}},
+	}, {
+		name:            "it should extract the JSON surrounded by text",
+		expectedRequest: schemaRequest,
+		responseStatus:  http.StatusOK,
+		responseBody: `{
+			"choices": [{
+				"message": {"role": "assistant", "content": "Sure! Here it is: {\"ids\": [4]} Let me know."},
+				"finish_reason": "stop"
+			}]
+		}`,
+		expectedOutput: `{"ids":[4]}`,
+		expectedUsage: []agentic.Usage{{
+			Provider: "openai-compatible",
+			Model:    "meta-llama/Llama-3.1-8B-Instruct",
+		}},
+	}, {
+		name:            "it should accept content parts",
+		expectedRequest: schemaRequest,
+		responseStatus:  http.StatusOK,
+		responseBody: `{
+			"choices": [{
+				"message": {"role": "assistant", "content": [
+					{"type": "text", "text": "{\"ids\":"},
+					{"type": "text", "text": "[5]}"}
+				]},
+				"finish_reason": "stop"
+			}]
+		}`,
+		expectedOutput: `{"ids":[5]}`,
+		expectedUsage: []agentic.Usage{{
+			Provider: "openai-compatible",
+			Model:    "meta-llama/Llama-3.1-8B-Instruct",
+		}},
+	}, {
+		name:            "it should fail when the response is truncated",
+		expectedRequest: schemaRequest,
+		responseStatus:  http.StatusOK,
+		responseBody: `{
+			"choices": [{
+				"message": {"role": "assistant", "content": "{\"ids\": [1,"},
+				"finish_reason": "length"
+			}]
+		}`,
+		expectedError: "response truncated by the token limit",
+	}, {
+		name:            "it should fail when the model refuses to answer",
+		expectedRequest: schemaRequest,
+		responseStatus:  http.StatusOK,
+		responseBody: `{
+			"choices": [{
+				"message": {"role": "assistant", "content": null, "refusal": "I can't help with that."},
+				"finish_reason": "stop"
+			}]
+		}`,
+		expectedError: "model refused to answer: I can't help with that.",
+	}, {
+		name:            "it should fail when the output doesn't follow the schema",
+		expectedRequest: schemaRequest,
+		responseStatus:  http.StatusOK,
+		responseBody: `{
+			"choices": [{
+				"message": {"role": "assistant", "content": "{\"ids\": \"1\"}"},
+				"finish_reason": "stop"
+			}]
+		}`,
+		expectedError: "output doesn't follow the schema",
+	}, {
+		name:            "it should fail when the server returns an error",
+		expectedRequest: schemaRequest,
+		responseStatus:  http.StatusServiceUnavailable,
+		responseBody:    `{"error": {"message": "model is loading"}}`,
+		expectedError:   "unexpected status code: 503",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/chat/completions" {
+					t.Errorf("unexpected path %q", r.URL.Path)
+				}
+				if r.Header.Get("Authorization") != "Bearer abc123" {
+					t.Errorf("unexpected authorization header %q", r.Header.Get("Authorization"))
+				}
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("failed to read request body: %v", err)
+					return
+				}
+				assertJSON(t, tt.expectedRequest, string(body))
+
+				w.WriteHeader(tt.responseStatus)
+				_, _ = w.Write([]byte(tt.responseBody))
+			}))
+			t.Cleanup(server.Close)
+
+			var model openaiCompatible
+			dsn := "meta-llama/Llama-3.1-8B-Instruct?base_url=" + server.URL + "/v1&api_key=abc123" + tt.dsnParameters
+			if err := model.Init(dsn, slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("failed to initialize: %v", err)
+			}
+
+			ctx, recorder := agentic.WithUsageRecorder(t.Context())
+			output, err := model.Complete(ctx, []*mcp.PromptMessage{{
+				Role:    "system",
+				Content: &mcp.TextContent{Text: "You are a project manager."},
+			}, {
+				Role:    "user",
+				Content: &mcp.TextContent{Text: "List the IDs."},
+			}}, answerSchema(t))
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSON(t, tt.expectedOutput, string(output))
+			if usages := recorder.Usages(); !reflect.DeepEqual(usages, tt.expectedUsage) {
+				t.Errorf("unexpected usage %v, expected %v", usages, tt.expectedUsage)
+			}
+		})
+	}
+}
+
+func Test_Init(t *testing.T) {
+	tests := []struct {
+		name             string
+		dsn              string
+		expectedModel    string
+		expectedEndpoint string
+		expectedError    string
+	}{{
+		name:             "it should accept servers without API key",
+		dsn:              "llama3.2?base_url=http://localhost:8080/v1",
+		expectedModel:    "llama3.2",
+		expectedEndpoint: "http://localhost:8080/v1/chat/completions",
+	}, {
+		name:             "it should accept the URL format",
+		dsn:              "openai-compatible+http://abc123@localhost:8000/v1/meta-llama%2FLlama-3.1-8B-Instruct?seed=1",
+		expectedModel:    "meta-llama/Llama-3.1-8B-Instruct",
+		expectedEndpoint: "http://localhost:8000/v1/chat/completions",
+	}, {
+		name:          "it should require the host in the URL format",
+		dsn:           "openai-compatible://abc123@/llama3.2",
+		expectedError: "missing host in DSN",
+	}, {
+		name:          "it should require the base URL",
+		dsn:           "llama3.2",
+		expectedError: "missing base_url in DSN",
+	}, {
+		name:          "it should require the model",
+		dsn:           "?base_url=http://localhost:8080/v1",
+		expectedError: "missing model name in DSN",
+	}, {
+		name:          "it should reject unknown response formats",
+		dsn:           "llama3.2?base_url=http://localhost:8080/v1&response_format=text",
+		expectedError: "unknown response format: text",
+	}, {
+		name:          "it should reject an invalid vision flag",
+		dsn:           "llama3.2?base_url=http://localhost:8080/v1&vision=maybe",
+		expectedError: "invalid vision",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var model openaiCompatible
+			err := model.Init(tt.dsn, slog.New(slog.DiscardHandler))
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if model.model != tt.expectedModel {
+					t.Errorf("unexpected model %q, expected %q", model.model, tt.expectedModel)
+				}
+				if model.endpoint != tt.expectedEndpoint {
+					t.Errorf("unexpected endpoint %q, expected %q", model.endpoint, tt.expectedEndpoint)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func Test_CompleteMultimodal(t *testing.T) {
+	tests := []struct {
+		name             string
+		dsnParameters    string
+		expectedMessages string
+	}{{
+		name: "it should describe the images without vision",
+		expectedMessages: `[
+			{"role": "user", "content": "Task: add a login page."},
+			{"role": "assistant", "content": "{\"ids\":[1]}"},
+			{"role": "user", "content": "[image (image/png) omitted]"}
+		]`,
+	}, {
+		name:          "it should send the images with vision",
+		dsnParameters: "&vision=true",
+		expectedMessages: `[
+			{"role": "user", "content": "Task: add a login page."},
+			{"role": "assistant", "content": "{\"ids\":[1]}"},
+			{"role": "user", "content": [{"type": "image_url", "image_url": {"url": "data:image/png;base64,cG5n"}}]}
+		]`,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Messages json.RawMessage `json:"messages"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				assertJSON(t, tt.expectedMessages, string(body.Messages))
+
+				_, _ = w.Write([]byte(`{
+					"choices": [{
+						"message": {"role": "assistant", "content": "{\"ids\":[1]}"},
+						"finish_reason": "stop"
+					}]
+				}`))
+			}))
+			t.Cleanup(server.Close)
+
+			var model openaiCompatible
+			dsn := "llava?base_url=" + server.URL + "/v1" + tt.dsnParameters
+			if err := model.Init(dsn, slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("failed to initialize: %v", err)
+			}
+
+			output, err := model.Complete(t.Context(), []*mcp.PromptMessage{{
+				Role:    "user",
+				Content: &mcp.TextContent{Text: "Task: add a login page."},
+			}, {
+				Role:    "assistant",
+				Content: &mcp.TextContent{Text: `{"ids":[1]}`},
+			}, {
+				Role:    "user",
+				Content: &mcp.ImageContent{MIMEType: "image/png", Data: []byte("png")},
+			}}, answerSchema(t))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSON(t, `{"ids":[1]}`, string(output))
+		})
+	}
+}
+
+func answerSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+
+	type answer struct {
+		IDs []int64 `json:"ids" jsonschema:"IDs of the items"`
+	}
+	schema, err := jsonschema.For[answer](nil)
+	if err != nil {
+		t.Fatalf("failed to build schema: %v", err)
+	}
+	schema.Title = "answer"
+	return schema
+}
+
+func assertJSON(t *testing.T, expected, actual string) {
+	t.Helper()
+
+	var expectedValue, actualValue any
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		t.Errorf("failed to decode expected JSON: %v", err)
+		return
+	}
+	if err := json.Unmarshal([]byte(actual), &actualValue); err != nil {
+		t.Errorf("failed to decode JSON %q: %v", actual, err)
+		return
+	}
+	if !reflect.DeepEqual(expectedValue, actualValue) {
+		t.Errorf("unexpected JSON:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
@@ -0,0 +1,255 @@
+package agentic
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// confidencePrompt is appended to the prompt messages when finding the task
+// skills and job roles, so the LLM also reports how confident it is about each
+// suggestion.
+const confidencePrompt = `Besides the requested fields, also include in the JSON output the fields ` +
+	`"skillConfidences" and "jobRoleConfidences". Each field is a list with the skill or job role ID and ` +
+	"a number between 0 and 1 representing how confident you are that the skill or job role is required " +
+	"by the task. Use lower values when the task details are vague."
+
+// Suggestion is a skill or job role suggested by the agentic system.
+type Suggestion struct {
+	// ID is the identifier of the skill or job role.
+	ID int64
+
+	// Confidence is a number between 0 and 1 representing how confident the
+	// model is about the suggestion.
+	Confidence float64
+}
+
+// TaskSkillsAndJobRolesOutput is the JSON output expected from the LLM when
+// finding the skills and job roles of a task.
+type TaskSkillsAndJobRolesOutput struct {
+	SkillIDs           []int64      `json:"skillIds" jsonschema:"IDs of the skills required by the task"`
+	JobRoleIDs         []int64      `json:"jobRoleIds" jsonschema:"IDs of the job roles required by the task"`
+	SkillConfidences   []Confidence `json:"skillConfidences" jsonschema:"confidence of each suggested skill"`
+	JobRoleConfidences []Confidence `json:"jobRoleConfidences" jsonschema:"confidence of each suggested job role"`
+	Reasoning          string       `json:"reasoning" jsonschema:"short explanation of the suggestions"`
+}
+
+// Confidence is how confident the LLM is about a skill or job role.
+type Confidence struct {
+	ID         int64   `json:"id" jsonschema:"ID of the skill or job role"`
+	Confidence float64 `json:"confidence" jsonschema:"number between 0 and 1"`
+}
+
+// Suggestions converts the LLM output into skills and job roles suggestions.
+// IDs without a reported confidence are considered fully confident.
+func (o TaskSkillsAndJobRolesOutput) Suggestions() (skills, jobRoles []Suggestion) {
+	return newSuggestions(o.SkillIDs, o.SkillConfidences), newSuggestions(o.JobRoleIDs, o.JobRoleConfidences)
+}
+
+func newSuggestions(ids []int64, confidences []Confidence) []Suggestion {
+	suggestions := make([]Suggestion, 0, len(ids))
+	for _, id := range ids {
+		confidence := 1.0
+		if i := slices.IndexFunc(confidences, func(c Confidence) bool { return c.ID == id }); i >= 0 {
+			confidence = confidences[i].Confidence
+		}
+		suggestions = append(suggestions, Suggestion{
+			ID:         id,
+			Confidence: min(max(confidence, 0), 1),
+		})
+	}
+	return suggestions
+}
+
+// TaskSkillsAndJobRolesSchema is the JSON schema of the output expected when
+// finding the skills and job roles of a task.
+var TaskSkillsAndJobRolesSchema = sync.OnceValue(func() *jsonschema.Schema {
+	schema, err := jsonschema.For[TaskSkillsAndJobRolesOutput](nil)
+	if err != nil {
+		panic(fmt.Errorf("failed to build task skills and job roles schema: %w", err))
+	}
+	schema.Title = "task_skills_and_job_roles"
+	return schema
+})
+
+// defaultCorrections is the default number of corrective turns sent when the
+// LLM answers with unknown skill or job role IDs.
+const defaultCorrections = 1
+
+func init() {
+	metrics.Set("corrections.rate", expvar.Func(correctionRate))
+}
+
+// correctionRate is the ratio of validated answers that had unknown skill or
+// job role IDs.
+func correctionRate() any {
+	checked, _ := metrics.Get("corrections.checked").(*expvar.Int)
+	needed, _ := metrics.Get("corrections.needed").(*expvar.Int)
+	if checked == nil || needed == nil || checked.Value() == 0 {
+		return 0.0
+	}
+	return float64(needed.Value()) / float64(checked.Value())
+}
+
+// FindTaskSkillsAndJobRolesOptions contains the options for the
+// FindTaskSkillsAndJobRoles function.
+type FindTaskSkillsAndJobRolesOptions struct {
+	validate      bool
+	validSkills   map[int64]string
+	validJobRoles map[int64]string
+	corrections   int
+}
+
+// FindTaskSkillsAndJobRolesOption is a function that sets an option for the
+// FindTaskSkillsAndJobRoles function.
+type FindTaskSkillsAndJobRolesOption func(*FindTaskSkillsAndJobRolesOptions)
+
+// WithValidSkillsAndJobRoles sets the names of the skills and job roles, by
+// ID, that the LLM can suggest. When set, the answered IDs are validated and
+// the LLM is asked to correct unknown IDs.
+func WithValidSkillsAndJobRoles(skills, jobRoles map[int64]string) FindTaskSkillsAndJobRolesOption {
+	return func(o *FindTaskSkillsAndJobRolesOptions) {
+		o.validate = true
+		o.validSkills = skills
+		o.validJobRoles = jobRoles
+	}
+}
+
+// WithCorrections sets the maximum number of corrective turns sent when the
+// LLM answers with unknown skill or job role IDs. By default 1 corrective turn
+// is sent, and zero disables the corrections.
+func WithCorrections(corrections int) FindTaskSkillsAndJobRolesOption {
+	return func(o *FindTaskSkillsAndJobRolesOptions) {
+		o.corrections = corrections
+	}
+}
+
+// FindTaskSkillsAndJobRoles finds the skills and job roles for a given task. It
+// uses the task data, available skills, and available job roles, informed in
+// the prompt messages, to determine the most relevant skills and job roles for
+// the task, with the confidence of each suggestion.
+//
+// When the valid skills and job roles are informed, an answer with unknown IDs
+// is sent back to the LLM with a corrective turn listing the invalid IDs and
+// the valid options. If the LLM doesn't fix the IDs within the allowed
+// corrections, its last answer is returned as is.
+func FindTaskSkillsAndJobRoles(
+	ctx context.Context,
+	agentic Completer,
+	promptMessages []*mcp.PromptMessage,
+	optFuncs ...FindTaskSkillsAndJobRolesOption,
+) (skills, jobRoles []Suggestion, reasoning string, err error) {
+	options := FindTaskSkillsAndJobRolesOptions{
+		corrections: defaultCorrections,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&options)
+	}
+
+	// composed models vote the suggestions of their models
+	ctx = WithMerge(ctx, MergeTaskSkillsAndJobRoles)
+	promptMessages = append(slices.Clone(promptMessages), &mcp.PromptMessage{
+		Role:    "user",
+		Content: &mcp.TextContent{Text: confidencePrompt},
+	})
+
+	var skillAndJobRoles TaskSkillsAndJobRolesOutput
+	for correction := 0; ; correction++ {
+		output, err := agentic.Complete(ctx, promptMessages, TaskSkillsAndJobRolesSchema())
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to find task skills and job roles: %w", err)
+		}
+		skillAndJobRoles = TaskSkillsAndJobRolesOutput{}
+		if err := json.Unmarshal(output, &skillAndJobRoles); err != nil {
+			return nil, nil, "", fmt.Errorf("failed to decode task skills and job roles: %w", err)
+		}
+		if !options.validate {
+			break
+		}
+
+		invalidSkillIDs := invalidIDs(skillAndJobRoles.SkillIDs, options.validSkills)
+		invalidJobRoleIDs := invalidIDs(skillAndJobRoles.JobRoleIDs, options.validJobRoles)
+		valid := len(invalidSkillIDs) == 0 && len(invalidJobRoleIDs) == 0
+		switch {
+		case correction == 0:
+			metrics.Add("corrections.checked", 1)
+			if !valid {
+				metrics.Add("corrections.needed", 1)
+			}
+		case valid:
+			metrics.Add("corrections.succeeded", 1)
+		}
+		if valid || correction >= options.corrections {
+			break
+		}
+
+		metrics.Add("corrections.turns", 1)
+		promptMessages = append(promptMessages, &mcp.PromptMessage{
+			Role:    "assistant",
+			Content: &mcp.TextContent{Text: string(output)},
+		}, &mcp.PromptMessage{
+			Role: "user",
+			Content: &mcp.TextContent{
+				Text: correctionPrompt(invalidSkillIDs, invalidJobRoleIDs, options.validSkills, options.validJobRoles),
+			},
+		})
+	}
+	skills, jobRoles = skillAndJobRoles.Suggestions()
+	return skills, jobRoles, skillAndJobRoles.Reasoning, nil
+}
+
+// invalidIDs returns the IDs that are not in the valid ones, without
+// duplicates.
+func invalidIDs(ids []int64, valid map[int64]string) []int64 {
+	var invalid []int64
+	for _, id := range ids {
+		if _, ok := valid[id]; !ok && !slices.Contains(invalid, id) {
+			invalid = append(invalid, id)
+		}
+	}
+	return invalid
+}
+
+// correctionPrompt asks the LLM to answer again without the invalid IDs,
+// listing the valid skills and job roles.
+func correctionPrompt(invalidSkillIDs, invalidJobRoleIDs []int64, validSkills, validJobRoles map[int64]string) string {
+	var prompt strings.Builder
+	prompt.WriteString("Your previous answer has IDs that don't exist.")
+	if len(invalidSkillIDs) > 0 {
+		fmt.Fprintf(&prompt, " Invalid skill IDs: %s.", formatIDs(invalidSkillIDs))
+	}
+	if len(invalidJobRoleIDs) > 0 {
+		fmt.Fprintf(&prompt, " Invalid job role IDs: %s.", formatIDs(invalidJobRoleIDs))
+	}
+	prompt.WriteString(" Answer again with the same JSON format, using only the IDs of the valid options.\n")
+	writeOptions(&prompt, "Valid skills", validSkills)
+	writeOptions(&prompt, "Valid job roles", validJobRoles)
+	return prompt.String()
+}
+
+func formatIDs(ids []int64) string {
+	formatted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		formatted = append(formatted, fmt.Sprint(id))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func writeOptions(prompt *strings.Builder, title string, options map[int64]string) {
+	fmt.Fprintf(prompt, "\n%s:\n", title)
+	if len(options) == 0 {
+		prompt.WriteString("- none\n")
+		return
+	}
+	for _, id := range slices.Sorted(maps.Keys(options)) {
+		fmt.Fprintf(prompt, "- %d: %s\n", id, options[id])
+	}
+}
@@ -0,0 +1,311 @@
+package agentic_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+func Test_FindTaskSkillsAndJobRoles(t *testing.T) {
+	tests := []struct {
+		name             string
+		output           string
+		expectedSkills   []agentic.Suggestion
+		expectedJobRoles []agentic.Suggestion
+		expectedError    string
+	}{{
+		name: "it should convert the output into suggestions",
+		output: `{"skillIds":[1,2],"jobRoleIds":[3],"skillConfidences":[{"id":1,"confidence":0.4},` +
+			`{"id":2,"confidence":1.5}],"jobRoleConfidences":[],"reasoning":"Some reasoning."}`,
+		expectedSkills:   []agentic.Suggestion{{ID: 1, Confidence: 0.4}, {ID: 2, Confidence: 1}},
+		expectedJobRoles: []agentic.Suggestion{{ID: 3, Confidence: 1}},
+	}, {
+		name: "it should reject an output that doesn't follow the schema",
+		output: `{"skillIds":["one"],"jobRoleIds":[],"skillConfidences":[],"jobRoleConfidences":[],` +
+			`"reasoning":""}`,
+		expectedError: "output doesn't follow the schema",
+	}, {
+		name:          "it should reject an output that isn't JSON",
+		output:        "Here are the skills: 1, 2",
+		expectedError: "invalid JSON output",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var receivedMessages []*mcp.PromptMessage
+			model := completeFunc(func(
+				_ context.Context,
+				promptMessages []*mcp.PromptMessage,
+				schema *jsonschema.Schema,
+			) (json.RawMessage, error) {
+				receivedMessages = promptMessages
+				return agentic.ValidateOutput(tt.output, schema)
+			})
+
+			promptMessages := []*mcp.PromptMessage{{
+				Role:    "user",
+				Content: &mcp.TextContent{Text: "Find the skills and job roles of the task."},
+			}}
+			skills, jobRoles, reasoning, err := agentic.FindTaskSkillsAndJobRoles(t.Context(), model, promptMessages)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(receivedMessages) != 2 || len(promptMessages) != 1 {
+				t.Errorf("expected the confidence prompt to be appended to a copy of the prompt messages")
+			}
+			if !reflect.DeepEqual(skills, tt.expectedSkills) {
+				t.Errorf("unexpected skills %v, expected %v", skills, tt.expectedSkills)
+			}
+			if !reflect.DeepEqual(jobRoles, tt.expectedJobRoles) {
+				t.Errorf("unexpected job roles %v, expected %v", jobRoles, tt.expectedJobRoles)
+			}
+			if reasoning != "Some reasoning." {
+				t.Errorf("unexpected reasoning %q", reasoning)
+			}
+		})
+	}
+}
+
+func Test_FindTaskSkillsAndJobRolesCorrections(t *testing.T) {
+	validSkills := map[int64]string{1: "Go", 2: "React"}
+	validJobRoles := map[int64]string{3: "Developer"}
+
+	tests := []struct {
+		name              string
+		outputs           []string
+		corrections       []agentic.FindTaskSkillsAndJobRolesOption
+		expectedSkills    []agentic.Suggestion
+		expectedJobRoles  []agentic.Suggestion
+		expectedCalls     int
+		expectedCorrected string
+	}{{
+		name:             "it should not correct valid IDs",
+		outputs:          []string{taskOutput("1", "3")},
+		expectedSkills:   []agentic.Suggestion{{ID: 1, Confidence: 1}},
+		expectedJobRoles: []agentic.Suggestion{{ID: 3, Confidence: 1}},
+		expectedCalls:    1,
+	}, {
+		name: "it should ask the model to correct unknown IDs",
+		outputs: []string{
+			taskOutput("1,7,7", "9"),
+			taskOutput("1,2", "3"),
+		},
+		expectedSkills:   []agentic.Suggestion{{ID: 1, Confidence: 1}, {ID: 2, Confidence: 1}},
+		expectedJobRoles: []agentic.Suggestion{{ID: 3, Confidence: 1}},
+		expectedCalls:    2,
+		expectedCorrected: "Your previous answer has IDs that don't exist. Invalid skill IDs: 7. " +
+			"Invalid job role IDs: 9. Answer again with the same JSON format, using only the IDs of the valid options.\n" +
+			"\nValid skills:\n- 1: Go\n- 2: React\n" +
+			"\nValid job roles:\n- 3: Developer\n",
+	}, {
+		name: "it should return the last answer when the corrections are exhausted",
+		outputs: []string{
+			taskOutput("7", "3"),
+			taskOutput("8", "3"),
+			taskOutput("9", "3"),
+		},
+		corrections:      []agentic.FindTaskSkillsAndJobRolesOption{agentic.WithCorrections(2)},
+		expectedSkills:   []agentic.Suggestion{{ID: 9, Confidence: 1}},
+		expectedJobRoles: []agentic.Suggestion{{ID: 3, Confidence: 1}},
+		expectedCalls:    3,
+		expectedCorrected: "Your previous answer has IDs that don't exist. Invalid skill IDs: 8. " +
+			"Answer again with the same JSON format, using only the IDs of the valid options.\n" +
+			"\nValid skills:\n- 1: Go\n- 2: React\n" +
+			"\nValid job roles:\n- 3: Developer\n",
+	}, {
+		name:             "it should not correct when the corrections are disabled",
+		outputs:          []string{taskOutput("7", "3")},
+		corrections:      []agentic.FindTaskSkillsAndJobRolesOption{agentic.WithCorrections(0)},
+		expectedSkills:   []agentic.Suggestion{{ID: 7, Confidence: 1}},
+		expectedJobRoles: []agentic.Suggestion{{ID: 3, Confidence: 1}},
+		expectedCalls:    1,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			var receivedMessages []*mcp.PromptMessage
+			model := completeFunc(func(
+				_ context.Context,
+				promptMessages []*mcp.PromptMessage,
+				schema *jsonschema.Schema,
+			) (json.RawMessage, error) {
+				receivedMessages = promptMessages
+				output := tt.outputs[min(calls, len(tt.outputs)-1)]
+				calls++
+				return agentic.ValidateOutput(output, schema)
+			})
+
+			options := append([]agentic.FindTaskSkillsAndJobRolesOption{
+				agentic.WithValidSkillsAndJobRoles(validSkills, validJobRoles),
+			}, tt.corrections...)
+			skills, jobRoles, _, err := agentic.FindTaskSkillsAndJobRoles(t.Context(), model, nil, options...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if calls != tt.expectedCalls {
+				t.Errorf("unexpected number of calls %d, expected %d", calls, tt.expectedCalls)
+			}
+			if !reflect.DeepEqual(skills, tt.expectedSkills) {
+				t.Errorf("unexpected skills %v, expected %v", skills, tt.expectedSkills)
+			}
+			if !reflect.DeepEqual(jobRoles, tt.expectedJobRoles) {
+				t.Errorf("unexpected job roles %v, expected %v", jobRoles, tt.expectedJobRoles)
+			}
+			if tt.expectedCorrected == "" {
+				return
+			}
+
+			// the previous answer is kept in the conversation, followed by the
+			// corrective turn
+			if len(receivedMessages) != 1+2*(tt.expectedCalls-1) {
+				t.Fatalf("unexpected number of messages %d", len(receivedMessages))
+			}
+			answer := receivedMessages[len(receivedMessages)-2]
+			if answer.Role != "assistant" {
+				t.Errorf("unexpected role %q of the previous answer", answer.Role)
+			}
+			correction := receivedMessages[len(receivedMessages)-1]
+			if text := correction.Content.(*mcp.TextContent).Text; text != tt.expectedCorrected {
+				t.Errorf("unexpected correction %q, expected %q", text, tt.expectedCorrected)
+			}
+		})
+	}
+}
+
+func Test_Messages(t *testing.T) {
+	tests := []struct {
+		name             string
+		promptMessages   []*mcp.PromptMessage
+		expectedMessages []agentic.Message
+		expectedError    string
+	}{{
+		name: "it should convert a few-shot prompt",
+		promptMessages: []*mcp.PromptMessage{{
+			Role:    "system",
+			Content: &mcp.TextContent{Text: "You are a project manager."},
+		}, {
+			Role:    "user",
+			Content: &mcp.TextContent{Text: "Task: add a login page."},
+		}, {
+			Role:    "assistant",
+			Content: &mcp.TextContent{Text: `{"ids":[1]}`},
+		}},
+		expectedMessages: []agentic.Message{
+			{Role: agentic.MessageRoleSystem, Text: "You are a project manager."},
+			{Role: agentic.MessageRoleUser, Text: "Task: add a login page."},
+			{Role: agentic.MessageRoleAssistant, Text: `{"ids":[1]}`},
+		},
+	}, {
+		name: "it should convert images and embedded resources",
+		promptMessages: []*mcp.PromptMessage{{
+			Role:    "user",
+			Content: &mcp.ImageContent{MIMEType: "image/png", Data: []byte("png")},
+		}, {
+			Role: "user",
+			Content: &mcp.EmbeddedResource{
+				Resource: &mcp.ResourceContents{URI: "file:///spec.md", MIMEType: "text/markdown", Text: "Use Go."},
+			},
+		}, {
+			Role: "user",
+			Content: &mcp.EmbeddedResource{
+				Resource: &mcp.ResourceContents{URI: "file:///diagram.jpg", MIMEType: "image/jpeg", Blob: []byte("jpg")},
+			},
+		}, {
+			Role: "user",
+			Content: &mcp.EmbeddedResource{
+				Resource: &mcp.ResourceContents{URI: "file:///spec.pdf", MIMEType: "application/pdf", Blob: []byte("pdf")},
+			},
+		}},
+		expectedMessages: []agentic.Message{{
+			Role:  agentic.MessageRoleUser,
+			Image: &agentic.Image{MIMEType: "image/png", Data: []byte("png")},
+		}, {
+			Role: agentic.MessageRoleUser,
+			Text: "Resource file:///spec.md:\nUse Go.",
+		}, {
+			Role:  agentic.MessageRoleUser,
+			Image: &agentic.Image{URI: "file:///diagram.jpg", MIMEType: "image/jpeg", Data: []byte("jpg")},
+		}, {
+			Role: agentic.MessageRoleUser,
+			Text: "[resource file:///spec.pdf (application/pdf) omitted]",
+		}},
+	}, {
+		name: "it should reject unsupported content types",
+		promptMessages: []*mcp.PromptMessage{{
+			Role:    "user",
+			Content: &mcp.AudioContent{MIMEType: "audio/wav"},
+		}},
+		expectedError: "unsupported prompt message content type: *mcp.AudioContent",
+	}, {
+		name: "it should reject unknown roles",
+		promptMessages: []*mcp.PromptMessage{{
+			Role:    "tool",
+			Content: &mcp.TextContent{Text: "Some output."},
+		}},
+		expectedError: "unknown prompt message role: tool",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := agentic.Messages(tt.promptMessages)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(messages, tt.expectedMessages) {
+				t.Errorf("unexpected messages %v, expected %v", messages, tt.expectedMessages)
+			}
+		})
+	}
+}
+
+func Test_MessageTextOnly(t *testing.T) {
+	message := agentic.Message{
+		Role:  agentic.MessageRoleUser,
+		Image: &agentic.Image{URI: "file:///diagram.png", MIMEType: "image/png"},
+	}
+	if text := message.TextOnly(); text != "[image file:///diagram.png (image/png) omitted]" {
+		t.Errorf("unexpected text %q", text)
+	}
+}
+
+// taskOutput builds an output of the LLM with the skill and job role IDs, as
+// comma-separated lists.
+func taskOutput(skillIDs, jobRoleIDs string) string {
+	return `{"skillIds":[` + skillIDs + `],"jobRoleIds":[` + jobRoleIDs +
+		`],"skillConfidences":[],"jobRoleConfidences":[],"reasoning":""}`
+}
+
+type completeFunc func(context.Context, []*mcp.PromptMessage, *jsonschema.Schema) (json.RawMessage, error)
+
+func (f completeFunc) Init(string, *slog.Logger) error {
+	return nil
+}
+
+func (f completeFunc) Complete(
+	ctx context.Context,
+	promptMessages []*mcp.PromptMessage,
+	schema *jsonschema.Schema,
+) (json.RawMessage, error) {
+	return f(ctx, promptMessages, schema)
+}
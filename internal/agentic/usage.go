@@ -0,0 +1,57 @@
+package agentic
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Usage is the number of tokens used by a request to a model.
+type Usage struct {
+	// Provider is the name of the agentic implementation (e.g. "openai").
+	Provider string
+
+	// Model is the name of the model.
+	Model string
+
+	// InputTokens is the number of tokens of the prompt.
+	InputTokens int64
+
+	// OutputTokens is the number of tokens generated by the model.
+	OutputTokens int64
+}
+
+// UsageRecorder stores the usage of all requests to models performed with a
+// context. It is safe for concurrent use.
+type UsageRecorder struct {
+	mu     sync.Mutex
+	usages []Usage
+}
+
+// Usages returns the usage of each request, in the order they were recorded.
+func (r *UsageRecorder) Usages() []Usage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.usages)
+}
+
+type usageRecorderKey struct{}
+
+// WithUsageRecorder returns a context that records the usage of all requests
+// to models performed with it.
+func WithUsageRecorder(ctx context.Context) (context.Context, *UsageRecorder) {
+	recorder := new(UsageRecorder)
+	return context.WithValue(ctx, usageRecorderKey{}, recorder), recorder
+}
+
+// RecordUsage records the usage of a request in the recorder of the context.
+// It does nothing when the context has no recorder.
+func RecordUsage(ctx context.Context, usage Usage) {
+	recorder, ok := ctx.Value(usageRecorderKey{}).(*UsageRecorder)
+	if !ok {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.usages = append(recorder.usages, usage)
+}
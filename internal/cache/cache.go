@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// metrics counts, per cache name, the lookups answered from memory (hits),
+// the ones that had to reach the Teamwork API (misses) and the invalidations
+// (flushes).
+var metrics = expvar.NewMap("cache")
+
+// Cache is an in-memory cache where entries expire after a TTL. A nil cache, or
+// a cache with a zero TTL, never stores entries. It is safe for concurrent
+// use.
+type Cache[K comparable, V any] struct {
+	name string
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.RWMutex
+	entries map[K]entry[V]
+}
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// New creates a new cache. The name identifies the cache in the metrics.
+func New[K comparable, V any](name string, ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		name:    name,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[K]entry[V]),
+	}
+}
+
+// Get returns the value stored for the key, if it didn't expire yet.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if c == nil || c.ttl <= 0 {
+		return zero, false
+	}
+
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if !ok || c.now().After(e.expiresAt) {
+		metrics.Add(c.name+".misses", 1)
+		return zero, false
+	}
+	metrics.Add(c.name+".hits", 1)
+	return e.value, true
+}
+
+// Set stores the value for the key. Any expired entry is removed.
+func (c *Cache[K, V]) Set(key K, value V) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = entry[V]{
+		value:     value,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+// Delete removes the value stored for the key.
+func (c *Cache[K, V]) Delete(key K) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// Flush removes all values from the cache.
+func (c *Cache[K, V]) Flush() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	metrics.Add(c.name+".flushes", 1)
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"expvar"
+	"testing"
+	"time"
+)
+
+func Test_Cache(t *testing.T) {
+	now := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	c := New[int64, string]("test", time.Minute)
+	c.now = func() time.Time { return now }
+	// the metrics are global, so only the changes made by this test are checked
+	hitsBefore, missesBefore := metricValue("test.hits"), metricValue("test.misses")
+
+	if _, ok := c.Get(1); ok {
+		t.Fatalf("unexpected hit on empty cache")
+	}
+
+	c.Set(1, "one")
+	c.Set(2, "two")
+	if value, ok := c.Get(1); !ok || value != "one" {
+		t.Errorf("unexpected value %q (hit %t)", value, ok)
+	}
+
+	c.Delete(1)
+	if _, ok := c.Get(1); ok {
+		t.Errorf("unexpected hit after delete")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.Get(2); ok {
+		t.Errorf("unexpected hit after expiration")
+	}
+
+	c.Set(3, "three")
+	c.Flush()
+	if _, ok := c.Get(3); ok {
+		t.Errorf("unexpected hit after flush")
+	}
+
+	if hits := metricValue("test.hits") - hitsBefore; hits != 1 {
+		t.Errorf("unexpected hits metric %d", hits)
+	}
+	if misses := metricValue("test.misses") - missesBefore; misses != 4 {
+		t.Errorf("unexpected misses metric %d", misses)
+	}
+}
+
+// metricValue returns the current value of the cache metric, or zero when it
+// wasn't created yet.
+func metricValue(name string) int64 {
+	if value, ok := metrics.Get(name).(*expvar.Int); ok {
+		return value.Value()
+	}
+	return 0
+}
+
+func Test_CacheDisabled(t *testing.T) {
+	var nilCache *Cache[int64, string]
+	nilCache.Set(1, "one")
+	if _, ok := nilCache.Get(1); ok {
+		t.Errorf("unexpected hit on nil cache")
+	}
+	nilCache.Flush()
+
+	c := New[int64, string]("disabled", 0)
+	c.Set(1, "one")
+	if _, ok := c.Get(1); ok {
+		t.Errorf("unexpected hit on disabled cache")
+	}
+}
@@ -0,0 +1,3 @@
+// Package cache provides in-memory caches with expiration for the resources
+// loaded from Teamwork.com.
+package cache
@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/teamwork/twapi-go-sdk/projects"
+)
+
+// Teamwork groups the caches of the resources loaded from Teamwork.com. Skills
+// and job roles are stored for the whole installation, while users are stored
+// per project.
+type Teamwork struct {
+	Skills       *Cache[struct{}, []projects.Skill]
+	JobRoles     *Cache[struct{}, []projects.JobRole]
+	ProjectUsers *Cache[int64, []projects.User]
+}
+
+// NewTeamwork creates the caches of the Teamwork.com resources with the given
+// TTLs.
+func NewTeamwork(skillsTTL, jobRolesTTL, projectUsersTTL time.Duration) Teamwork {
+	return Teamwork{
+		Skills:       New[struct{}, []projects.Skill]("skills", skillsTTL),
+		JobRoles:     New[struct{}, []projects.JobRole]("jobRoles", jobRolesTTL),
+		ProjectUsers: New[int64, []projects.User]("projectUsers", projectUsersTTL),
+	}
+}
+
+// Flush removes all values from the caches.
+func (t Teamwork) Flush() {
+	t.Skills.Flush()
+	t.JobRoles.Flush()
+	t.ProjectUsers.Flush()
+}
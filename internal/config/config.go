@@ -1,11 +1,15 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"strconv"
+	"time"
+
+	"github.com/rafaeljusto/teamwork-ai/internal/usage"
 )
 
 // Config stores the configuration of the application.
@@ -22,20 +26,92 @@ type Config struct {
 	// TeamworkAPIToken is the API token of the Teamwork API.
 	TeamworkAPIToken string
 
-	// Agentic is the agentic configuration.
-	Agentic struct {
-		// Name is the name of the agentic implementation.
-		Name string
+	// TeamworkRateLimit is the maximum number of requests per minute sent to
+	// the Teamwork API, shared by all workers. When zero, only the limits
+	// reported by the Teamwork API are respected.
+	TeamworkRateLimit int64
 
-		// DSN is the data source name for the agentic model. The format depends on
-		// the chosen implementation.
-		DSN string
-	}
+	// TeamworkMaxRetries is the number of times a read request to the Teamwork
+	// API is retried after being rate limited.
+	TeamworkMaxRetries int64
+
+	// Agentic is the list of agentic providers, in the order they are tried.
+	Agentic []AgenticProvider
+
+	// AgenticPrices are the prices of the models, used to estimate the cost of
+	// the requests.
+	AgenticPrices usage.Prices
+
+	// AgenticMonthlyBudget is the maximum estimated cost, in US dollars, of the
+	// requests to the models in a month. When reached, the tasks aren't
+	// analyzed until the next month. When zero, there's no budget.
+	AgenticMonthlyBudget float64
+
+	// AgenticUsageFile is the file where the amount spent in the month is
+	// stored, so the budget survives restarts. When empty, the amount is only
+	// kept in memory.
+	AgenticUsageFile string
 
 	// MCPEndpoint is the endpoint of the MCP server.
 	MCPEndpoint string
+
+	// MCPKeepAlive is the interval between pings to the MCP server, used to
+	// detect a lost session. When zero, the session is not checked.
+	MCPKeepAlive time.Duration
+
+	// MCPHTTPClient is the configuration of the HTTP client used to reach the
+	// MCP server. The timeout only limits the wait for the response headers, as
+	// the MCP server may stream the response.
+	MCPHTTPClient HTTPClient
+
+	// AdminToken is the Bearer token required by the administrative endpoints.
+	// When empty, the administrative endpoints are disabled.
+	AdminToken string
+
+	// WebhookToken is the token set in the Teamwork.com webhooks, used to
+	// check the signature of each event. When empty, the signature is not
+	// checked.
+	WebhookToken string
+
+	// Cache is the cache configuration of the Teamwork resources.
+	Cache struct {
+		// SkillsTTL is the time the skills are kept in the cache.
+		SkillsTTL time.Duration
+
+		// JobRolesTTL is the time the job roles are kept in the cache.
+		JobRolesTTL time.Duration
+
+		// ProjectUsersTTL is the time the users of a project are kept in the
+		// cache.
+		ProjectUsersTTL time.Duration
+	}
+}
+
+// AgenticProvider is the configuration of an agentic provider.
+type AgenticProvider struct {
+	// Name is the name of the agentic implementation.
+	Name string
+
+	// DSN is the data source name for the agentic model. The format depends on
+	// the chosen implementation.
+	DSN string
+
+	// Timeout limits each request to the agentic model. When zero, there's no
+	// limit.
+	Timeout time.Duration
+
+	// HTTPClient is the configuration of the HTTP client used to reach the
+	// agentic model.
+	HTTPClient HTTPClient
 }
 
+const (
+	defaultCacheTTL           = 10 * time.Minute
+	defaultMCPKeepAlive       = 30 * time.Second
+	defaultTeamworkRateLimit  = 150
+	defaultTeamworkMaxRetries = 3
+)
+
 // ParseFromEnvs parses the configuration from environment variables.
 func ParseFromEnvs() (*Config, error) {
 	var config Config
@@ -60,14 +136,115 @@ func ParseFromEnvs() (*Config, error) {
 
 	config.TeamworkServer = os.Getenv("TWAI_TEAMWORK_SERVER")
 	config.TeamworkAPIToken = os.Getenv("TWAI_TEAMWORK_API_TOKEN")
+	config.TeamworkRateLimit, err = parseInt("TWAI_TEAMWORK_RATE_LIMIT", defaultTeamworkRateLimit)
+	errs = errors.Join(errs, err)
+	config.TeamworkMaxRetries, err = parseInt("TWAI_TEAMWORK_MAX_RETRIES", defaultTeamworkMaxRetries)
+	errs = errors.Join(errs, err)
 
-	config.Agentic.Name = os.Getenv("TWAI_AGENTIC_NAME")
-	config.Agentic.DSN = os.Getenv("TWAI_AGENTIC_DSN")
+	config.Agentic, err = parseAgentic()
+	errs = errors.Join(errs, err)
+	if pricesStr := os.Getenv("TWAI_AGENTIC_PRICES"); pricesStr != "" {
+		if err = json.Unmarshal([]byte(pricesStr), &config.AgenticPrices); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to parse TWAI_AGENTIC_PRICES: %w", err))
+		}
+	}
+	config.AgenticMonthlyBudget, err = parseFloat("TWAI_AGENTIC_MONTHLY_BUDGET", 0)
+	errs = errors.Join(errs, err)
+	config.AgenticUsageFile = os.Getenv("TWAI_AGENTIC_USAGE_FILE")
 
 	config.MCPEndpoint = os.Getenv("TWAI_MCP_ENDPOINT")
+	config.MCPKeepAlive, err = parseDuration("TWAI_MCP_KEEPALIVE", defaultMCPKeepAlive)
+	errs = errors.Join(errs, err)
+	config.MCPHTTPClient, err = parseHTTPClient("TWAI_MCP", "")
+	errs = errors.Join(errs, err)
+	config.AdminToken = os.Getenv("TWAI_ADMIN_TOKEN")
+	config.WebhookToken = os.Getenv("TWAI_WEBHOOK_TOKEN")
+
+	config.Cache.SkillsTTL, err = parseDuration("TWAI_CACHE_SKILLS_TTL", defaultCacheTTL)
+	errs = errors.Join(errs, err)
+	config.Cache.JobRolesTTL, err = parseDuration("TWAI_CACHE_JOB_ROLES_TTL", defaultCacheTTL)
+	errs = errors.Join(errs, err)
+	config.Cache.ProjectUsersTTL, err = parseDuration("TWAI_CACHE_PROJECT_USERS_TTL", defaultCacheTTL)
+	errs = errors.Join(errs, err)
 
 	if errs != nil {
 		return nil, errs
 	}
 	return &config, nil
 }
+
+// parseAgentic parses the agentic providers. The unnumbered environment
+// variables (TWAI_AGENTIC_NAME, TWAI_AGENTIC_DSN, TWAI_AGENTIC_TIMEOUT and
+// TWAI_AGENTIC_HTTP_*) define the first provider, followed by the numbered
+// ones (e.g. TWAI_AGENTIC_NAME_1), starting from 1 until a number without
+// name.
+func parseAgentic() ([]AgenticProvider, error) {
+	var providers []AgenticProvider
+	var errs error
+	for i := 0; ; i++ {
+		var suffix string
+		if i > 0 {
+			suffix = "_" + strconv.Itoa(i)
+		}
+		name := os.Getenv("TWAI_AGENTIC_NAME" + suffix)
+		if name == "" {
+			if i == 0 {
+				continue
+			}
+			break
+		}
+		timeout, err := parseDuration("TWAI_AGENTIC_TIMEOUT"+suffix, 0)
+		errs = errors.Join(errs, err)
+		httpClient, err := parseHTTPClient("TWAI_AGENTIC", suffix)
+		errs = errors.Join(errs, err)
+		providers = append(providers, AgenticProvider{
+			Name:       name,
+			DSN:        os.Getenv("TWAI_AGENTIC_DSN" + suffix),
+			Timeout:    timeout,
+			HTTPClient: httpClient,
+		})
+	}
+	return providers, errs
+}
+
+// parseDuration parses a duration from the environment variable. If the
+// environment variable is not set, the default value is returned.
+func parseDuration(env string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("failed to parse %s: %w", env, err)
+	}
+	return duration, nil
+}
+
+// parseInt parses an integer from the environment variable. If the environment
+// variable is not set, the default value is returned.
+func parseInt(env string, defaultValue int64) (int64, error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return defaultValue, nil
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return defaultValue, fmt.Errorf("failed to parse %s: %w", env, err)
+	}
+	return number, nil
+}
+
+// parseFloat parses a float from the environment variable. If the environment
+// variable is not set, the default value is returned.
+func parseFloat(env string, defaultValue float64) (float64, error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return defaultValue, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return defaultValue, fmt.Errorf("failed to parse %s: %w", env, err)
+	}
+	return number, nil
+}
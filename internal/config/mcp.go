@@ -0,0 +1,177 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	defaultMCPConnectAttempts = 5
+	defaultMCPInitialBackoff  = 100 * time.Millisecond
+	defaultMCPMaxBackoff      = 5 * time.Second
+)
+
+// MCPClient keeps a long-lived session with the MCP server, so the initialize
+// handshake isn't repeated for every request. The session is replaced when it
+// is lost, reconnecting with an exponential backoff.
+type MCPClient struct {
+	client         *mcp.Client
+	transport      mcp.Transport
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	session atomic.Pointer[mcp.ClientSession]
+	// connecting serializes the connection attempts, allowing concurrent
+	// callers to give up while waiting.
+	connecting chan struct{}
+}
+
+// MCPClientOptions stores the options of the MCP client.
+type MCPClientOptions struct {
+	keepAlive      time.Duration
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// MCPClientOption is a function that modifies the MCP client options.
+type MCPClientOption func(*MCPClientOptions)
+
+// WithMCPClientKeepAlive pings the MCP server in the given interval, closing
+// the session when the server doesn't answer. A closed session is replaced in
+// the next request.
+func WithMCPClientKeepAlive(interval time.Duration) MCPClientOption {
+	return func(o *MCPClientOptions) {
+		o.keepAlive = interval
+	}
+}
+
+// WithMCPClientBackoff defines the number of connection attempts and the
+// exponential backoff between them.
+func WithMCPClientBackoff(attempts int, initial, maxBackoff time.Duration) MCPClientOption {
+	return func(o *MCPClientOptions) {
+		o.attempts = attempts
+		o.initialBackoff = initial
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// NewMCPClient creates a new MCP client with the given transport. The
+// transport must support multiple connections to allow reconnecting.
+func NewMCPClient(transport mcp.Transport, optFuncs ...MCPClientOption) *MCPClient {
+	options := MCPClientOptions{
+		attempts:       defaultMCPConnectAttempts,
+		initialBackoff: defaultMCPInitialBackoff,
+		maxBackoff:     defaultMCPMaxBackoff,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&options)
+	}
+	return &MCPClient{
+		client: mcp.NewClient(&mcp.Implementation{
+			Name:    "teamwork-ai",
+			Title:   "Teamwork AI",
+			Version: "1.0.0",
+		}, &mcp.ClientOptions{
+			KeepAlive: options.keepAlive,
+		}),
+		transport:      transport,
+		attempts:       max(options.attempts, 1),
+		initialBackoff: options.initialBackoff,
+		maxBackoff:     options.maxBackoff,
+		connecting:     make(chan struct{}, 1),
+	}
+}
+
+// Do runs the function with the current MCP session, connecting when needed.
+// When the function fails and the session doesn't answer a ping anymore, a new
+// session is created and the function is executed once more, so it must be
+// idempotent.
+func (m *MCPClient) Do(ctx context.Context, fn func(*mcp.ClientSession) error) error {
+	session, err := m.Session(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(session)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	if pingErr := session.Ping(ctx, nil); pingErr == nil {
+		return err
+	}
+	m.discard(session)
+	if session, err = m.Session(ctx); err != nil {
+		return err
+	}
+	return fn(session)
+}
+
+// Session returns the current MCP session, connecting to the MCP server when
+// there's no session or when the previous one was lost.
+func (m *MCPClient) Session(ctx context.Context) (*mcp.ClientSession, error) {
+	if session := m.session.Load(); session != nil {
+		return session, nil
+	}
+
+	select {
+	case m.connecting <- struct{}{}:
+		defer func() { <-m.connecting }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// another caller could have connected while we were waiting
+	if session := m.session.Load(); session != nil {
+		return session, nil
+	}
+
+	backoff := m.initialBackoff
+	for attempt := 1; ; attempt++ {
+		session, err := m.client.Connect(ctx, m.transport, &mcp.ClientSessionOptions{})
+		if err == nil {
+			m.session.Store(session)
+			go m.watch(session)
+			return session, nil
+		}
+		if attempt >= m.attempts {
+			return nil, fmt.Errorf("failed to connect to MCP server after %d attempts: %w", attempt, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("failed to connect to MCP server: %w", errors.Join(err, ctx.Err()))
+		}
+		backoff = min(backoff*2, m.maxBackoff)
+	}
+}
+
+// Close closes the current MCP session, if any.
+func (m *MCPClient) Close() error {
+	if session := m.session.Swap(nil); session != nil {
+		return session.Close()
+	}
+	return nil
+}
+
+// watch discards the session as soon as it is closed, by the server or by the
+// keep-alive check.
+func (m *MCPClient) watch(session *mcp.ClientSession) {
+	_ = session.Wait()
+	m.session.CompareAndSwap(session, nil)
+}
+
+// discard closes the session and removes it, if it's still the current one.
+func (m *MCPClient) discard(session *mcp.ClientSession) {
+	if m.session.CompareAndSwap(session, nil) {
+		_ = session.Close()
+	}
+}
@@ -0,0 +1,169 @@
+package config_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rafaeljusto/teamwork-ai/internal/config"
+)
+
+func Test_MCPClient(t *testing.T) {
+	tests := []struct {
+		name string
+		// failures is the number of connection attempts that fail before the
+		// server becomes available.
+		failures int
+		// closeServer closes the server sessions before each request.
+		closeServer    bool
+		requests       int
+		wantConnects   int
+		wantErrContent string
+	}{{
+		name:         "it should reuse the session between requests",
+		requests:     3,
+		wantConnects: 1,
+	}, {
+		name:         "it should reconnect when the session is lost",
+		closeServer:  true,
+		requests:     3,
+		wantConnects: 3,
+	}, {
+		name:         "it should retry the connection when the server is unavailable",
+		failures:     2,
+		requests:     2,
+		wantConnects: 3,
+	}, {
+		name:           "it should give up when the server stays unavailable",
+		failures:       10,
+		requests:       1,
+		wantConnects:   3,
+		wantErrContent: "failed to connect to MCP server after 3 attempts",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newServerTransport(t, tt.failures)
+			client := config.NewMCPClient(transport,
+				config.WithMCPClientBackoff(3, time.Millisecond, 5*time.Millisecond),
+			)
+			t.Cleanup(func() {
+				if err := client.Close(); err != nil {
+					t.Logf("failed to close MCP client: %v", err)
+				}
+			})
+
+			var err error
+			for range tt.requests {
+				if tt.closeServer {
+					transport.closeSessions(t)
+				}
+				err = client.Do(t.Context(), func(session *mcp.ClientSession) error {
+					return session.Ping(t.Context(), nil)
+				})
+				if err != nil {
+					break
+				}
+			}
+
+			if tt.wantErrContent != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrContent) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErrContent, err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if connects := transport.connections(); connects != tt.wantConnects {
+				t.Errorf("expected %d connections, got %d", tt.wantConnects, connects)
+			}
+		})
+	}
+}
+
+func Test_MCPClientConcurrentConnect(t *testing.T) {
+	transport := newServerTransport(t, 0)
+	client := config.NewMCPClient(transport)
+	t.Cleanup(func() {
+		if err := client.Close(); err != nil {
+			t.Logf("failed to close MCP client: %v", err)
+		}
+	})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			if _, err := client.Session(t.Context()); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if connects := transport.connections(); connects != 1 {
+		t.Errorf("expected 1 connection, got %d", connects)
+	}
+}
+
+// serverTransport connects the client to a new in-memory MCP server session
+// every time, simulating a server that can be reached multiple times.
+type serverTransport struct {
+	server   *mcp.Server
+	failures int
+
+	mu       sync.Mutex
+	connects int
+	sessions []*mcp.ServerSession
+}
+
+func newServerTransport(t *testing.T, failures int) *serverTransport {
+	transport := &serverTransport{
+		server: mcp.NewServer(&mcp.Implementation{
+			Name:    "test-server",
+			Version: "1.0.0",
+		}, &mcp.ServerOptions{}),
+		failures: failures,
+	}
+	t.Cleanup(func() {
+		transport.closeSessions(t)
+	})
+	return transport
+}
+
+func (s *serverTransport) Connect(ctx context.Context) (mcp.Connection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connects++
+	if s.connects <= s.failures {
+		return nil, errors.New("server unavailable")
+	}
+
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	session, err := s.server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sessions = append(s.sessions, session)
+	return clientTransport.Connect(ctx)
+}
+
+func (s *serverTransport) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connects
+}
+
+func (s *serverTransport) closeSessions(t *testing.T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, session := range s.sessions {
+		if err := session.Close(); err != nil {
+			t.Logf("failed to close MCP server session: %v", err)
+		}
+	}
+	s.sessions = nil
+}
@@ -1,77 +1,134 @@
 package config
 
 import (
-	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+	"github.com/rafaeljusto/teamwork-ai/internal/cache"
+	"github.com/rafaeljusto/teamwork-ai/internal/throttle"
+	"github.com/rafaeljusto/teamwork-ai/internal/usage"
 	twapi "github.com/teamwork/twapi-go-sdk"
 	"github.com/teamwork/twapi-go-sdk/session"
 )
 
+// teamworkBurst is the number of requests sent to the Teamwork API at once
+// before the rate limit starts spreading them.
+const teamworkBurst = 10
+
 // Resources stores the resources for the web server.
 type Resources struct {
 	Logger         *slog.Logger
-	Agentic        agentic.Agentic
+	Agentic        agentic.Completer
 	TeamworkEngine *twapi.Engine
 	MCPClient      *MCPClient
+	Cache          cache.Teamwork
+	Usage          *usage.Tracker
 }
 
-// NewResources creates a new set of resources for the web server.
-func NewResources(config *Config) *Resources {
+// NewResources creates a new set of resources for the web server. It fails
+// when the HTTP clients can't be built (e.g. missing CA file), an agentic
+// provider can't be initialized (e.g. invalid DSN) or the usage state file
+// can't be loaded.
+func NewResources(config *Config) (*Resources, error) {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 		Level: config.LoggerLevel,
 	}))
+	agenticCompleter, err := newAgentic(config.Agentic, logger)
+	if err != nil {
+		return nil, err
+	}
+	usageTracker, err := usage.NewTracker(
+		usage.WithPrices(config.AgenticPrices),
+		usage.WithMonthlyBudget(config.AgenticMonthlyBudget),
+		usage.WithStateFile(config.AgenticUsageFile),
+		usage.WithLogger(logger),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create usage tracker: %w", err)
+	}
+	mcpTransport, err := config.MCPHTTPClient.Transport()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MCP HTTP transport: %w", err)
+	}
 	resources := &Resources{
 		Logger:  logger,
-		Agentic: agentic.Init(config.Agentic.Name, config.Agentic.DSN, logger),
+		Agentic: agenticCompleter,
 		TeamworkEngine: twapi.NewEngine(
 			session.NewBearerToken(config.TeamworkAPIToken, config.TeamworkServer),
 			twapi.WithLogger(logger),
+			twapi.WithHTTPClient(&http.Client{
+				Transport: throttle.NewTransport(
+					throttle.WithRate(float64(config.TeamworkRateLimit)/60, teamworkBurst),
+					throttle.WithMaxRetries(int(config.TeamworkMaxRetries)),
+					throttle.WithLogger(logger),
+				),
+			}),
 		),
 		MCPClient: NewMCPClient(&mcp.StreamableClientTransport{
 			Endpoint: config.MCPEndpoint,
 			HTTPClient: &http.Client{
-				Transport: &authTransport{token: config.TeamworkAPIToken},
+				Transport: &authTransport{token: config.TeamworkAPIToken, next: mcpTransport},
 			},
-		}),
+		}, WithMCPClientKeepAlive(config.MCPKeepAlive)),
+		Cache: cache.NewTeamwork(config.Cache.SkillsTTL, config.Cache.JobRolesTTL, config.Cache.ProjectUsersTTL),
+		Usage: usageTracker,
 	}
 
-	return resources
-}
-
-// MCPClient wraps an MCP client with a specific endpoint.
-type MCPClient struct {
-	client    *mcp.Client
-	transport mcp.Transport
+	return resources, nil
 }
 
-// NewMCPClient creates a new MCP client with the given endpoint.
-func NewMCPClient(transport mcp.Transport) *MCPClient {
-	return &MCPClient{
-		client: mcp.NewClient(&mcp.Implementation{
-			Name:    "teamwork-ai",
-			Title:   "Teamwork AI",
-			Version: "1.0.0",
-		}, &mcp.ClientOptions{}),
-		transport: transport,
+// newAgentic initializes the agentic providers, trying them in order. When
+// the same implementation is used multiple times, the position is added to
+// the name to identify it in the logs and metrics.
+func newAgentic(providers []AgenticProvider, logger *slog.Logger) (agentic.Completer, error) {
+	if len(providers) == 0 {
+		return nil, nil
 	}
-}
+	failoverProviders := make([]agentic.FailoverProvider, 0, len(providers))
+	names := make(map[string]struct{}, len(providers))
+	for i, provider := range providers {
+		name := provider.Name
+		if _, ok := names[name]; ok {
+			name += "-" + strconv.Itoa(i+1)
+		}
+		names[name] = struct{}{}
+
+		httpClient, err := provider.HTTPClient.Client()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create HTTP client for agentic provider %s: %w", name, err)
+		}
+
+		model, err := agentic.New(provider.Name, provider.DSN, logger, agentic.WithHTTPClient(httpClient))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create agentic provider %s: %w", name, err)
+		}
 
-// Connect connects to the MCP server with the given options.
-func (m *MCPClient) Connect(ctx context.Context) (*mcp.ClientSession, error) {
-	return m.client.Connect(ctx, m.transport, &mcp.ClientSessionOptions{})
+		failoverProviders = append(failoverProviders, agentic.FailoverProvider{
+			Name:    name,
+			Agentic: model,
+			Timeout: provider.Timeout,
+		})
+	}
+	return agentic.NewFailover(failoverProviders, logger), nil
 }
 
 type authTransport struct {
 	token string
+	next  http.RoundTripper
 }
 
-// RoundTrip adds the basic auth header to the request.
+// RoundTrip adds the basic auth header to the request. The request is sent with
+// the next transport, or with http.DefaultTransport if not defined.
 func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.Header.Set("Authorization", "Bearer "+t.token)
-	return http.DefaultTransport.RoundTrip(req)
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
 }
@@ -0,0 +1,18 @@
+package config
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func Test_newAgentic(t *testing.T) {
+	_, err := newAgentic([]AgenticProvider{{
+		Name: "unknown",
+		DSN:  "model:token",
+	}}, slog.New(slog.DiscardHandler))
+	expectedError := "failed to create agentic provider unknown: unknown agentic implementation: unknown"
+	if err == nil || !strings.Contains(err.Error(), expectedError) {
+		t.Errorf("expected error containing %q, got %v", expectedError, err)
+	}
+}
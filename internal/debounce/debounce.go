@@ -0,0 +1,159 @@
+package debounce
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// metrics counts every pushed event, and the ones replaced by a newer event of
+// the same key before the quiet period ended (coalesced).
+var metrics = expvar.NewMap("debounce")
+
+// Debouncer waits until no new event is pushed for a key during the window,
+// and then processes the latest event of the key. Events of the same key are
+// never processed concurrently: an event that is ready while the previous one
+// is still being processed waits for it to finish. It is safe for concurrent
+// use.
+type Debouncer[K comparable, V any] struct {
+	window time.Duration
+	fn     func(K, V)
+	clock  clock
+
+	mu      sync.Mutex
+	entries map[K]*entry[V]
+	running sync.WaitGroup
+}
+
+type entry[V any] struct {
+	value V
+	timer timer
+	// generation identifies the latest timer, so a timer that fired while
+	// being replaced is ignored.
+	generation uint64
+	scheduled  bool
+	running    bool
+	// ready informs that the window elapsed while the previous event was
+	// being processed.
+	ready bool
+}
+
+// New creates a new debouncer that calls fn with the latest event of a key,
+// once the key is quiet for the window.
+func New[K comparable, V any](window time.Duration, fn func(K, V)) *Debouncer[K, V] {
+	return &Debouncer[K, V]{
+		window:  window,
+		fn:      fn,
+		clock:   realClock{},
+		entries: make(map[K]*entry[V]),
+	}
+}
+
+// Push schedules the event for the key, replacing any event of the same key
+// still waiting for the window.
+func (d *Debouncer[K, V]) Push(key K, value V) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	metrics.Add("events", 1)
+	e, ok := d.entries[key]
+	if !ok {
+		e = new(entry[V])
+		d.entries[key] = e
+	} else if e.scheduled || e.ready {
+		e.timer.Stop()
+		metrics.Add("coalesced", 1)
+	}
+	e.value = value
+	e.generation++
+	e.scheduled = true
+	e.ready = false
+
+	generation := e.generation
+	e.timer = d.clock.AfterFunc(d.window, func() {
+		d.fire(key, generation)
+	})
+}
+
+// Flush processes all events waiting for the window immediately, and waits
+// until all events are processed.
+func (d *Debouncer[K, V]) Flush() {
+	type pending struct {
+		key        K
+		generation uint64
+	}
+
+	d.mu.Lock()
+	var pendings []pending
+	for key, e := range d.entries {
+		if e.scheduled {
+			e.timer.Stop()
+			pendings = append(pendings, pending{key: key, generation: e.generation})
+		}
+	}
+	d.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range pendings {
+		wg.Go(func() {
+			d.fire(p.key, p.generation)
+		})
+	}
+	wg.Wait()
+	d.running.Wait()
+}
+
+// fire processes the event of the key when the window elapses. If the key is
+// already being processed, the event is processed right after.
+func (d *Debouncer[K, V]) fire(key K, generation uint64) {
+	d.mu.Lock()
+	e, ok := d.entries[key]
+	if !ok || !e.scheduled || e.generation != generation {
+		d.mu.Unlock()
+		return
+	}
+	e.scheduled = false
+	if e.running {
+		e.ready = true
+		d.mu.Unlock()
+		return
+	}
+	e.running = true
+	value := e.value
+	d.running.Add(1)
+	d.mu.Unlock()
+
+	defer d.running.Done()
+	for {
+		d.fn(key, value)
+
+		d.mu.Lock()
+		if e.ready {
+			e.ready = false
+			value = e.value
+			d.mu.Unlock()
+			continue
+		}
+		e.running = false
+		if !e.scheduled {
+			delete(d.entries, key)
+		}
+		d.mu.Unlock()
+		return
+	}
+}
+
+// clock allows replacing the timers in tests.
+type clock interface {
+	AfterFunc(d time.Duration, f func()) timer
+}
+
+type timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) AfterFunc(d time.Duration, f func()) timer {
+	return time.AfterFunc(d, f)
+}
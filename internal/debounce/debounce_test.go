@@ -0,0 +1,160 @@
+package debounce
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func Test_Debouncer(t *testing.T) {
+	const window = 5 * time.Second
+
+	type call struct {
+		key   int64
+		value string
+	}
+
+	tests := []struct {
+		name string
+		// run pushes the events and moves the clock. The push function is the
+		// same used when processing the events.
+		run           func(clock *fakeClock, push func(int64, string))
+		onCall        func(clock *fakeClock, push func(int64, string), calls int)
+		expectedCalls []call
+	}{{
+		name: "it should process only the latest event of a burst",
+		run: func(clock *fakeClock, push func(int64, string)) {
+			push(1, "first")
+			clock.Advance(time.Second)
+			push(1, "second")
+			clock.Advance(time.Second)
+			push(1, "third")
+			clock.Advance(window - time.Second)
+		},
+		expectedCalls: nil,
+	}, {
+		name: "it should process the event after the quiet window",
+		run: func(clock *fakeClock, push func(int64, string)) {
+			push(1, "first")
+			clock.Advance(time.Second)
+			push(1, "second")
+			clock.Advance(window)
+		},
+		expectedCalls: []call{{key: 1, value: "second"}},
+	}, {
+		name: "it should debounce each key independently",
+		run: func(clock *fakeClock, push func(int64, string)) {
+			push(1, "first")
+			clock.Advance(2 * time.Second)
+			push(2, "second")
+			clock.Advance(3 * time.Second)
+			push(2, "third")
+			clock.Advance(window)
+		},
+		expectedCalls: []call{{key: 1, value: "first"}, {key: 2, value: "third"}},
+	}, {
+		name: "it should process events received while processing the same key",
+		run: func(clock *fakeClock, push func(int64, string)) {
+			push(1, "first")
+			clock.Advance(window)
+		},
+		onCall: func(clock *fakeClock, push func(int64, string), calls int) {
+			if calls > 1 {
+				return
+			}
+			push(1, "second")
+			clock.Advance(time.Second)
+			push(1, "third")
+			clock.Advance(window)
+		},
+		expectedCalls: []call{{key: 1, value: "first"}, {key: 1, value: "third"}},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := new(fakeClock)
+			var calls []call
+			var d *Debouncer[int64, string]
+			d = New(window, func(key int64, value string) {
+				calls = append(calls, call{key: key, value: value})
+				if tt.onCall != nil {
+					tt.onCall(clock, d.Push, len(calls))
+				}
+			})
+			d.clock = clock
+
+			tt.run(clock, d.Push)
+
+			if !slices.Equal(calls, tt.expectedCalls) {
+				t.Errorf("unexpected calls %v, expected %v", calls, tt.expectedCalls)
+			}
+		})
+	}
+}
+
+func Test_DebouncerFlush(t *testing.T) {
+	clock := new(fakeClock)
+	var values []string
+	d := New(time.Minute, func(_ int64, value string) {
+		values = append(values, value)
+	})
+	d.clock = clock
+
+	d.Push(1, "first")
+	d.Push(1, "second")
+	d.Flush()
+	if !slices.Equal(values, []string{"second"}) {
+		t.Fatalf("unexpected values after flush: %v", values)
+	}
+
+	// the flushed event must not be processed again
+	clock.Advance(time.Minute)
+	if len(values) != 1 {
+		t.Errorf("unexpected values after the window: %v", values)
+	}
+	if len(d.entries) != 0 {
+		t.Errorf("unexpected pending entries: %d", len(d.entries))
+	}
+}
+
+// fakeClock fires the timers synchronously when the time is advanced.
+type fakeClock struct {
+	now    time.Duration
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Duration
+	f       func()
+	stopped bool
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) timer {
+	t := &fakeTimer{at: c.now + d, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock, firing the expired timers in order.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now += d
+	for {
+		var next *fakeTimer
+		for _, t := range c.timers {
+			if !t.stopped && t.at <= c.now && (next == nil || t.at < next.at) {
+				next = t
+			}
+		}
+		if next == nil {
+			return
+		}
+		next.stopped = true
+		next.f()
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	stopped := !t.stopped
+	t.stopped = true
+	return stopped
+}
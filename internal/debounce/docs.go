@@ -0,0 +1,3 @@
+// Package debounce coalesces bursts of events with the same key, processing
+// only the latest one after a quiet period.
+package debounce
@@ -0,0 +1,3 @@
+// Package throttle provides an HTTP transport that keeps the requests to
+// Teamwork.com within the API rate limits.
+package throttle
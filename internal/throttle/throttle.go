@@ -0,0 +1,345 @@
+package throttle
+
+import (
+	"context"
+	"expvar"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// metrics counts the waits imposed by the local rate limit (throttled), the
+// responses where the server refused the request with 429 or 503
+// (rateLimited), and the requests sent again after them (retries).
+var metrics = expvar.NewMap("throttle")
+
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = time.Second
+	defaultMaxWait    = time.Minute
+)
+
+// Transport is an HTTP transport that limits the rate of requests with a token
+// bucket, shared by everyone using the transport. When the server reports that
+// the rate limit was reached, all requests are paused until the limit resets,
+// and idempotent requests are retried.
+type Transport struct {
+	next       http.RoundTripper
+	bucket     *bucket
+	maxRetries int
+	backoff    time.Duration
+	maxWait    time.Duration
+	logger     *slog.Logger
+	sleep      func(context.Context, time.Duration) error
+}
+
+// TransportOptions stores the options of the transport.
+type TransportOptions struct {
+	next       http.RoundTripper
+	rate       float64
+	burst      int
+	maxRetries int
+	backoff    time.Duration
+	maxWait    time.Duration
+	logger     *slog.Logger
+}
+
+// TransportOption is a function that modifies the transport options.
+type TransportOption func(*TransportOptions)
+
+// WithNext sets the transport that sends the requests. By default, it uses
+// http.DefaultTransport.
+func WithNext(next http.RoundTripper) TransportOption {
+	return func(o *TransportOptions) {
+		o.next = next
+	}
+}
+
+// WithRate limits the number of requests per second, allowing bursts of up to
+// burst requests. By default, the rate isn't limited until the server reports
+// it.
+func WithRate(rate float64, burst int) TransportOption {
+	return func(o *TransportOptions) {
+		o.rate = rate
+		o.burst = burst
+	}
+}
+
+// WithMaxRetries sets the number of times an idempotent request is retried
+// after being rate limited. By default, it retries 3 times.
+func WithMaxRetries(maxRetries int) TransportOption {
+	return func(o *TransportOptions) {
+		o.maxRetries = maxRetries
+	}
+}
+
+// WithMaxWait sets the longest time a request waits before being retried. If
+// the server asks to wait longer, the rate limited response is returned. By
+// default, it waits up to 1 minute.
+func WithMaxWait(maxWait time.Duration) TransportOption {
+	return func(o *TransportOptions) {
+		o.maxWait = maxWait
+	}
+}
+
+// WithLogger sets the logger of the transport. By default, it uses
+// slog.Default().
+func WithLogger(logger *slog.Logger) TransportOption {
+	return func(o *TransportOptions) {
+		o.logger = logger
+	}
+}
+
+// NewTransport creates a new rate limited transport.
+func NewTransport(optFuncs ...TransportOption) *Transport {
+	options := TransportOptions{
+		next:       http.DefaultTransport,
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+		maxWait:    defaultMaxWait,
+		logger:     slog.Default(),
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&options)
+	}
+	return &Transport{
+		next:       options.next,
+		bucket:     newBucket(options.rate, options.burst, time.Now),
+		maxRetries: options.maxRetries,
+		backoff:    options.backoff,
+		maxWait:    options.maxWait,
+		logger:     options.logger,
+		sleep:      sleep,
+	}
+}
+
+// RoundTrip sends the request once the rate limit allows it, retrying
+// idempotent requests when the server answers that the limit was reached.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		// the bucket may be paused while waiting for the reservation
+		for wait := t.bucket.reserve(); wait > 0; wait = t.bucket.paused() {
+			metrics.Add("throttled", 1)
+			if err := t.sleep(ctx, wait); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		now := t.bucket.now()
+		t.observe(resp, now)
+
+		if !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+		metrics.Add("rateLimited", 1)
+
+		delay, ok := retryAfter(resp.Header, now)
+		if !ok {
+			delay = t.backoff << attempt
+		}
+		t.bucket.pause(now.Add(delay))
+
+		if attempt >= t.maxRetries || delay > t.maxWait || !idempotent(req) {
+			return resp, nil
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			if req, err = rewind(req); err != nil {
+				return resp, nil
+			}
+		}
+
+		t.logger.Warn("teamwork rate limit reached, retrying request",
+			slog.String("method", req.Method),
+			slog.String("url", req.URL.String()),
+			slog.Int("status", resp.StatusCode),
+			slog.Int("attempt", attempt+1),
+			slog.Duration("delay", delay),
+		)
+		metrics.Add("retries", 1)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+}
+
+// observe pauses the requests when the rate limit headers report that there
+// are no remaining requests in the current window.
+func (t *Transport) observe(resp *http.Response, now time.Time) {
+	remaining, ok := headerInt(resp.Header, "X-RateLimit-Remaining", "X-Rate-Limit-Remaining")
+	if !ok || remaining > 0 {
+		return
+	}
+	reset, ok := headerInt(resp.Header, "X-RateLimit-Reset", "X-Rate-Limit-Reset")
+	if !ok {
+		return
+	}
+	t.bucket.pause(resetTime(reset, now))
+}
+
+// retryable returns true when the status code means that the request can be
+// sent again later.
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// idempotent returns true when the request can be sent more than once without
+// side effects.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// rewind returns a copy of the request with a fresh body, so it can be sent
+// again.
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.GetBody == nil {
+		return nil, http.ErrBodyNotAllowed
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = body
+	return req, nil
+}
+
+// retryAfter parses the Retry-After header, which can be a number of seconds
+// or an HTTP date.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// resetTime converts the rate limit reset header into a time. Small values are
+// the number of seconds until the reset, while large values are Unix
+// timestamps.
+func resetTime(reset int64, now time.Time) time.Time {
+	const unixThreshold = 1_000_000_000
+	if reset >= unixThreshold {
+		return time.Unix(reset, 0)
+	}
+	return now.Add(time.Duration(reset) * time.Second)
+}
+
+func headerInt(header http.Header, names ...string) (int64, bool) {
+	for _, name := range names {
+		if value := header.Get(name); value != "" {
+			number, err := strconv.ParseInt(value, 10, 64)
+			return number, err == nil
+		}
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// bucket is a token bucket that allows the tokens to go negative, so each
+// caller knows how long it needs to wait for its turn. It can also be paused
+// until a given time, delaying all callers.
+type bucket struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu          sync.Mutex
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newBucket(rate float64, burst int, now func() time.Time) *bucket {
+	return &bucket{
+		rate:   rate,
+		burst:  float64(max(burst, 1)),
+		now:    now,
+		tokens: float64(max(burst, 1)),
+		last:   now(),
+	}
+}
+
+// reserve takes a token from the bucket, returning how long the caller must
+// wait before using it.
+func (b *bucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	start := now
+	if b.pausedUntil.After(start) {
+		start = b.pausedUntil
+	}
+	if b.rate <= 0 {
+		return start.Sub(now)
+	}
+
+	b.refill(start)
+	b.tokens--
+
+	wait := b.last.Sub(now)
+	if b.tokens < 0 {
+		wait += time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	return wait
+}
+
+// paused returns how long until the bucket is resumed.
+func (b *bucket) paused() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pausedUntil.Sub(b.now())
+}
+
+// pause delays all new reservations until the given time. The bucket restarts
+// with a single token, so the requests are spread after the pause.
+func (b *bucket) pause(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !until.After(b.pausedUntil) {
+		return
+	}
+	b.pausedUntil = until
+	if b.rate > 0 {
+		b.refill(b.now())
+		b.tokens = math.Min(b.tokens, 1)
+		b.last = until
+	}
+}
+
+// refill adds the tokens accumulated until the given time.
+func (b *bucket) refill(until time.Time) {
+	if until.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+until.Sub(b.last).Seconds()*b.rate)
+		b.last = until
+	}
+}
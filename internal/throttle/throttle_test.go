@@ -0,0 +1,174 @@
+package throttle
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Transport(t *testing.T) {
+	start := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		method     string
+		requests   int
+		responses  []*http.Response
+		wantStatus int
+		wantCalls  int
+		wantSleeps []time.Duration
+	}{{
+		name:   "it should retry a GET after the Retry-After delay",
+		method: http.MethodGet,
+		responses: []*http.Response{
+			response(http.StatusTooManyRequests, "Retry-After", "2"),
+			response(http.StatusOK),
+		},
+		wantStatus: http.StatusOK,
+		wantCalls:  2,
+		wantSleeps: []time.Duration{2 * time.Second},
+	}, {
+		name:   "it should retry a GET after the Retry-After date",
+		method: http.MethodGet,
+		responses: []*http.Response{
+			response(http.StatusServiceUnavailable, "Retry-After", start.Add(5*time.Second).Format(http.TimeFormat)),
+			response(http.StatusOK),
+		},
+		wantStatus: http.StatusOK,
+		wantCalls:  2,
+		wantSleeps: []time.Duration{5 * time.Second},
+	}, {
+		name:   "it should not retry a POST",
+		method: http.MethodPost,
+		responses: []*http.Response{
+			response(http.StatusTooManyRequests, "Retry-After", "2"),
+		},
+		wantStatus: http.StatusTooManyRequests,
+		wantCalls:  1,
+	}, {
+		name:   "it should give up after the maximum number of retries",
+		method: http.MethodGet,
+		responses: []*http.Response{
+			response(http.StatusTooManyRequests),
+			response(http.StatusTooManyRequests),
+			response(http.StatusTooManyRequests),
+			response(http.StatusTooManyRequests),
+		},
+		wantStatus: http.StatusTooManyRequests,
+		wantCalls:  4,
+		wantSleeps: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+	}, {
+		name:   "it should not wait longer than the maximum wait",
+		method: http.MethodGet,
+		responses: []*http.Response{
+			response(http.StatusTooManyRequests, "Retry-After", "120"),
+		},
+		wantStatus: http.StatusTooManyRequests,
+		wantCalls:  1,
+	}, {
+		name:     "it should pause when there are no remaining requests",
+		method:   http.MethodGet,
+		requests: 2,
+		responses: []*http.Response{
+			response(http.StatusOK, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "10"),
+			response(http.StatusOK),
+		},
+		wantStatus: http.StatusOK,
+		wantCalls:  2,
+		wantSleeps: []time.Duration{10 * time.Second},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			var calls int
+			var sleeps []time.Duration
+
+			transport := NewTransport(
+				WithNext(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+					calls++
+					if calls > len(tt.responses) {
+						t.Fatalf("unexpected request %d", calls)
+					}
+					return tt.responses[calls-1], nil
+				})),
+				WithLogger(slog.New(slog.DiscardHandler)),
+			)
+			transport.bucket.now = func() time.Time { return now }
+			transport.sleep = func(_ context.Context, d time.Duration) error {
+				sleeps = append(sleeps, d)
+				now = now.Add(d)
+				return nil
+			}
+
+			var resp *http.Response
+			for range max(tt.requests, 1) {
+				req, err := http.NewRequestWithContext(t.Context(), tt.method, "https://example.com/tasks.json", nil)
+				if err != nil {
+					t.Fatalf("failed to create request: %v", err)
+				}
+				if resp, err = transport.RoundTrip(req); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+			if !slices.Equal(sleeps, tt.wantSleeps) {
+				t.Errorf("expected sleeps %v, got %v", tt.wantSleeps, sleeps)
+			}
+		})
+	}
+}
+
+func Test_bucket(t *testing.T) {
+	now := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	b := newBucket(2, 2, func() time.Time { return now })
+
+	var waits []time.Duration
+	for range 4 {
+		waits = append(waits, b.reserve())
+	}
+	expected := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	if !slices.Equal(waits, expected) {
+		t.Errorf("expected waits %v, got %v", expected, waits)
+	}
+
+	now = now.Add(3 * time.Second)
+	b.pause(now.Add(time.Minute))
+	if wait := b.reserve(); wait != time.Minute {
+		t.Errorf("expected to wait the pause, got %v", wait)
+	}
+	if wait := b.reserve(); wait != time.Minute+500*time.Millisecond {
+		t.Errorf("expected to wait after the pause, got %v", wait)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func response(statusCode int, headers ...string) *http.Response {
+	resp := &http.Response{
+		StatusCode: statusCode,
+		Status:     strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader("{}")),
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		resp.Header.Set(headers[i], headers[i+1])
+	}
+	return resp
+}
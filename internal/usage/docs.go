@@ -0,0 +1,3 @@
+// Package usage accounts the tokens used by the agentic models, estimating the
+// cost of the requests and keeping them within a monthly budget.
+package usage
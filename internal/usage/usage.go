@@ -0,0 +1,273 @@
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+// metrics accumulates the input and output tokens and the estimated cost per
+// project ID, since the application started, and holds the estimated cost of
+// the current month checked against the budget.
+var metrics = expvar.NewMap("usage")
+
+// Price is the cost of a model, in US dollars per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Prices maps the model name to its price. A price can also be defined for a
+// specific provider with the key "provider/model" (e.g. "ollama/llama3.2"),
+// which has precedence over the model name.
+type Prices map[string]Price
+
+// Total is the usage of a set of requests.
+type Total struct {
+	InputTokens  int64   `json:"inputTokens"`
+	OutputTokens int64   `json:"outputTokens"`
+	Cost         float64 `json:"cost"`
+}
+
+// Tracker accumulates the usage of the models and checks the monthly budget.
+// The spent amount is kept in memory, so it restarts with the application,
+// unless a state file is defined (see WithStateFile). A nil tracker doesn't
+// record anything and has no budget. It is safe for concurrent use.
+type Tracker struct {
+	prices    Prices
+	budget    float64
+	stateFile string
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu       sync.Mutex
+	month    string
+	spent    float64
+	unpriced map[string]struct{}
+}
+
+// TrackerOptions stores the options of the tracker.
+type TrackerOptions struct {
+	prices    Prices
+	budget    float64
+	stateFile string
+	logger    *slog.Logger
+}
+
+// TrackerOption is a function that modifies the tracker options.
+type TrackerOption func(*TrackerOptions)
+
+// WithPrices sets the prices used to estimate the cost of the requests. By
+// default there are no prices, so the cost is always zero.
+func WithPrices(prices Prices) TrackerOption {
+	return func(o *TrackerOptions) {
+		o.prices = prices
+	}
+}
+
+// WithMonthlyBudget sets the maximum estimated cost, in US dollars, of the
+// requests in a calendar month (UTC). By default there's no budget.
+func WithMonthlyBudget(budget float64) TrackerOption {
+	return func(o *TrackerOptions) {
+		o.budget = budget
+	}
+}
+
+// WithStateFile sets the file where the amount spent in the current month is
+// stored, so the budget survives restarts. The file is loaded when the tracker
+// is created and replaced after every recorded request. By default the spent
+// amount is only kept in memory.
+func WithStateFile(path string) TrackerOption {
+	return func(o *TrackerOptions) {
+		o.stateFile = path
+	}
+}
+
+// WithLogger sets the logger of the tracker.
+func WithLogger(logger *slog.Logger) TrackerOption {
+	return func(o *TrackerOptions) {
+		o.logger = logger
+	}
+}
+
+// NewTracker creates a new usage tracker. It fails when the state file exists
+// but can't be loaded.
+func NewTracker(optFuncs ...TrackerOption) (*Tracker, error) {
+	options := TrackerOptions{
+		logger: slog.New(slog.DiscardHandler),
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&options)
+	}
+	tracker := &Tracker{
+		prices:    options.prices,
+		budget:    options.budget,
+		stateFile: options.stateFile,
+		logger:    options.logger,
+		now:       time.Now,
+		unpriced:  make(map[string]struct{}),
+	}
+	if err := tracker.load(); err != nil {
+		return nil, err
+	}
+	return tracker, nil
+}
+
+// state is the content of the state file.
+type state struct {
+	Month string  `json:"month"`
+	Spent float64 `json:"spent"`
+}
+
+// load restores the amount spent from the state file, if any.
+func (t *Tracker) load() error {
+	if t.stateFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(t.stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read usage state file: %w", err)
+	}
+	var s state
+	if err := json.Unmarshal(content, &s); err != nil {
+		return fmt.Errorf("failed to decode usage state file: %w", err)
+	}
+	t.month = s.Month
+	t.spent = s.Spent
+	t.setSpentMetric()
+	return nil
+}
+
+// save replaces the state file with the amount spent in the current month. It
+// must be called with the lock held.
+func (t *Tracker) save() error {
+	if t.stateFile == "" {
+		return nil
+	}
+	content, err := json.Marshal(state{Month: t.month, Spent: t.spent})
+	if err != nil {
+		return fmt.Errorf("failed to encode usage state: %w", err)
+	}
+	// the file is renamed so a crash while writing doesn't lose the state
+	tmpFile, err := os.CreateTemp(filepath.Dir(t.stateFile), filepath.Base(t.stateFile)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create usage state file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmpFile.Name())
+	}()
+	if _, err := tmpFile.Write(content); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("failed to write usage state file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write usage state file: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), t.stateFile); err != nil {
+		return fmt.Errorf("failed to replace usage state file: %w", err)
+	}
+	return nil
+}
+
+// Record adds the usage of the requests performed for the project, returning
+// their total.
+func (t *Tracker) Record(projectID int64, usages []agentic.Usage) Total {
+	var total Total
+	if t == nil {
+		return total
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	for _, usage := range usages {
+		total.InputTokens += usage.InputTokens
+		total.OutputTokens += usage.OutputTokens
+		total.Cost += t.cost(usage)
+	}
+	t.spent += total.Cost
+	if err := t.save(); err != nil {
+		t.logger.Error("failed to save the AI budget",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	project := strconv.FormatInt(projectID, 10)
+	metrics.Add(project+".inputTokens", total.InputTokens)
+	metrics.Add(project+".outputTokens", total.OutputTokens)
+	metrics.AddFloat(project+".cost", total.Cost)
+	t.setSpentMetric()
+	return total
+}
+
+// Exceeded informs if the estimated cost of the current month reached the
+// budget.
+func (t *Tracker) Exceeded() bool {
+	if t == nil || t.budget <= 0 {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+	return t.spent >= t.budget
+}
+
+// cost estimates the cost of a request. Models without price are reported once
+// and cost nothing.
+func (t *Tracker) cost(usage agentic.Usage) float64 {
+	price, ok := t.prices[usage.Provider+"/"+usage.Model]
+	if !ok {
+		price, ok = t.prices[usage.Model]
+	}
+	if !ok {
+		if _, reported := t.unpriced[usage.Model]; !reported && len(t.prices) > 0 {
+			t.logger.Warn("model without price, cost not estimated",
+				slog.String("provider", usage.Provider),
+				slog.String("model", usage.Model),
+			)
+		}
+		t.unpriced[usage.Model] = struct{}{}
+		return 0
+	}
+	return (float64(usage.InputTokens)*price.Input + float64(usage.OutputTokens)*price.Output) / 1_000_000
+}
+
+// rollover restarts the spent amount when the month changes. It must be called
+// with the lock held.
+func (t *Tracker) rollover() {
+	month := t.now().UTC().Format("2006-01")
+	if month == t.month {
+		return
+	}
+	if t.month != "" {
+		t.logger.Info("new month, restarting the AI budget",
+			slog.String("month", month),
+			slog.Float64("previousSpent", t.spent),
+		)
+	}
+	t.month = month
+	t.spent = 0
+	t.setSpentMetric()
+}
+
+// setSpentMetric exposes the amount spent in the current month. It must be
+// called with the lock held.
+func (t *Tracker) setSpentMetric() {
+	spent := new(expvar.Float)
+	spent.Set(t.spent)
+	metrics.Set("monthlyCost", spent)
+}
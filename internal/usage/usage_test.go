@@ -0,0 +1,149 @@
+package usage
+
+import (
+	"expvar"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rafaeljusto/teamwork-ai/internal/agentic"
+)
+
+func Test_Tracker(t *testing.T) {
+	now := time.Date(2025, 5, 31, 23, 0, 0, 0, time.UTC)
+	tracker, err := NewTracker(
+		WithPrices(Prices{
+			"gpt-4o":          {Input: 2.5, Output: 10},
+			"ollama/llama3.2": {Input: 0, Output: 0},
+		}),
+		WithMonthlyBudget(1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create tracker: %v", err)
+	}
+	tracker.now = func() time.Time { return now }
+	// the metrics are global, so only the changes made by this test are checked
+	inputTokensBefore, costBefore := intMetric("10.inputTokens"), floatMetric("20.cost")
+
+	total := tracker.Record(10, []agentic.Usage{{
+		Provider:     "openai",
+		Model:        "gpt-4o",
+		InputTokens:  200_000,
+		OutputTokens: 10_000,
+	}, {
+		Provider:     "ollama",
+		Model:        "llama3.2",
+		InputTokens:  1_000,
+		OutputTokens: 100,
+	}, {
+		Provider:     "anthropic",
+		Model:        "unknown",
+		InputTokens:  500,
+		OutputTokens: 50,
+	}})
+	expectedTotal := Total{InputTokens: 201_500, OutputTokens: 10_150, Cost: 0.6}
+	if total != expectedTotal {
+		t.Errorf("unexpected total %+v, expected %+v", total, expectedTotal)
+	}
+	if tracker.Exceeded() {
+		t.Errorf("unexpected budget exceeded")
+	}
+
+	tracker.Record(20, []agentic.Usage{{
+		Provider:     "openai",
+		Model:        "gpt-4o",
+		InputTokens:  160_000,
+		OutputTokens: 0,
+	}})
+	if !tracker.Exceeded() {
+		t.Errorf("expected budget exceeded")
+	}
+
+	now = now.Add(time.Hour)
+	if tracker.Exceeded() {
+		t.Errorf("unexpected budget exceeded in a new month")
+	}
+
+	if inputTokens := intMetric("10.inputTokens") - inputTokensBefore; inputTokens != 201_500 {
+		t.Errorf("unexpected input tokens metric %d", inputTokens)
+	}
+	if cost := floatMetric("20.cost") - costBefore; math.Abs(cost-0.4) > 1e-9 {
+		t.Errorf("unexpected cost metric %g", cost)
+	}
+	if monthlyCost := metrics.Get("monthlyCost").String(); monthlyCost != "0" {
+		t.Errorf("unexpected monthly cost metric %s", monthlyCost)
+	}
+}
+
+func Test_TrackerDisabled(t *testing.T) {
+	var nilTracker *Tracker
+	if total := nilTracker.Record(1, []agentic.Usage{{InputTokens: 10}}); total != (Total{}) {
+		t.Errorf("unexpected total %+v on nil tracker", total)
+	}
+	if nilTracker.Exceeded() {
+		t.Errorf("unexpected budget exceeded on nil tracker")
+	}
+
+	tracker, err := NewTracker()
+	if err != nil {
+		t.Fatalf("failed to create tracker: %v", err)
+	}
+	tracker.Record(1, []agentic.Usage{{Model: "gpt-4o", InputTokens: 1_000_000}})
+	if tracker.Exceeded() {
+		t.Errorf("unexpected budget exceeded without budget")
+	}
+}
+
+func Test_TrackerStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "usage.json")
+	newTracker := func() (*Tracker, error) {
+		return NewTracker(
+			WithPrices(Prices{"gpt-4o": {Input: 2.5, Output: 10}}),
+			WithMonthlyBudget(1),
+			WithStateFile(stateFile),
+		)
+	}
+
+	tracker, err := newTracker()
+	if err != nil {
+		t.Fatalf("failed to create tracker: %v", err)
+	}
+	tracker.Record(1, []agentic.Usage{{Model: "gpt-4o", InputTokens: 400_000}})
+
+	// a restarted application keeps the amount spent in the month
+	restarted, err := newTracker()
+	if err != nil {
+		t.Fatalf("failed to create restarted tracker: %v", err)
+	}
+	if !restarted.Exceeded() {
+		t.Errorf("expected budget exceeded after restart")
+	}
+
+	if err := os.WriteFile(stateFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatalf("failed to write state file: %v", err)
+	}
+	if _, err := newTracker(); err == nil || !strings.Contains(err.Error(), "failed to decode usage state file") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// intMetric returns the current value of the integer metric, or zero when it
+// wasn't created yet.
+func intMetric(name string) int64 {
+	if value, ok := metrics.Get(name).(*expvar.Int); ok {
+		return value.Value()
+	}
+	return 0
+}
+
+// floatMetric returns the current value of the float metric, or zero when it
+// wasn't created yet.
+func floatMetric(name string) float64 {
+	if value, ok := metrics.Get(name).(*expvar.Float); ok {
+		return value.Value()
+	}
+	return 0
+}
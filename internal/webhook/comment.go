@@ -0,0 +1,17 @@
+package webhook
+
+// CommentData represents the payload for the comment related webhook events in
+// Teamwork.com.
+type CommentData struct {
+	EventCreator struct {
+		ID        int64  `json:"id"`
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"eventCreator"`
+	Comment struct {
+		ID         int64  `json:"id"`
+		Body       string `json:"body"`
+		ObjectID   int64  `json:"objectId"`
+		ObjectType string `json:"objectType"`
+	} `json:"comment"`
+}
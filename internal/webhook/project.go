@@ -0,0 +1,10 @@
+package webhook
+
+// ProjectData represents the payload for the project related webhook events in
+// Teamwork.com.
+type ProjectData struct {
+	Project struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"project"`
+}
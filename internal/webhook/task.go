@@ -1,6 +1,10 @@
 package webhook
 
-import twapi "github.com/teamwork/twapi-go-sdk"
+import (
+	"strings"
+
+	twapi "github.com/teamwork/twapi-go-sdk"
+)
 
 // TaskData represents the payload for the task related webhook events in
 // Teamwork.com.
@@ -9,6 +13,7 @@ type TaskData struct {
 		ID          int64  `json:"id"`
 		Name        string `json:"name"`
 		Description string `json:"description"`
+		Tags        []Tag  `json:"tags"`
 	} `json:"project"`
 	Task struct {
 		ID               int64       `json:"id"`
@@ -19,10 +24,32 @@ type TaskData struct {
 		StartDate        *twapi.Date `json:"startDate"`
 		DueDate          *twapi.Date `json:"dueDate"`
 		EstimatedMinutes int64       `json:"estimatedMinutes"`
+		Tags             []Tag       `json:"tags"`
 	} `json:"task"`
 	Tasklist struct {
 		ID          int64  `json:"id"`
 		Name        string `json:"name"`
 		Description string `json:"description"`
+		Tags        []Tag  `json:"tags"`
 	} `json:"taskList"`
 }
+
+// HasTag reports whether the project, the tasklist or the task has a tag with
+// the given name. The comparison is case-insensitive.
+func (t TaskData) HasTag(name string) bool {
+	for _, tags := range [][]Tag{t.Project.Tags, t.Tasklist.Tags, t.Task.Tags} {
+		for _, tag := range tags {
+			if strings.EqualFold(strings.TrimSpace(tag.Name), strings.TrimSpace(name)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Tag represents a tag associated with an entity in the webhook payload.
+type Tag struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}